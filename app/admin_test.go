@@ -0,0 +1,375 @@
+package app_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"future-fashion/app/apptest"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/migrations"
+	"future-fashion/models"
+)
+
+// findAuditLogs lists the audit log with a token of its own, so the lookup is not audited itself
+func findAuditLogs(t *testing.T, s *apptest.Server, query string) []*dto.AuditLogResponse {
+	t.Helper()
+	auditor, err := (&models.UserCRUDOperationsImpl{DB: s.DB}).GetByUsername("auditor")
+	if err != nil {
+		auditor = s.CreateUser("auditor", helpers.RoleSuperAdmin)
+	}
+	token := newToken(t, s, helpers.NewClaim(auditor.ID, auditor.Username, auditor.Role, nil))
+	entries := &dto.ListAuditLogsResponse{}
+	s.Do("GET", "/admin/audit-logs?"+query, token, nil).ExpectSuccess().Decode(entries)
+	return entries.AuditLogs
+}
+
+func TestAdminLogin(t *testing.T) {
+	s := apptest.New(t)
+	s.CreateUser("root", helpers.RoleSuperAdmin)
+	s.CreateUser("alice", helpers.RoleCustomer)
+
+	token := s.LoginAdmin("root")
+	claims, err := (&helpers.Claims{}).VerifyToken(token, s.TokenKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Role != helpers.RoleSuperAdmin || len(claims.Permissions) != 1 || claims.Permissions[0] != helpers.PermissionAll {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	s.Do("POST", "/admin/login", "", &dto.LoginRequest{Password: apptest.Password}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("username")
+	s.Do("POST", "/admin/login", "", &dto.LoginRequest{Username: "root", Password: "wrong"}).ExpectFail("Invalid username or password")
+	s.Do("POST", "/admin/login", "", &dto.LoginRequest{Username: "nobody", Password: apptest.Password}).ExpectFail("Invalid username or password")
+	//roles without permissions cannot use the back office
+	s.Do("POST", "/admin/login", "", &dto.LoginRequest{Username: "alice", Password: apptest.Password}).ExpectFail("Invalid username or password")
+}
+
+func TestCreateCustomer(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("ada", helpers.RoleAdmin)
+	_, supportToken := s.NewStaff("sam", helpers.RoleSupport)
+
+	customer := &dto.UserResponse{}
+	s.Do("POST", "/admin/create-customer", token, &dto.UserRequest{
+		Username: "alice",
+		Email:    "alice@example.com",
+		Password: apptest.Password,
+		DOB:      "1990-01-01",
+	}).ExpectSuccess().Decode(customer)
+	if customer.Role != helpers.RoleCustomer {
+		t.Fatalf("unexpected customer %+v", customer)
+	}
+	s.LoginCustomer("alice")
+	s.Do("POST", "/admin/create-customer", token, &dto.UserRequest{Username: "alice2", Email: "Alice@example.com", Password: apptest.Password, DOB: "1990-01-01"}).
+		ExpectFail("Email address is already registered")
+
+	s.Do("POST", "/admin/create-customer", token, &dto.UserRequest{Username: "bob"}).ExpectError(http.StatusBadRequest, "invalid_fields").
+		ExpectFieldError("email").ExpectFieldError("password").ExpectFieldError("dob")
+	s.Do("POST", "/admin/create-customer", supportToken, &dto.UserRequest{Username: "bob", Email: "bob@example.com", Password: apptest.Password, DOB: "1990-01-01"}).
+		ExpectFail("You do not have permission for this operation")
+	s.Do("POST", "/admin/create-customer", token, `{"username":"eve","email":"eve@example.com","password":"correct-horse","dob":"1990-01-01","role":"super-admin"}`).
+		ExpectFail("Field \"role\" is not allowed")
+
+	entries := findAuditLogs(t, s, "action="+models.AuditActionCustomerCreate)
+	if len(entries) != 1 || entries[0].TargetID != fmt.Sprint(customer.ID) || entries[0].ActorUsername != "ada" {
+		t.Fatalf("unexpected audit log %+v", entries)
+	}
+}
+
+func TestListCustomers(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("sam", helpers.RoleSupport)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+	s.CreateUser("bob", helpers.RoleCustomer)
+
+	users := &dto.ListUsersResponse{}
+	s.Do("GET", "/admin/list-customers", token, nil).ExpectSuccess().Decode(users)
+	if len(users.Users) != 3 {
+		t.Fatalf("expected 3 users, got %v", len(users.Users))
+	}
+
+	user := &dto.UserResponse{}
+	s.Do("GET", fmt.Sprintf("/admin/get-customer-info?id=%v", alice.ID), token, nil).ExpectSuccess().Decode(user)
+	if user.Username != "alice" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	s.Do("GET", "/admin/get-customer-info", token, nil).ExpectFail("Url param key not exist")
+	s.Do("GET", "/admin/get-customer-info?id=alice", token, nil).ExpectError(http.StatusBadRequest, "invalid_parameter")
+	s.Do("GET", "/admin/get-customer-info?id=999", token, nil).ExpectError(http.StatusNotFound, "not_found")
+}
+
+func TestEditCustomer(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("ada", helpers.RoleAdmin)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+	s.CreateUser("bob", helpers.RoleCustomer)
+
+	user := &dto.UserResponse{}
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{ID: alice.ID, DOB: "1985-05-05", Hip: 98}).ExpectSuccess().Decode(user)
+	if user.DOB != "1985-05-05" || user.Hip != 98 || user.Username != "alice" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{DOB: "1985-05-05"}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("id")
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{ID: 999, DOB: "1985-05-05"}).ExpectError(http.StatusNotFound, "not_found")
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{ID: alice.ID, Email: "bob@example.com"}).ExpectFail("Email address is already registered")
+	//roles are assigned separately
+	s.Do("PATCH", "/admin/edit-customer", token, fmt.Sprintf(`{"id":%v,"role":"super-admin"}`, alice.ID)).ExpectFail("Field \"role\" is not allowed")
+
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{ID: alice.ID, Password: "reset-password"}).ExpectSuccess()
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: "reset-password"}).ExpectSuccess()
+
+	resets := findAuditLogs(t, s, "action="+models.AuditActionCustomerPasswordReset)
+	if len(resets) != 1 || resets[0].TargetID != fmt.Sprint(alice.ID) {
+		t.Fatalf("unexpected audit log %+v", resets)
+	}
+}
+
+func TestAdminsCannotManageHigherStaff(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("ada", helpers.RoleAdmin)
+	root := s.CreateUser("root", helpers.RoleSuperAdmin)
+	other, _ := s.NewStaff("alan", helpers.RoleAdmin)
+	path := fmt.Sprintf("?id=%v", root.ID)
+
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{ID: root.ID, Password: "taken-over"}).ExpectError(http.StatusForbidden, "outranked")
+	s.Do("POST", "/admin/login", "", &dto.LoginRequest{Username: "root", Password: "taken-over"}).ExpectFail("Invalid username or password")
+	s.Do("DELETE", "/admin/delete-customer"+path, token, nil).ExpectError(http.StatusForbidden, "outranked")
+	s.Do("GET", "/admin/get-customer-info"+path, token, nil).ExpectError(http.StatusForbidden, "outranked")
+	s.LoginAdmin("root")
+
+	//staff with the same permissions can still be managed
+	s.Do("GET", fmt.Sprintf("/admin/get-customer-info?id=%v", other.ID), token, nil).ExpectSuccess()
+}
+
+func TestAuditLogsLeaveOutPersonalData(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("ada", helpers.RoleAdmin)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{ID: alice.ID, Email: "alice@new.example.com", Hip: 98}).ExpectSuccess()
+
+	updates := findAuditLogs(t, s, "action="+models.AuditActionCustomerUpdate)
+	if len(updates) != 1 {
+		t.Fatalf("unexpected audit log %+v", updates)
+	}
+	entry := updates[0]
+	//the hip is matched as a json value, a timestamp may contain the digits
+	for _, personal := range []string{"alice", ":98", "1990-01-01"} {
+		for _, state := range []json.RawMessage{entry.Before, entry.After, entry.Diff} {
+			if strings.Contains(string(state), personal) {
+				t.Fatalf("the audit log keeps %q: %s", personal, state)
+			}
+		}
+	}
+	//the changed fields are still named
+	diff := map[string]interface{}{}
+	err := json.Unmarshal(entry.Diff, &diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff["email"] == nil || diff["hip"] == nil || diff["email_verified"] == nil {
+		t.Fatalf("unexpected diff %v", diff)
+	}
+}
+
+func TestDeleteAndRestoreCustomer(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("ada", helpers.RoleAdmin)
+	_, supportToken := s.NewStaff("sam", helpers.RoleSupport)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+	path := fmt.Sprintf("?id=%v", alice.ID)
+
+	s.Do("DELETE", "/admin/delete-customer"+path, supportToken, nil).ExpectFail("You do not have permission for this operation")
+	s.Do("DELETE", "/admin/delete-customer", token, nil).ExpectFail("Url param key not exist")
+	s.Do("DELETE", "/admin/delete-customer?id=x", token, nil).ExpectError(http.StatusBadRequest, "invalid_parameter")
+	s.Do("DELETE", "/admin/delete-customer"+path, token, nil).ExpectSuccess()
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: apptest.Password}).ExpectFail("Invalid username or password")
+
+	trashed := &dto.ListUsersResponse{}
+	s.Do("GET", "/admin/list-trashed-customers", token, nil).ExpectSuccess().Decode(trashed)
+	if len(trashed.Users) != 1 || trashed.Users[0].ID != alice.ID || trashed.Users[0].DeletedAt == nil {
+		t.Fatalf("unexpected trash %+v", trashed.Users)
+	}
+
+	s.Do("PATCH", "/admin/restore-customer", token, nil).ExpectFail("Url param key not exist")
+	s.Do("PATCH", "/admin/restore-customer"+path, token, nil).ExpectSuccess()
+	s.Do("PATCH", "/admin/restore-customer"+path, token, nil).ExpectError(http.StatusNotFound, "not_found")
+	s.LoginCustomer("alice")
+}
+
+func TestRestoreCustomerWithTakenEmail(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("ada", helpers.RoleAdmin)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+	path := fmt.Sprintf("?id=%v", alice.ID)
+	s.Do("DELETE", "/admin/delete-customer"+path, token, nil).ExpectSuccess()
+
+	//the address is free while alice is in the trash
+	s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: "alice2",
+		Email:    alice.Email,
+		Password: apptest.Password,
+		DOB:      "1990-01-01",
+	}).ExpectSuccess()
+
+	s.Do("PATCH", "/admin/restore-customer"+path, token, nil).ExpectError(http.StatusConflict, "email_taken")
+	trashed := &dto.ListUsersResponse{}
+	s.Do("GET", "/admin/list-trashed-customers", token, nil).ExpectSuccess().Decode(trashed)
+	if len(trashed.Users) != 1 || trashed.Users[0].ID != alice.ID {
+		t.Fatalf("expected alice to stay in the trash, got %+v", trashed.Users)
+	}
+}
+
+func TestUnlockAccount(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("ada", helpers.RoleAdmin)
+	_, supportToken := s.NewStaff("sam", helpers.RoleSupport)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+
+	//lock the account as if it had reached the maximum failures
+	loginAttempts := &models.LoginAttemptOperationsImpl{
+		DB:            s.DB,
+		Logger:        zap.NewNop().Sugar(),
+		AccountPolicy: models.DefaultAccountThrottlePolicy,
+		IPPolicy:      models.DefaultIPThrottlePolicy,
+	}
+	for i := 0; i < models.DefaultAccountThrottlePolicy.MaxFailures; i++ {
+		_, err := loginAttempts.RecordFailure(models.ThrottleKindAccount, "alice", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: apptest.Password}).ExpectFail("Too many failed login attempts")
+
+	s.Do("PATCH", "/admin/unlock-account", supportToken, &dto.UnlockAccountRequest{Username: "alice"}).ExpectFail("You do not have permission for this operation")
+	s.Do("PATCH", "/admin/unlock-account", token, &dto.UnlockAccountRequest{}).ExpectFail("Username or IP is required")
+	s.Do("PATCH", "/admin/unlock-account", token, &dto.UnlockAccountRequest{Username: "Alice"}).ExpectSuccess()
+	s.LoginCustomer("alice")
+
+	events := &dto.ListLockoutEventsResponse{}
+	s.Do("GET", "/admin/list-lockout-events", token, nil).ExpectSuccess().Decode(events)
+	if len(events.Events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events.Events)
+	}
+	if events.Events[0].Event != models.LockoutEventUnlocked || events.Events[0].Actor != "ada" || events.Events[1].Event != models.LockoutEventLocked {
+		t.Fatalf("unexpected events %+v %+v", events.Events[0], events.Events[1])
+	}
+	s.Do("GET", "/admin/list-lockout-events", supportToken, nil).ExpectFail("You do not have permission for this operation")
+
+	//the log keeps the user id, never the username
+	s.Do("PATCH", "/admin/unlock-account", token, &dto.UnlockAccountRequest{Username: "nobody"}).ExpectSuccess()
+	entries := findAuditLogs(t, s, "action="+models.AuditActionAccountUnlock)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.TargetID, "alice") || strings.Contains(entry.TargetID, "nobody") {
+			t.Fatalf("username is left in %+v", entry)
+		}
+	}
+	if len(findAuditLogs(t, s, fmt.Sprintf("action=%v&target_type=user&target_id=%v", models.AuditActionAccountUnlock, alice.ID))) != 1 {
+		t.Fatalf("expected the unlock of alice to reference the user id, got %+v", entries)
+	}
+}
+
+func TestListAuditLogs(t *testing.T) {
+	s := apptest.New(t)
+	ada, token := s.NewStaff("ada", helpers.RoleAdmin)
+	_, catalogToken := s.NewStaff("cathy", helpers.RoleCatalogManager)
+	createProduct(t, s, catalogToken, "linen-shirt")
+	createProduct(t, s, catalogToken, "wool-coat")
+	s.Do("POST", "/admin/create-customer", token, &dto.UserRequest{Username: "alice", Email: "alice@example.com", Password: apptest.Password, DOB: "1990-01-01"}).ExpectSuccess()
+
+	entries := &dto.ListAuditLogsResponse{}
+	s.Do("GET", "/admin/audit-logs", token, nil).ExpectSuccess().Decode(entries)
+	if len(entries.AuditLogs) != 3 || entries.AuditLogs[0].Action != models.AuditActionCustomerCreate {
+		t.Fatalf("unexpected audit logs %+v", entries.AuditLogs)
+	}
+
+	s.Do("GET", fmt.Sprintf("/admin/audit-logs?actor_id=%v", ada.ID), token, nil).ExpectSuccess().Decode(entries)
+	if len(entries.AuditLogs) != 1 {
+		t.Fatalf("expected 1 entry of ada, got %v", len(entries.AuditLogs))
+	}
+	s.Do("GET", "/admin/audit-logs?action=product.create&limit=1&offset=1", token, nil).ExpectSuccess().Decode(entries)
+	if len(entries.AuditLogs) != 1 || string(entries.AuditLogs[0].After) == "null" {
+		t.Fatalf("unexpected audit logs %+v", entries.AuditLogs)
+	}
+	s.Do("GET", "/admin/audit-logs?since=2000-01-01T00:00:00Z&until=2000-01-02T00:00:00Z", token, nil).ExpectSuccess().Decode(entries)
+	if len(entries.AuditLogs) != 0 {
+		t.Fatalf("expected no entries, got %v", len(entries.AuditLogs))
+	}
+
+	s.Do("GET", "/admin/audit-logs?limit=-1", token, nil).ExpectFail("limit must be a positive number")
+	s.Do("GET", "/admin/audit-logs?actor_id=ada", token, nil).ExpectFail("actor_id must be a number")
+	s.Do("GET", "/admin/audit-logs?since=yesterday", token, nil).ExpectFail("since must be an RFC 3339 timestamp")
+	s.Do("GET", "/admin/audit-logs", catalogToken, nil).ExpectFail("You do not have permission for this operation")
+}
+
+func TestRedactAuditUserDataMigration(t *testing.T) {
+	s := apptest.New(t)
+	//an entry written before personal data was left out
+	err := s.DB.Exec("INSERT INTO audit_logs (created_at, actor_id, actor_username, actor_role, action, target_type, target_id, before, after, diff) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		time.Now(), 7, "alice", helpers.RoleCustomer, models.AuditActionTwoFactorEnable, models.AuditTargetUser, "7",
+		`{"id":7,"email":"alice@example.com","role":"customer"}`, `{"id":7,"email":"alice@new.example.com","role":"customer"}`,
+		`{"email":{"before":"alice@example.com","after":"alice@new.example.com"}}`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.DB.Exec("DELETE FROM schema_migrations WHERE version = 3").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrations.New(s.DB, zap.NewNop().Sugar()).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := findAuditLogs(t, s, "target_id=7")
+	if len(entries) != 1 || entries[0].ActorUsername != "" || strings.Contains(string(entries[0].Before)+string(entries[0].After)+string(entries[0].Diff), "alice") {
+		t.Fatalf("personal data is left in %+v", entries)
+	}
+	if !strings.Contains(string(entries[0].Diff), `"email"`) || !strings.Contains(string(entries[0].After), `"role"`) {
+		t.Fatalf("unexpected entry %+v", entries[0])
+	}
+}
+
+func TestAuditUnlockTargetsMigration(t *testing.T) {
+	s := apptest.New(t)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+	//entries written before unlocks referenced the user id
+	for _, target := range []string{"account:alice", "account:nobody"} {
+		err := s.DB.Exec("INSERT INTO audit_logs (created_at, actor_id, actor_username, actor_role, action, target_type, target_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			time.Now(), 1, "ada", helpers.RoleAdmin, models.AuditActionAccountUnlock, models.AuditTargetAccount, target).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.DB.Exec("DELETE FROM schema_migrations WHERE version = 6").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrations.New(s.DB, zap.NewNop().Sugar()).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := findAuditLogs(t, s, "action="+models.AuditActionAccountUnlock)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	targets := map[string]bool{}
+	for _, entry := range entries {
+		targets[entry.TargetType+":"+entry.TargetID] = true
+	}
+	if !targets[fmt.Sprintf("user:%v", alice.ID)] || !targets["account:account"] {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+}
@@ -0,0 +1,124 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"future-fashion/app/apptest"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+)
+
+// createAPIKey creates a key for the user with the scopes and returns the plain key
+func createAPIKey(t *testing.T, s *apptest.Server, token string, userID uint, scopes ...string) string {
+	t.Helper()
+	apiKey := &dto.CreateAPIKeyResponse{}
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{
+		UserID: userID,
+		Name:   strings.Join(scopes, ","),
+		Scopes: scopes,
+	}).ExpectSuccess().Decode(apiKey)
+	return apiKey.Key
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	_, adminToken := s.NewStaff("ada", helpers.RoleAdmin)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+	walt := s.CreateUser("walt", helpers.RoleWarehouse)
+
+	apiKey := &dto.CreateAPIKeyResponse{}
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{
+		UserID:        walt.ID,
+		Name:          "scanner",
+		Scopes:        []string{helpers.PermissionOrdersRead},
+		ExpiresInDays: 7,
+	}).ExpectSuccess().Decode(apiKey)
+	if !strings.HasPrefix(apiKey.Key, apiKey.Prefix+"_") || apiKey.UserID != walt.ID || apiKey.ExpiresAt == nil {
+		t.Fatalf("unexpected api key %+v", apiKey)
+	}
+	s.DoWithAPIKey("GET", "/order/list-orders", apiKey.Key, nil).ExpectSuccess()
+	//the key is limited to its scopes even where the role allows more
+	s.DoWithAPIKey("PATCH", "/order/edit-order-status", apiKey.Key, &dto.EditOrderRequest{ID: 1, Status: "Shipped"}).
+		ExpectFail("You do not have permission for this operation")
+
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{UserID: walt.ID, Name: "scanner"}).
+		ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("scopes")
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{UserID: walt.ID, Name: "scanner", Scopes: []string{helpers.PermissionOrdersRead}, ExpiresInDays: -1}).
+		ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("expires_in_days")
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{UserID: walt.ID, Name: "scanner", Scopes: []string{"everything"}}).
+		ExpectFail("Unknown scope everything")
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{UserID: walt.ID, Name: "scanner", Scopes: []string{helpers.PermissionOrdersDelete}}).
+		ExpectFail("Role warehouse does not grant orders:delete")
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{UserID: alice.ID, Name: "shop", Scopes: []string{helpers.PermissionProductsWrite}}).
+		ExpectFail("Role customer does not grant products:write")
+	s.Do("POST", "/admin/create-api-key", token, &dto.CreateAPIKeyRequest{UserID: 999, Name: "ghost", Scopes: []string{helpers.ScopeProfileRead}}).
+		ExpectError(http.StatusNotFound, "not_found")
+	s.Do("POST", "/admin/create-api-key", adminToken, &dto.CreateAPIKeyRequest{UserID: alice.ID, Name: "shop", Scopes: []string{helpers.ScopeProfileRead}}).
+		ExpectFail("You do not have permission for this operation")
+}
+
+func TestCreateAPIKeyForHigherStaff(t *testing.T) {
+	s := apptest.New(t)
+	root, token := s.NewAdmin("root")
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{
+		Name:        "key-manager",
+		Permissions: []string{helpers.PermissionAPIKeysManage, helpers.PermissionOrdersRead},
+	}).ExpectSuccess()
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{
+		Name:        "order-reader",
+		Permissions: []string{helpers.PermissionOrdersRead},
+	}).ExpectSuccess()
+	_, keyManagerToken := s.NewStaff("kim", "key-manager")
+	walt := s.CreateUser("walt", helpers.RoleWarehouse)
+	rita := s.CreateUser("rita", "order-reader")
+
+	//a key can never do more than its issuer
+	s.Do("POST", "/admin/create-api-key", keyManagerToken, &dto.CreateAPIKeyRequest{UserID: walt.ID, Name: "scanner", Scopes: []string{helpers.PermissionOrdersUpdateStatus}}).
+		ExpectError(http.StatusForbidden, "scope_not_held")
+
+	//nor be issued for an account the issuer could not manage
+	s.Do("POST", "/admin/create-api-key", keyManagerToken, &dto.CreateAPIKeyRequest{UserID: walt.ID, Name: "scanner", Scopes: []string{helpers.PermissionOrdersRead}}).
+		ExpectError(http.StatusForbidden, "outranked")
+	s.Do("POST", "/admin/create-api-key", keyManagerToken, &dto.CreateAPIKeyRequest{UserID: root.ID, Name: "backdoor", Scopes: []string{helpers.ScopeProfileRead}}).
+		ExpectError(http.StatusForbidden, "outranked")
+
+	key := createAPIKey(t, s, keyManagerToken, rita.ID, helpers.PermissionOrdersRead)
+	s.DoWithAPIKey("GET", "/order/list-orders", key, nil).ExpectSuccess()
+}
+
+func TestListAndRevokeAPIKeys(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+	bob := s.CreateUser("bob", helpers.RoleCustomer)
+	key := createAPIKey(t, s, token, alice.ID, helpers.ScopeProfileRead)
+	createAPIKey(t, s, token, bob.ID, helpers.ScopeProfileRead)
+
+	keys := &dto.ListAPIKeysResponse{}
+	s.Do("GET", "/admin/list-api-keys", token, nil).ExpectSuccess().Decode(keys)
+	if len(keys.APIKeys) != 2 {
+		t.Fatalf("expected 2 keys, got %v", len(keys.APIKeys))
+	}
+	s.Do("GET", fmt.Sprintf("/admin/list-api-keys?user_id=%v", alice.ID), token, nil).ExpectSuccess().Decode(keys)
+	if len(keys.APIKeys) != 1 || keys.APIKeys[0].UserID != alice.ID {
+		t.Fatalf("unexpected keys %+v", keys.APIKeys)
+	}
+	s.Do("GET", "/admin/list-api-keys?user_id=alice", token, nil).ExpectError(http.StatusBadRequest, "invalid_parameter")
+
+	s.DoWithAPIKey("GET", "/user/personal-info", key, nil).ExpectSuccess()
+	path := fmt.Sprintf("/admin/revoke-api-key?id=%v", keys.APIKeys[0].ID)
+	s.Do("DELETE", path, token, nil).ExpectSuccess()
+	s.DoWithAPIKey("GET", "/user/personal-info", key, nil).ExpectFail("api key is revoked")
+	//revoking twice is harmless
+	s.Do("DELETE", path, token, nil).ExpectSuccess()
+
+	s.Do("DELETE", "/admin/revoke-api-key", token, nil).ExpectFail("Url param key not exist")
+	s.Do("DELETE", "/admin/revoke-api-key?id=999", token, nil).ExpectError(http.StatusNotFound, "not_found")
+
+	//a tampered key is rejected
+	s.DoWithAPIKey("GET", "/user/personal-info", key[:len(key)-1]+"x", nil).ExpectFail("invalid api key")
+}
@@ -0,0 +1,280 @@
+// Package app wires the models, handlers and middleware into the http api, so main and
+// the end-to-end tests run exactly the same router.
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"future-fashion/config"
+	"future-fashion/handlers"
+	"future-fashion/helpers"
+	"future-fashion/infra"
+	"future-fashion/metrics"
+	"future-fashion/middleware"
+	"future-fashion/migrations"
+	"future-fashion/models"
+	"future-fashion/tracing"
+)
+
+type App struct {
+	//the router wrapped in every middleware, ready to serve
+	Handler http.Handler
+	stops   []func()
+	//set to 1 by Serve once a shutdown starts, the readiness probe fails from then on
+	draining int32
+}
+
+// New builds the api on a migrated database and starts its background jobs, stop them with Close ...
+func New(cfg *config.Config, db *gorm.DB, mailer helpers.Mailer, logger *zap.SugaredLogger) (*App, error) {
+	app := &App{}
+
+	// Init Metrics
+	appMetrics := metrics.New()
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	err = appMetrics.RegisterDB(sqlDB, cfg.Database.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	// Init Tracing
+	tracerProvider, err := tracing.NewTracerProvider(newTracingConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	if tracerProvider != nil {
+		//the last batch of spans is flushed on Close
+		app.stops = append(app.stops, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := tracerProvider.Shutdown(ctx)
+			if err != nil {
+				logger.Errorw("failed to flush traces", "error", err)
+			}
+		})
+		err = db.Use(&tracing.GormPlugin{TracerProvider: tracerProvider, DBSystem: cfg.Database.Driver})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Init Trusted Proxies
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Init Models
+	userModel := &models.UserCRUDOperationsImpl{
+		DB:     db,
+		Logger: logger,
+	}
+
+	credentialModel := &models.CredentialOperationsImpl{
+		DB: db,
+	}
+
+	productModel := &models.ProductCRUDOperationsImpl{
+		DB:      db,
+		Logger:  logger,
+		Metrics: appMetrics,
+	}
+
+	orderModel := &models.OrderCRUDOperationsImpl{
+		DB:      db,
+		Logger:  logger,
+		Metrics: appMetrics,
+	}
+
+	verificationModel := &models.EmailVerificationOperationsImpl{
+		DB:     db,
+		Logger: logger,
+	}
+
+	loginAttemptModel := &models.LoginAttemptOperationsImpl{
+		DB:            db,
+		Logger:        logger,
+		AccountPolicy: models.DefaultAccountThrottlePolicy,
+		IPPolicy:      models.DefaultIPThrottlePolicy,
+		Metrics:       appMetrics,
+	}
+
+	twoFactorModel := &models.TwoFactorOperationsImpl{
+		DB:     db,
+		Logger: logger,
+	}
+
+	roleModel := &models.RoleOperationsImpl{
+		DB:     db,
+		Logger: logger,
+	}
+
+	apiKeyModel := &models.APIKeyOperationsImpl{
+		DB:     db,
+		Logger: logger,
+	}
+
+	auditModel := &models.AuditLogOperationsImpl{
+		DB:     db,
+		Logger: logger,
+	}
+
+	publicURL := strings.TrimSuffix(cfg.Server.PublicURL, "/")
+
+	// Init Login Providers
+	oidcModel := &models.OIDCOperationsImpl{
+		DB:     db,
+		Logger: logger,
+	}
+	oidcProviders, err := newOIDCProviders(cfg.OIDC, publicURL+"/user/oidc/callback")
+	if err != nil {
+		return nil, err
+	}
+
+	// Init Purge Job
+	//orders go first, users that still have orders are kept
+	app.stops = append(app.stops, infra.StartPurgeJob(
+		infra.PurgeConfig{Retention: cfg.Purge.Retention, Interval: cfg.Purge.Interval},
+		logger,
+		infra.PurgeTarget{Name: "orders", Purger: orderModel},
+		infra.PurgeTarget{Name: "products", Purger: productModel},
+		infra.PurgeTarget{Name: "users", Purger: userModel},
+	))
+
+	// Init Handlers
+	userHandler := &handlers.UserHandler{
+		UserModel:         userModel,
+		CredentialModel:   credentialModel,
+		OrderModel:        orderModel,
+		APIKeyModel:       apiKeyModel,
+		LoginAttemptModel: loginAttemptModel,
+		VerificationModel: verificationModel,
+		OIDCModel:         oidcModel,
+		OIDCProviders:     oidcProviders,
+		Mailer:            mailer,
+		VerifyEmailURL:    publicURL + "/user/verify-email",
+		Metrics:           appMetrics,
+		Logger:            logger,
+	}
+
+	adminHandler := &handlers.AdminHandler{
+		UserModel:         userModel,
+		CredentialModel:   credentialModel,
+		LoginAttemptModel: loginAttemptModel,
+		TwoFactorModel:    twoFactorModel,
+		RoleModel:         roleModel,
+		APIKeyModel:       apiKeyModel,
+		AuditModel:        auditModel,
+		Require2FA:        cfg.Auth.RequireAdmin2FA,
+		Logger:            logger,
+	}
+
+	productHandler := &handlers.ProductHandler{
+		ProductModel:    productModel,
+		CredentialModel: credentialModel,
+		APIKeyModel:     apiKeyModel,
+		AuditModel:      auditModel,
+		Logger:          logger,
+	}
+
+	orderHandler := &handlers.OrderHandler{
+		OrderModel:      orderModel,
+		ProductModel:    productModel,
+		UserModel:       userModel,
+		CredentialModel: credentialModel,
+		APIKeyModel:     apiKeyModel,
+		AuditModel:      auditModel,
+		Logger:          logger,
+	}
+
+	r := newRouter(userHandler, adminHandler, productHandler, orderHandler)
+	r.Use(middleware.SpanRoute)
+	r.Use(middleware.LogRoute)
+
+	// Init Rate Limiter
+	rateLimitStore := middleware.NewMemoryStore()
+	app.stops = append(app.stops, rateLimitStore.StartSweeping(time.Minute, time.Hour))
+	rateLimiter := &middleware.RateLimiter{
+		Config:   newRateLimitConfig(cfg.RateLimit),
+		Store:    rateLimitStore,
+		TokenKey: credentialModel.GetTokenKey,
+		Logger:   logger,
+	}
+	r.Use(rateLimiter.Middleware)
+
+	// Init Health Checks
+	//probes and scrapes bypass the rate limiter, everything else goes to the router
+	healthHandler := &healthHandler{
+		DB:       db,
+		Migrator: migrations.New(db, logger),
+		Draining: &app.draining,
+		Logger:   logger,
+	}
+	root := http.NewServeMux()
+	root.HandleFunc("/healthz", healthHandler.Live)
+	root.HandleFunc("/readyz", healthHandler.Ready)
+	if cfg.Metrics.Enabled {
+		root.Handle("/metrics", requireBearerToken(cfg.Metrics.Token.Value(), logger, appMetrics.Handler()))
+	}
+	root.Handle("/", middleware.Metrics(appMetrics, r)(r))
+
+	handler := middleware.CORS(middleware.CORSConfig{
+		AllowedOrigins: cfg.CORS.AllowedOrigins,
+		AllowedMethods: cfg.CORS.AllowedMethods,
+		AllowedHeaders: cfg.CORS.AllowedHeaders,
+		ExposedHeaders: middleware.CORSExposedHeaders,
+		MaxAge:         cfg.CORS.MaxAge,
+	})(root)
+	app.Handler = middleware.SecurityHeaders(middleware.SecurityHeadersConfigForEnvironment(cfg.Environment))(handler)
+	//a panic still gets the security headers and is logged with the request id
+	app.Handler = middleware.Recover(logger)(app.Handler)
+	app.Handler = middleware.RequestLogger(logger)(app.Handler)
+	app.Handler = middleware.TrustedProxies(trustedProxies)(app.Handler)
+	if tracerProvider != nil {
+		//outermost, so the span covers every middleware and picks up the caller's trace
+		app.Handler = otelhttp.NewHandler(app.Handler, "http.server",
+			otelhttp.WithTracerProvider(tracerProvider),
+			otelhttp.WithPropagators(tracing.Propagator()),
+			otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+				return "HTTP " + r.Method
+			}),
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				return r.URL.Path != "/healthz" && r.URL.Path != "/readyz" && r.URL.Path != "/metrics"
+			}),
+		)
+	}
+	return app, nil
+}
+
+// Close stops the background jobs started by New ...
+func (app *App) Close() {
+	for _, stop := range app.stops {
+		stop()
+	}
+	app.stops = nil
+}
+
+// NewMailer returns the configured mailer, the log mailer unless smtp is set ...
+func NewMailer(cfg config.MailerConfig, logger *zap.SugaredLogger) helpers.Mailer {
+	if cfg.Driver == "smtp" {
+		return &helpers.SMTPMailer{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password.Value(),
+			From:     cfg.SMTP.From,
+		}
+	}
+	return &helpers.LogMailer{
+		Logger: logger,
+	}
+}
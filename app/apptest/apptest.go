@@ -0,0 +1,328 @@
+// Package apptest runs the whole api on an in-memory SQLite database for end-to-end tests.
+// Every Server gets its own database with the built-in roles and a token key, and a
+// mailer that keeps the sent mail for the test to read.
+package apptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"future-fashion/app"
+	"future-fashion/config"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/infra"
+	"future-fashion/models"
+)
+
+// Password is the password of every user created by the helpers
+const Password = "correct-horse-battery"
+
+type Server struct {
+	HTTP *httptest.Server
+	App  *app.App
+	//base url of the api, also the configured public url
+	URL      string
+	Config   *config.Config
+	DB       *gorm.DB
+	Mailer   *helpers.CaptureMailer
+	TokenKey string
+	//everything the app logged, at every level
+	Logs *observer.ObservedLogs
+
+	t      testing.TB
+	client *http.Client
+}
+
+// New starts the api for the test and stops it when the test ends. The options may change
+// the config before the app is built, the public url always points at the test server.
+func New(t testing.TB, options ...func(cfg *config.Config)) *Server {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.Database.DSN = config.InMemorySQLiteDSN
+	//the tests log in far more often than a person would
+	cfg.RateLimit.Enabled = false
+	cfg.Purge.Interval = 0
+	for _, option := range options {
+		option(cfg)
+	}
+
+	db, err := infra.InitInMemoryDB()
+	if err != nil {
+		t.Fatalf("failed to open the database: %v", err)
+	}
+
+	tokenKey, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialModel := &models.CredentialOperationsImpl{DB: db}
+	_, err = credentialModel.Set(models.CredentialTypeTokenKey, tokenKey)
+	if err != nil {
+		t.Fatalf("failed to set the token key: %v", err)
+	}
+
+	s := &Server{
+		HTTP:     httptest.NewUnstartedServer(nil),
+		Config:   cfg,
+		DB:       db,
+		Mailer:   &helpers.CaptureMailer{},
+		TokenKey: tokenKey,
+		t:        t,
+	}
+	s.URL = "http://" + s.HTTP.Listener.Addr().String()
+	core, logs := observer.New(zap.DebugLevel)
+	s.Logs = logs
+	cfg.Server.PublicURL = s.URL
+
+	api, err := app.New(cfg, db, s.Mailer, zap.New(core).Sugar())
+	if err != nil {
+		t.Fatalf("failed to build the app: %v", err)
+	}
+	s.App = api
+	s.HTTP.Config.Handler = api.Handler
+	s.HTTP.Start()
+
+	//redirects are returned to the test instead of followed
+	s.client = s.HTTP.Client()
+	s.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	t.Cleanup(func() {
+		s.HTTP.Close()
+		api.Close()
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+	return s
+}
+
+// Response is a finished request, Code is the HTTP status and the other fields are read from the usual json body
+type Response struct {
+	Code      int
+	Header    http.Header
+	Body      []byte
+	Status    string
+	ErrorCode string
+	Message   string
+	Details   json.RawMessage
+	Errors    []helpers.FieldError
+
+	t testing.TB
+}
+
+// Request sends a request to the api. The body is sent as is when it is a string and
+// encoded as json otherwise, nil sends no body.
+func (s *Server) Request(method, path string, body interface{}, header http.Header) *Response {
+	s.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		s.t.Fatalf("%v %v failed: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	response := &Response{
+		Code:   res.StatusCode,
+		Header: res.Header,
+		Body:   resBody,
+		t:      s.t,
+	}
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") {
+		decoded := &struct {
+			Status  string               `json:"status"`
+			Code    string               `json:"code"`
+			Message string               `json:"message"`
+			Details json.RawMessage      `json:"details"`
+			Errors  []helpers.FieldError `json:"errors"`
+		}{}
+		if json.Unmarshal(resBody, decoded) == nil {
+			response.Status = decoded.Status
+			response.ErrorCode = decoded.Code
+			response.Message = decoded.Message
+			response.Details = decoded.Details
+			response.Errors = decoded.Errors
+		}
+	}
+	return response
+}
+
+// Do sends a request with the bearer token, an empty token sends none
+func (s *Server) Do(method, path, token string, body interface{}) *Response {
+	s.t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return s.Request(method, path, body, header)
+}
+
+// DoWithAPIKey sends a request authenticated with an api key
+func (s *Server) DoWithAPIKey(method, path, key string, body interface{}) *Response {
+	s.t.Helper()
+	header := http.Header{}
+	header.Set("X-API-Key", key)
+	return s.Request(method, path, body, header)
+}
+
+// ExpectSuccess fails the test unless the api reported success, and returns the response
+func (r *Response) ExpectSuccess() *Response {
+	r.t.Helper()
+	if r.Status != "SUCCESS" || r.Code != http.StatusOK {
+		r.t.Fatalf("expected SUCCESS, got %v %q: %s", r.Code, r.Message, r.Body)
+	}
+	return r
+}
+
+// ExpectFail fails the test unless the api reported a failure with a message containing message
+func (r *Response) ExpectFail(message string) *Response {
+	r.t.Helper()
+	if r.Status != "FAIL" {
+		r.t.Fatalf("expected FAIL, got %v %v: %s", r.Code, r.Status, r.Body)
+	}
+	if !strings.Contains(r.Message, message) {
+		r.t.Fatalf("expected a message containing %q, got %q", message, r.Message)
+	}
+	return r
+}
+
+// ExpectError fails the test unless the api failed with the HTTP status and error code
+func (r *Response) ExpectError(status int, code string) *Response {
+	r.t.Helper()
+	if r.Status != "FAIL" || r.Code != status || r.ErrorCode != code {
+		r.t.Fatalf("expected FAIL %v %v, got %v %v %v: %s", status, code, r.Code, r.Status, r.ErrorCode, r.Body)
+	}
+	return r
+}
+
+// ExpectFieldError fails the test unless the response reports a validation error for the field
+func (r *Response) ExpectFieldError(field string) *Response {
+	r.t.Helper()
+	for _, fieldErr := range r.Errors {
+		if fieldErr.Field == field {
+			return r
+		}
+	}
+	r.t.Fatalf("expected an error for field %v, got %s", field, r.Body)
+	return r
+}
+
+// Decode decodes the details of the response into v
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+	err := json.Unmarshal(r.Details, v)
+	if err != nil {
+		r.t.Fatalf("failed to decode %s: %v", r.Details, err)
+	}
+}
+
+// Token returns the details of a login response
+func (r *Response) Token() string {
+	r.t.Helper()
+	var token string
+	r.ExpectSuccess().Decode(&token)
+	return token
+}
+
+// CreateUser inserts a user with a verified email address and Password as password ...
+func (s *Server) CreateUser(username, role string) *models.User {
+	s.t.Helper()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	userModel := &models.UserCRUDOperationsImpl{DB: s.DB, Logger: zap.NewNop().Sugar()}
+	user, err := userModel.Insert(&dto.UserRequest{
+		Username: username,
+		Email:    fmt.Sprintf("%v@example.com", username),
+		Password: string(hashedPassword),
+		DOB:      "1990-01-01",
+		Role:     role,
+	})
+	if err != nil {
+		s.t.Fatalf("failed to create %v: %v", username, err)
+	}
+	user, err = userModel.MarkEmailVerified(user.ID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+// LoginCustomer logs in through /user/login and returns the token
+func (s *Server) LoginCustomer(username string) string {
+	s.t.Helper()
+	return s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: username, Password: Password}).Token()
+}
+
+// LoginAdmin logs in through /admin/login and returns the token, the account must not use two-factor authentication
+func (s *Server) LoginAdmin(username string) string {
+	s.t.Helper()
+	return s.Do("POST", "/admin/login", "", &dto.LoginRequest{Username: username, Password: Password}).Token()
+}
+
+// NewCustomer creates a customer and logs them in
+func (s *Server) NewCustomer(username string) (*models.User, string) {
+	s.t.Helper()
+	user := s.CreateUser(username, helpers.RoleCustomer)
+	return user, s.LoginCustomer(username)
+}
+
+// NewStaff creates a staff user with the role and logs them in
+func (s *Server) NewStaff(username, role string) (*models.User, string) {
+	s.t.Helper()
+	user := s.CreateUser(username, role)
+	return user, s.LoginAdmin(username)
+}
+
+// NewAdmin creates a super-admin and logs them in
+func (s *Server) NewAdmin(username string) (*models.User, string) {
+	s.t.Helper()
+	return s.NewStaff(username, helpers.RoleSuperAdmin)
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"fmt"
+
+	"future-fashion/config"
+	"future-fashion/helpers"
+	"future-fashion/middleware"
+	"future-fashion/tracing"
+)
+
+// newRateLimitConfig maps the configured limits onto the middleware ...
+func newRateLimitConfig(cfg config.RateLimitConfig) middleware.RateLimitConfig {
+	routeLimit := func(limit config.RouteLimit) middleware.RouteLimit {
+		return middleware.RouteLimit{
+			Limit: middleware.Limit{Requests: limit.Requests, Per: limit.Per, Burst: limit.Burst},
+			KeyBy: limit.KeyBy,
+		}
+	}
+
+	rateLimitConfig := middleware.RateLimitConfig{
+		Enabled: cfg.Enabled,
+		Default: routeLimit(cfg.Default),
+		Routes:  map[string]middleware.RouteLimit{},
+	}
+	for route, limit := range cfg.Routes {
+		rateLimitConfig.Routes[route] = routeLimit(limit)
+	}
+	return rateLimitConfig
+}
+
+// newTracingConfig takes the environment along so traces of staging and production are kept apart ...
+func newTracingConfig(cfg *config.Config) tracing.Config {
+	headers := map[string]string{}
+	for name, value := range cfg.Tracing.Headers {
+		headers[name] = value.Value()
+	}
+	return tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Headers:     headers,
+		ServiceName: cfg.Tracing.ServiceName,
+		Environment: cfg.Environment,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	}
+}
+
+// newOIDCProviders fills in the issuer, scopes and response mode of the providers we know ...
+func newOIDCProviders(cfg config.OIDCConfig, redirectURL string) (map[string]*helpers.OIDCProvider, error) {
+	providers := map[string]*helpers.OIDCProvider{}
+	for name, providerConfig := range cfg.Providers {
+		provider := &helpers.OIDCProvider{
+			Name:         name,
+			Issuer:       providerConfig.Issuer,
+			ClientID:     providerConfig.ClientID,
+			ClientSecret: providerConfig.ClientSecret.Value(),
+			RedirectURL:  redirectURL,
+			Scopes:       providerConfig.Scopes,
+			ResponseMode: providerConfig.ResponseMode,
+		}
+
+		if known, ok := helpers.KnownOIDCProviders[name]; ok {
+			if provider.Issuer == "" {
+				provider.Issuer = known.Issuer
+			}
+			if len(provider.Scopes) == 0 {
+				provider.Scopes = known.Scopes
+			}
+			if provider.ResponseMode == "" {
+				provider.ResponseMode = known.ResponseMode
+			}
+		}
+
+		if provider.Issuer == "" {
+			return nil, fmt.Errorf("oidc provider %v needs an issuer", name)
+		}
+		providers[name] = provider
+	}
+	return providers, nil
+}
@@ -0,0 +1,73 @@
+package app_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"future-fashion/app/apptest"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+)
+
+func TestErrorStatusCodes(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	_, customerToken := s.NewCustomer("alice")
+	_, supportToken := s.NewStaff("sam", helpers.RoleSupport)
+
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: "wrong"}).
+		ExpectError(http.StatusUnauthorized, "invalid_credentials")
+	s.Do("GET", "/user/personal-info", "", nil).
+		ExpectError(http.StatusUnauthorized, "missing_token")
+	s.DoWithAPIKey("GET", "/user/personal-info", "ffk_unknown_key", nil).
+		ExpectError(http.StatusUnauthorized, "invalid_api_key")
+	s.Do("DELETE", "/admin/delete-customer?id=2", supportToken, nil).
+		ExpectError(http.StatusForbidden, "permission_denied")
+	s.Do("POST", "/admin/2fa/enroll", customerToken, nil).
+		ExpectError(http.StatusForbidden, "staff_only")
+	s.Do("GET", "/admin/get-customer-info?id=999", token, nil).
+		ExpectError(http.StatusNotFound, "not_found")
+	s.Do("PATCH", "/admin/edit-customer", token, &dto.EditUserReq{ID: 999, DOB: "1985-05-05"}).
+		ExpectError(http.StatusNotFound, "not_found")
+	s.Do("POST", "/user/signup", "", &dto.UserRequest{Username: "alice2", Email: "alice@example.com", Password: apptest.Password, DOB: "1990-01-01"}).
+		ExpectError(http.StatusConflict, "email_taken")
+	s.Do("POST", "/product/create-product", token, &dto.ProductRequest{Item: "no-price"}).
+		ExpectError(http.StatusBadRequest, "invalid_fields")
+}
+
+func TestValidationErrorFields(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+
+	s.Do("GET", "/admin/get-customer-info", token, nil).
+		ExpectError(http.StatusBadRequest, "missing_parameter").ExpectFieldError("id")
+	s.Do("GET", "/admin/get-customer-info?id=alice", token, nil).
+		ExpectError(http.StatusBadRequest, "invalid_parameter").ExpectFieldError("id")
+	s.Do("GET", "/admin/audit-logs?since=yesterday", token, nil).
+		ExpectError(http.StatusBadRequest, "invalid_parameter").ExpectFieldError("since")
+	s.Do("PATCH", "/admin/edit-customer", token, `{"id":"1"}`).
+		ExpectError(http.StatusBadRequest, "invalid_field").ExpectFieldError("id")
+	s.Do("PATCH", "/admin/edit-customer", token, `{"id":1,"role":"super-admin"}`).
+		ExpectError(http.StatusBadRequest, "unknown_field").ExpectFieldError("role")
+	s.Do("PATCH", "/admin/edit-customer", token, `{"id":1`).
+		ExpectError(http.StatusBadRequest, "invalid_body")
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{Name: "hacker", Permissions: []string{"root:everything"}}).
+		ExpectError(http.StatusBadRequest, "unknown_permission").ExpectFieldError("permissions")
+}
+
+func TestInternalErrorsAreMasked(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	res := s.Do("GET", "/admin/list-customers", token, nil).ExpectError(http.StatusInternalServerError, "internal")
+	if strings.Contains(strings.ToLower(string(res.Body)), "sql") {
+		t.Fatalf("the database error leaked to the client: %s", res.Body)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"future-fashion/helpers"
+	"future-fashion/migrations"
+)
+
+// readyTimeout bounds the database checks of a readiness probe, a probe that hangs is a failed probe
+const readyTimeout = 2 * time.Second
+
+var errDraining = helpers.NewUnavailableError("shutting_down", "NOTE: The server is shutting down")
+
+// healthHandler answers the liveness and readiness probes of the load balancer ...
+type healthHandler struct {
+	DB       *gorm.DB
+	Migrator *migrations.Migrator
+	//set to 1 once a shutdown starts, read with sync/atomic
+	Draining *int32
+	Logger   *zap.SugaredLogger
+}
+
+// Live reports that the process is up and serving, it does not look at the database
+// so a database outage does not get the server restarted ...
+func (h *healthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	helpers.JsonResponse(w, "SUCCESS", "ok", nil)
+}
+
+// Ready reports whether the server should get traffic: it is not shutting down, the database
+// answers and every migration is applied ...
+func (h *healthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	err := h.check(r.Context())
+	if err != nil {
+		h.Logger.Warnw("readiness check failed", "error", err)
+		helpers.ErrorResponse(
+			w,
+			r,
+			h.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(w, "SUCCESS", "ready", nil)
+}
+
+func (h *healthHandler) check(ctx context.Context) error {
+	if atomic.LoadInt32(h.Draining) == 1 {
+		return errDraining
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return databaseUnavailable(err)
+	}
+	err = sqlDB.PingContext(ctx)
+	if err != nil {
+		return databaseUnavailable(err)
+	}
+
+	upToDate, err := h.Migrator.UpToDate(ctx)
+	if err != nil {
+		return databaseUnavailable(err)
+	}
+	if !upToDate {
+		return helpers.NewUnavailableError("migrations_pending", "NOTE: The database has pending migrations")
+	}
+	return nil
+}
+
+// databaseUnavailable keeps the cause for the log, the probe only learns the database is down
+func databaseUnavailable(err error) *helpers.AppError {
+	appErr := helpers.NewUnavailableError("database_unavailable", "NOTE: The database is not reachable")
+	appErr.Err = err
+	return appErr
+}
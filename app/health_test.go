@@ -0,0 +1,133 @@
+package app_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"future-fashion/app/apptest"
+	"future-fashion/config"
+)
+
+func TestHealthz(t *testing.T) {
+	s := apptest.New(t)
+	s.Do("GET", "/healthz", "", nil).ExpectSuccess()
+
+	//liveness does not depend on the database
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+	s.Do("GET", "/healthz", "", nil).ExpectSuccess()
+}
+
+func TestReadyz(t *testing.T) {
+	s := apptest.New(t)
+	s.Do("GET", "/readyz", "", nil).ExpectSuccess()
+
+	err := s.DB.Exec("DELETE FROM schema_migrations WHERE version = (SELECT MAX(version) FROM schema_migrations)").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Do("GET", "/readyz", "", nil).ExpectError(http.StatusServiceUnavailable, "migrations_pending")
+
+	//the probe only reads, it never creates the migration tables
+	err = s.DB.Migrator().DropTable("schema_migrations_lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Do("GET", "/readyz", "", nil).ExpectError(http.StatusServiceUnavailable, "migrations_pending")
+	if s.DB.Migrator().HasTable("schema_migrations_lock") {
+		t.Fatal("the readiness probe created schema_migrations_lock")
+	}
+
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+	s.Do("GET", "/readyz", "", nil).ExpectError(http.StatusServiceUnavailable, "database_unavailable")
+}
+
+func TestServeDrainsRequestsOnShutdown(t *testing.T) {
+	s := apptest.New(t)
+	api := s.App.Handler
+
+	//a checkout that is still running when the shutdown starts
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.App.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+			_, _ = io.WriteString(w, "done")
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default().Server
+	cfg.ShutdownTimeout = 5 * time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.App.Serve(ctx, listener, cfg)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String() + "/slow")
+		if err != nil {
+			slow <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+	<-started
+	cancel()
+
+	//the readiness probe fails as soon as the shutdown starts
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+		if recorder.Code == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("readyz still answers %v while shutting down", recorder.Code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-served:
+		t.Fatalf("server stopped before the request in flight finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if res := <-slow; res.err != nil || res.body != "done" {
+		t.Fatalf("request in flight was dropped: %+v", res)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("unclean shutdown: %v", err)
+	}
+}
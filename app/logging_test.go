@@ -0,0 +1,126 @@
+package app_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"future-fashion/app/apptest"
+	"future-fashion/config"
+	"future-fashion/dto"
+	"future-fashion/middleware"
+)
+
+// accessLog returns the fields of the access log line of the request with the id
+func accessLog(t *testing.T, logs *observer.ObservedLogs, id string) map[string]interface{} {
+	t.Helper()
+	for _, entry := range logs.FilterMessage("request").All() {
+		fields := entry.ContextMap()
+		if fields["request_id"] == id {
+			return fields
+		}
+	}
+	t.Fatalf("no access log for request %q in %+v", id, logs.All())
+	return nil
+}
+
+func TestRequestID(t *testing.T) {
+	s := apptest.New(t)
+	user, token := s.NewCustomer("alice")
+
+	stockCart(t, s)
+
+	//a valid id from the caller is kept
+	res := s.Request("POST", "/order/create-order", &dto.OrderRequest{Total: 99.8, Snapshots: cart}, http.Header{
+		"Authorization": {"Bearer " + token},
+		"X-Request-Id":  {"lb-1234.abcd"},
+	}).ExpectSuccess()
+	if id := res.Header.Get("X-Request-ID"); id != "lb-1234.abcd" {
+		t.Fatalf("expected the caller's request id, got %q", id)
+	}
+
+	fields := accessLog(t, s.Logs, "lb-1234.abcd")
+	if fields["route"] != "/order/create-order" || fields["user_id"] != uint64(user.ID) || fields["status"] != int64(http.StatusOK) || fields["method"] != "POST" {
+		t.Fatalf("unexpected access log %+v", fields)
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	s := apptest.New(t)
+
+	for _, header := range []http.Header{
+		nil,
+		{"X-Request-Id": {"has spaces\tand tabs"}},
+	} {
+		res := s.Request("GET", "/product/list-products", nil, header)
+		id := res.Header.Get("X-Request-ID")
+		if len(id) != 32 {
+			t.Fatalf("expected a generated request id, got %q", id)
+		}
+		accessLog(t, s.Logs, id)
+	}
+
+	//probes are only logged at debug
+	id := s.Do("GET", "/healthz", "", nil).ExpectSuccess().Header.Get("X-Request-ID")
+	for _, entry := range s.Logs.FilterMessage("request").All() {
+		if entry.ContextMap()["request_id"] == id && entry.Level != zapcore.DebugLevel {
+			t.Fatalf("the health check was logged at %v", entry.Level)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	forwarded := http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}}
+
+	//the header is ignored when it does not come from a trusted proxy
+	s := apptest.New(t)
+	id := s.Request("GET", "/product/list-products", nil, forwarded).Header.Get("X-Request-ID")
+	if ip := accessLog(t, s.Logs, id)["ip"]; ip != "127.0.0.1" {
+		t.Fatalf("expected the peer address, got %v", ip)
+	}
+
+	//behind a trusted proxy the client is the last address it did not add itself
+	s = apptest.New(t, func(cfg *config.Config) {
+		cfg.Server.TrustedProxies = []string{"127.0.0.0/8"}
+	})
+	id = s.Request("GET", "/product/list-products", nil, forwarded).Header.Get("X-Request-ID")
+	if ip := accessLog(t, s.Logs, id)["ip"]; ip != "203.0.113.7" {
+		t.Fatalf("expected the forwarded client address, got %v", ip)
+	}
+	id = s.Request("GET", "/product/list-products", nil, http.Header{"X-Forwarded-For": {"203.0.113.7, 127.0.0.2"}}).Header.Get("X-Request-ID")
+	if ip := accessLog(t, s.Logs, id)["ip"]; ip != "203.0.113.7" {
+		t.Fatalf("expected the address before the proxies, got %v", ip)
+	}
+}
+
+func TestRecoverFromPanic(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+	handler := middleware.RequestLogger(logger)(middleware.Recover(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var order *dto.OrderRequest
+		_ = order.Total
+	})))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/boom", nil))
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %v", res.Code)
+	}
+	if body := res.Body.String(); !strings.Contains(body, `"code":"internal"`) {
+		t.Fatalf("unexpected body %v", body)
+	}
+
+	id := res.Header().Get("X-Request-ID")
+	panics := logs.FilterMessage("handler panicked").All()
+	if len(panics) != 1 || panics[0].ContextMap()["request_id"] != id || panics[0].ContextMap()["stack"] == "" {
+		t.Fatalf("the panic was not logged with the request id: %+v", panics)
+	}
+	if fields := accessLog(t, logs, id); fields["status"] != int64(http.StatusInternalServerError) {
+		t.Fatalf("unexpected access log %+v", fields)
+	}
+}
@@ -0,0 +1,34 @@
+package app
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"future-fashion/helpers"
+)
+
+var errInvalidMetricsToken = helpers.NewUnauthorizedError("invalid_token", "NOTE: Invalid metrics token")
+
+// requireBearerToken guards the metrics endpoint with a static token shared with Prometheus,
+// an empty token leaves it open for local development ...
+func requireBearerToken(token string, logger *zap.SugaredLogger, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			helpers.ErrorResponse(
+				w,
+				r,
+				logger,
+				errInvalidMetricsToken,
+			)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package app_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"future-fashion/app/apptest"
+	"future-fashion/config"
+	"future-fashion/dto"
+)
+
+func scrape(t *testing.T, s *apptest.Server, header http.Header) string {
+	t.Helper()
+	res := s.Request("GET", "/metrics", nil, header)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected the metrics, got %v: %s", res.Code, res.Body)
+	}
+	return string(res.Body)
+}
+
+func TestMetrics(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+
+	signUp(s, "bob").ExpectSuccess()
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: "wrong"}).ExpectError(http.StatusUnauthorized, "invalid_credentials")
+	placeOrder(t, s, token)
+	placeOrder(t, s, token)
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{Total: 10, Snapshots: []*dto.CartModel{{Id: "1", Item: "linen-shirt", Price: 49.9, Sizing: "m", Quantity: 100}}}).
+		ExpectError(http.StatusConflict, "out_of_stock")
+	s.Do("GET", "/no-such-route", "", nil)
+	s.Do("GET", "/user/login", "", nil)
+
+	body := scrape(t, s, nil)
+	for _, line := range []string{
+		`future_fashion_orders_created_total 2`,
+		//order totals are float32
+		`future_fashion_revenue_total 199.6000`,
+		`future_fashion_out_of_stock_rejections_total 1`,
+		`future_fashion_signups_total{method="password"} 1`,
+		`future_fashion_failed_logins_total 1`,
+		`future_fashion_http_requests_total{method="POST",route="/user/login",status="401"} 1`,
+		`future_fashion_http_requests_total{method="POST",route="/order/create-order",status="200"} 2`,
+		`future_fashion_http_requests_total{method="POST",route="/order/create-order",status="409"} 1`,
+		`future_fashion_http_request_duration_seconds_count{method="POST",route="/order/create-order"} 3`,
+		//answered by the router itself
+		`future_fashion_http_requests_total{method="GET",route="unknown",status="404"} 1`,
+		`future_fashion_http_requests_total{method="GET",route="unknown",status="405"} 1`,
+		`go_sql_max_open_connections{db_name="sqlite"} 1`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics are missing %v", line)
+		}
+	}
+}
+
+func TestMetricsToken(t *testing.T) {
+	s := apptest.New(t, func(cfg *config.Config) {
+		cfg.Metrics.Token = "scrape-secret"
+	})
+
+	s.Request("GET", "/metrics", nil, nil).ExpectError(http.StatusUnauthorized, "invalid_token")
+	s.Request("GET", "/metrics", nil, http.Header{"Authorization": {"Bearer wrong"}}).ExpectError(http.StatusUnauthorized, "invalid_token")
+	scrape(t, s, http.Header{"Authorization": {"Bearer scrape-secret"}})
+}
@@ -0,0 +1,199 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"future-fashion/app/apptest"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+var cart = []*dto.CartModel{
+	{Id: "1", Item: "linen-shirt", Price: 49.9, Sizing: "m", Quantity: 2},
+}
+
+// stockCart makes sure the product in cart exists with enough stock for the test
+func stockCart(t *testing.T, s *apptest.Server) *models.Product {
+	t.Helper()
+	products := &models.ProductCRUDOperationsImpl{DB: s.DB}
+	product, err := products.GetByID(1)
+	if err == nil {
+		return product
+	}
+	product, err = products.Insert(&models.Product{Model: gorm.Model{ID: 1}, Item: "linen-shirt", Price: 49.9, Stock: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func placeOrder(t *testing.T, s *apptest.Server, token string) *dto.OrderResponse {
+	t.Helper()
+	stockCart(t, s)
+	order := &dto.OrderResponse{}
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{
+		Total:     99.8,
+		Snapshots: cart,
+	}).ExpectSuccess().Decode(order)
+	return order
+}
+
+func listOrders(t *testing.T, s *apptest.Server, path, token string) []*dto.OrderResponse {
+	t.Helper()
+	orders := &dto.ListOrdersResponse{}
+	s.Do("GET", path, token, nil).ExpectSuccess().Decode(orders)
+	return orders.Orders
+}
+
+func TestCreateOrder(t *testing.T) {
+	s := apptest.New(t)
+	alice, token := s.NewCustomer("alice")
+
+	order := placeOrder(t, s, token)
+	if order.UserID != alice.ID || order.Status != models.OrderStatusConfirmed || len(order.Snapshots) != 1 || order.Snapshots[0].Quantity != 2 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+
+	//status and owner are decided by the server
+	s.Do("POST", "/order/create-order", token, `{"total":1,"status":"Delivered"}`).ExpectFail("Field \"status\" is not allowed")
+	s.Do("POST", "/order/create-order", token, `{"total":1,"userID":2}`).ExpectFail("Field \"userID\" is not allowed")
+	s.Do("POST", "/order/create-order", token, `null`).ExpectError(http.StatusBadRequest, "invalid_fields")
+
+	//checkout needs a verified email address
+	signUp(s, "bob").ExpectSuccess()
+	s.Do("POST", "/order/create-order", s.LoginCustomer("bob"), &dto.OrderRequest{Total: 1, Snapshots: cart}).ExpectFail("Please verify your email address before checking out")
+}
+
+func TestCreateOrderStock(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+	_, catalogToken := s.NewStaff("cathy", helpers.RoleCatalogManager)
+	product := createProduct(t, s, catalogToken, "wool-coat")
+	line := func(size string, quantity int) *dto.CartModel {
+		return &dto.CartModel{Id: fmt.Sprint(product.ID), Item: product.Item, Price: product.Price, Sizing: size, Quantity: quantity}
+	}
+
+	//the sizes of a product share its stock
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{Total: 10, Snapshots: []*dto.CartModel{line("m", 6), line("l", 5)}}).
+		ExpectError(http.StatusConflict, "out_of_stock")
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{Total: 10, Snapshots: []*dto.CartModel{line("m", 6), line("l", 4)}}).ExpectSuccess()
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{Total: 10, Snapshots: []*dto.CartModel{line("m", 1)}}).
+		ExpectFail("wool-coat is out of stock")
+	for _, listed := range listProducts(t, s) {
+		if listed.ID == product.ID && listed.Stock != 0 {
+			t.Fatalf("expected the stock to be used up, got %v", listed.Stock)
+		}
+	}
+
+	//a rejected cart takes nothing
+	other := stockCart(t, s)
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{Total: 10, Snapshots: []*dto.CartModel{cart[0], line("m", 1)}}).
+		ExpectError(http.StatusConflict, "out_of_stock")
+	if found, _ := (&models.ProductCRUDOperationsImpl{DB: s.DB}).GetByID(other.ID); found.Stock != other.Stock {
+		t.Fatalf("expected the stock of %v to stay %v, got %v", other.Item, other.Stock, found.Stock)
+	}
+
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{Total: 10, Snapshots: []*dto.CartModel{{Id: "999", Item: "ghost", Price: 1, Sizing: "m", Quantity: 1}}}).
+		ExpectError(http.StatusBadRequest, "unknown_product")
+	s.Do("POST", "/order/create-order", token, &dto.OrderRequest{Total: 10, Snapshots: []*dto.CartModel{{Id: "shirt", Item: "ghost", Price: 1, Sizing: "m", Quantity: 1}}}).
+		ExpectError(http.StatusBadRequest, "invalid_product").ExpectFieldError("snapshots[0].id")
+}
+
+func TestCreateOrderWithAPIKey(t *testing.T) {
+	s := apptest.New(t)
+	alice, _ := s.NewCustomer("alice")
+	_, adminToken := s.NewAdmin("root")
+	placeKey := createAPIKey(t, s, adminToken, alice.ID, helpers.ScopeOrdersPlace)
+	readKey := createAPIKey(t, s, adminToken, alice.ID, helpers.ScopeOrdersOwn)
+	stockCart(t, s)
+
+	s.DoWithAPIKey("POST", "/order/create-order", placeKey, &dto.OrderRequest{Total: 10, Snapshots: cart}).ExpectSuccess()
+	s.DoWithAPIKey("POST", "/order/create-order", readKey, &dto.OrderRequest{Total: 10, Snapshots: cart}).ExpectFail("You do not have permission for this operation")
+
+	s.DoWithAPIKey("GET", "/order/list-orders-user", readKey, nil).ExpectSuccess()
+	s.DoWithAPIKey("GET", "/order/list-orders-user", placeKey, nil).ExpectFail("You do not have permission for this operation")
+}
+
+func TestListOrders(t *testing.T) {
+	s := apptest.New(t)
+	_, aliceToken := s.NewCustomer("alice")
+	_, bobToken := s.NewCustomer("bob")
+	_, supportToken := s.NewStaff("sam", helpers.RoleSupport)
+	_, catalogToken := s.NewStaff("cathy", helpers.RoleCatalogManager)
+
+	placeOrder(t, s, aliceToken)
+	placeOrder(t, s, aliceToken)
+	placeOrder(t, s, bobToken)
+
+	if orders := listOrders(t, s, "/order/list-orders-user", aliceToken); len(orders) != 2 {
+		t.Fatalf("expected 2 orders of alice, got %v", len(orders))
+	}
+	if orders := listOrders(t, s, "/order/list-orders-user", bobToken); len(orders) != 1 {
+		t.Fatalf("expected 1 order of bob, got %v", len(orders))
+	}
+	if orders := listOrders(t, s, "/order/list-orders", supportToken); len(orders) != 3 {
+		t.Fatalf("expected 3 orders, got %v", len(orders))
+	}
+	s.Do("GET", "/order/list-orders", catalogToken, nil).ExpectFail("You do not have permission for this operation")
+}
+
+func TestEditOrderStatus(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+	_, warehouseToken := s.NewStaff("walt", helpers.RoleWarehouse)
+	_, supportToken := s.NewStaff("sam", helpers.RoleSupport)
+	order := placeOrder(t, s, token)
+
+	edited := &dto.OrderResponse{}
+	s.Do("PATCH", "/order/edit-order-status", warehouseToken, &dto.EditOrderRequest{ID: order.ID, Status: "Shipped"}).ExpectSuccess().Decode(edited)
+	if edited.Status != "Shipped" || edited.Total != order.Total {
+		t.Fatalf("unexpected order %+v", edited)
+	}
+
+	//support may only cancel
+	s.Do("PATCH", "/order/edit-order-status", supportToken, &dto.EditOrderRequest{ID: order.ID, Status: "Delivered"}).
+		ExpectFail("You do not have permission for this operation")
+	s.Do("PATCH", "/order/edit-order-status", supportToken, &dto.EditOrderRequest{ID: order.ID, Status: models.OrderStatusCancelled}).ExpectSuccess()
+
+	s.Do("PATCH", "/order/edit-order-status", warehouseToken, &dto.EditOrderRequest{Status: "Shipped"}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("id")
+	s.Do("PATCH", "/order/edit-order-status", warehouseToken, &dto.EditOrderRequest{ID: 999, Status: "Shipped"}).ExpectError(http.StatusNotFound, "not_found")
+
+	entries := findAuditLogs(t, s, fmt.Sprintf("target_type=%v&target_id=%v", models.AuditTargetOrder, order.ID))
+	if len(entries) != 2 || entries[0].ActorUsername != "sam" || entries[1].ActorUsername != "walt" {
+		t.Fatalf("unexpected audit log %+v", entries)
+	}
+}
+
+func TestDeleteAndRestoreOrder(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+	_, adminToken := s.NewStaff("ada", helpers.RoleAdmin)
+	_, warehouseToken := s.NewStaff("walt", helpers.RoleWarehouse)
+	order := placeOrder(t, s, token)
+	path := fmt.Sprintf("?id=%v", order.ID)
+
+	s.Do("DELETE", "/order/delete-order"+path, warehouseToken, nil).ExpectFail("You do not have permission for this operation")
+	s.Do("DELETE", "/order/delete-order", adminToken, nil).ExpectFail("Url param key not exist")
+	s.Do("DELETE", "/order/delete-order?id=-1", adminToken, nil).ExpectError(http.StatusBadRequest, "invalid_parameter")
+	s.Do("DELETE", "/order/delete-order"+path, adminToken, nil).ExpectSuccess()
+	s.Do("DELETE", "/order/delete-order"+path, adminToken, nil).ExpectError(http.StatusNotFound, "not_found")
+
+	if orders := listOrders(t, s, "/order/list-orders-user", token); len(orders) != 0 {
+		t.Fatalf("a deleted order is still listed: %+v", orders)
+	}
+	trashed := listOrders(t, s, "/order/list-trashed-orders", adminToken)
+	if len(trashed) != 1 || trashed[0].ID != order.ID || trashed[0].DeletedAt == nil {
+		t.Fatalf("unexpected trash %+v", trashed)
+	}
+
+	s.Do("PATCH", "/order/restore-order", adminToken, nil).ExpectFail("Url param key not exist")
+	s.Do("PATCH", "/order/restore-order"+path, adminToken, nil).ExpectSuccess()
+	if orders := listOrders(t, s, "/order/list-orders-user", token); len(orders) != 1 {
+		t.Fatalf("expected the restored order, got %+v", orders)
+	}
+}
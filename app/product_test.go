@@ -0,0 +1,145 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"future-fashion/app/apptest"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+func createProduct(t *testing.T, s *apptest.Server, token, item string) *dto.ProductResponse {
+	t.Helper()
+	product := &dto.ProductResponse{}
+	s.Do("POST", "/product/create-product", token, &dto.ProductRequest{
+		Item:     item,
+		Price:    49.9,
+		Stock:    10,
+		Pictures: []string{"https://cdn.example.com/" + item + ".jpg"},
+		M:        &dto.Sizing{Chest: 96, Waist: 80, Hip: 100},
+	}).ExpectSuccess().Decode(product)
+	return product
+}
+
+func listProducts(t *testing.T, s *apptest.Server) []*dto.ProductResponse {
+	t.Helper()
+	products := &dto.ListProductsResponse{}
+	s.Do("GET", "/product/list-products", "", nil).ExpectSuccess().Decode(products)
+	return products.Products
+}
+
+func TestCreateProduct(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("cathy", helpers.RoleCatalogManager)
+	_, warehouseToken := s.NewStaff("walt", helpers.RoleWarehouse)
+
+	product := createProduct(t, s, token, "linen-shirt")
+	if product.Item != "linen-shirt" || len(product.Pictures) != 1 || product.M == nil || product.M.Chest != 96 || product.XS != nil {
+		t.Fatalf("unexpected product %+v", product)
+	}
+
+	s.Do("POST", "/product/create-product", token, &dto.ProductRequest{Item: "no-price"}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("price")
+	s.Do("POST", "/product/create-product", warehouseToken, &dto.ProductRequest{Item: "shirt", Price: 1}).
+		ExpectFail("You do not have permission for this operation")
+
+	entries := findAuditLogs(t, s, "action="+models.AuditActionProductCreate)
+	if len(entries) != 1 || entries[0].ActorUsername != "cathy" || entries[0].TargetID != fmt.Sprint(product.ID) {
+		t.Fatalf("unexpected audit log %+v", entries)
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+
+	if products := listProducts(t, s); len(products) != 0 {
+		t.Fatalf("expected no products, got %v", len(products))
+	}
+	createProduct(t, s, token, "linen-shirt")
+	createProduct(t, s, token, "wool-coat")
+
+	//the catalogue is public
+	products := listProducts(t, s)
+	if len(products) != 2 || products[0].Item != "linen-shirt" || products[1].Item != "wool-coat" {
+		t.Fatalf("unexpected products %+v", products)
+	}
+}
+
+func TestEditProduct(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("cathy", helpers.RoleCatalogManager)
+	product := createProduct(t, s, token, "linen-shirt")
+
+	edited := &dto.ProductResponse{}
+	s.Do("PATCH", "/product/edit-product", token, &dto.UpdateProductRequest{ID: product.ID, Price: 39.9}).ExpectSuccess().Decode(edited)
+	if edited.Price != 39.9 || edited.Item != "linen-shirt" {
+		t.Fatalf("unexpected product %+v", edited)
+	}
+	//fields left out are not changed
+	if len(edited.Pictures) != 1 || edited.M == nil || edited.M.Chest != 96 {
+		t.Fatalf("the edit cleared fields that were not sent: %+v", edited)
+	}
+
+	s.Do("PATCH", "/product/edit-product", token, &dto.UpdateProductRequest{ID: product.ID, L: &dto.Sizing{Chest: 104}}).ExpectSuccess().Decode(edited)
+	if edited.L == nil || edited.L.Chest != 104 || edited.M == nil {
+		t.Fatalf("unexpected product %+v", edited)
+	}
+
+	s.Do("PATCH", "/product/edit-product", token, &dto.UpdateProductRequest{Price: 1}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("id")
+	s.Do("PATCH", "/product/edit-product", token, &dto.UpdateProductRequest{ID: 999, Price: 1}).ExpectError(http.StatusNotFound, "not_found")
+}
+
+func TestDeleteAndRestoreProduct(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewStaff("cathy", helpers.RoleCatalogManager)
+	product := createProduct(t, s, token, "linen-shirt")
+	path := fmt.Sprintf("?id=%v", product.ID)
+
+	s.Do("DELETE", "/product/delete-product", token, nil).ExpectFail("Url param key not exist")
+	s.Do("DELETE", "/product/delete-product?id=abc", token, nil).ExpectError(http.StatusBadRequest, "invalid_parameter")
+	s.Do("DELETE", "/product/delete-product?id=999", token, nil).ExpectError(http.StatusNotFound, "not_found")
+	s.Do("DELETE", "/product/delete-product"+path, token, nil).ExpectSuccess()
+
+	if products := listProducts(t, s); len(products) != 0 {
+		t.Fatalf("a deleted product is still listed: %+v", products)
+	}
+	trashed := &dto.ListProductsResponse{}
+	s.Do("GET", "/product/list-trashed-products", token, nil).ExpectSuccess().Decode(trashed)
+	if len(trashed.Products) != 1 || trashed.Products[0].DeletedAt == nil {
+		t.Fatalf("unexpected trash %+v", trashed.Products)
+	}
+
+	s.Do("PATCH", "/product/restore-product", token, nil).ExpectFail("Url param key not exist")
+	s.Do("PATCH", "/product/restore-product"+path, token, nil).ExpectSuccess()
+	s.Do("PATCH", "/product/restore-product"+path, token, nil).ExpectError(http.StatusNotFound, "not_found")
+
+	if products := listProducts(t, s); len(products) != 1 {
+		t.Fatalf("expected the restored product, got %+v", products)
+	}
+}
+
+func TestProductAPIKey(t *testing.T) {
+	s := apptest.New(t)
+	cathy, token := s.NewStaff("cathy", helpers.RoleCatalogManager)
+	_, adminToken := s.NewAdmin("root")
+	key := createAPIKey(t, s, adminToken, cathy.ID, helpers.PermissionProductsWrite)
+
+	s.DoWithAPIKey("POST", "/product/create-product", key, &dto.ProductRequest{Item: "scarf", Price: 9.9}).ExpectSuccess()
+
+	entries := findAuditLogs(t, s, "action="+models.AuditActionProductCreate)
+	if len(entries) != 1 || !entries[0].ViaAPIKey {
+		t.Fatalf("expected the audit log to record the api key, got %+v", entries)
+	}
+
+	//keys stop working once revoked
+	keys := &dto.ListAPIKeysResponse{}
+	s.Do("GET", fmt.Sprintf("/admin/list-api-keys?user_id=%v", cathy.ID), adminToken, nil).ExpectSuccess().Decode(keys)
+	s.Do("DELETE", fmt.Sprintf("/admin/revoke-api-key?id=%v", keys.APIKeys[0].ID), adminToken, nil).ExpectSuccess()
+	s.DoWithAPIKey("POST", "/product/create-product", key, &dto.ProductRequest{Item: "scarf", Price: 9.9}).ExpectFail("api key is revoked")
+
+	//the jwt of the owner is not affected
+	createProduct(t, s, token, "hat")
+}
@@ -0,0 +1,43 @@
+package app_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"future-fashion/app/apptest"
+	"future-fashion/config"
+)
+
+func newRateLimitedServer(t *testing.T) *apptest.Server {
+	return apptest.New(t, func(cfg *config.Config) {
+		cfg.RateLimit.Enabled = true
+		cfg.RateLimit.Default = config.RouteLimit{Requests: 3, Per: time.Minute, KeyBy: "user"}
+	})
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	s := newRateLimitedServer(t)
+	_, alice := s.NewCustomer("alice")
+	_, bob := s.NewCustomer("bob")
+
+	for i := 0; i < 3; i++ {
+		s.Do("GET", "/user/personal-info", alice, nil).ExpectSuccess()
+	}
+	res := s.Do("GET", "/user/personal-info", alice, nil).ExpectError(http.StatusTooManyRequests, "rate_limited")
+	if res.Header.Get("Retry-After") == "" {
+		t.Fatal("no Retry-After on a limited request")
+	}
+	//same address, another user
+	s.Do("GET", "/user/personal-info", bob, nil).ExpectSuccess()
+}
+
+func TestRateLimitRefusedAPIKeys(t *testing.T) {
+	s := newRateLimitedServer(t)
+
+	//every made up key gets a bucket of its own, the refusals are counted by IP
+	for _, key := range []string{"ffk_a_1", "ffk_b_2", "ffk_c_3"} {
+		s.DoWithAPIKey("GET", "/user/personal-info", key, nil).ExpectError(http.StatusUnauthorized, "invalid_api_key")
+	}
+	s.DoWithAPIKey("GET", "/user/personal-info", "ffk_d_4", nil).ExpectError(http.StatusTooManyRequests, "rate_limited")
+}
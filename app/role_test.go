@@ -0,0 +1,146 @@
+package app_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"future-fashion/app/apptest"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+)
+
+func TestListRoles(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	_, adminToken := s.NewStaff("ada", helpers.RoleAdmin)
+
+	roles := &dto.ListRolesResponse{}
+	s.Do("GET", "/admin/list-roles", token, nil).ExpectSuccess().Decode(roles)
+	builtin := map[string]bool{}
+	for _, role := range roles.Roles {
+		builtin[role.Name] = role.Builtin
+	}
+	for _, name := range []string{helpers.RoleSuperAdmin, helpers.RoleAdmin, helpers.RoleWarehouse, helpers.RoleCatalogManager, helpers.RoleSupport, helpers.RoleCustomer} {
+		if !builtin[name] {
+			t.Fatalf("expected the built-in role %v, got %+v", name, roles.Roles)
+		}
+	}
+
+	//managing roles is left to super-admins
+	s.Do("GET", "/admin/list-roles", adminToken, nil).ExpectFail("You do not have permission for this operation")
+}
+
+func TestCreateAndEditRole(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+
+	role := &dto.RoleResponse{}
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{
+		Name:        "auditor",
+		Description: "reads the audit log",
+		Permissions: []string{helpers.PermissionAuditRead},
+	}).ExpectSuccess().Decode(role)
+	if role.Builtin || len(role.Permissions) != 1 {
+		t.Fatalf("unexpected role %+v", role)
+	}
+
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{Name: "Auditors!"}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("name")
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{Name: "hacker", Permissions: []string{"root:everything"}}).ExpectFail("Unknown permission root:everything")
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{Name: "auditor"}).ExpectError(http.StatusConflict, "duplicate")
+
+	s.Do("PATCH", "/admin/edit-role", token, &dto.RoleRequest{
+		ID:          role.ID,
+		Permissions: []string{helpers.PermissionAuditRead, helpers.PermissionCustomersRead},
+	}).ExpectSuccess().Decode(role)
+	if len(role.Permissions) != 2 || role.Description != "reads the audit log" {
+		t.Fatalf("unexpected role %+v", role)
+	}
+
+	s.Do("PATCH", "/admin/edit-role", token, &dto.RoleRequest{Description: "x"}).ExpectError(http.StatusBadRequest, "missing_id")
+	s.Do("PATCH", "/admin/edit-role", token, &dto.RoleRequest{ID: 999, Description: "x"}).ExpectError(http.StatusNotFound, "not_found")
+	s.Do("PATCH", "/admin/edit-role", token, &dto.RoleRequest{ID: role.ID, Permissions: []string{"nope"}}).ExpectFail("Unknown permission nope")
+
+	//built-in roles keep their permissions, signups get customer and super-admin manages roles
+	roles := &dto.ListRolesResponse{}
+	s.Do("GET", "/admin/list-roles", token, nil).ExpectSuccess().Decode(roles)
+	for _, builtin := range roles.Roles {
+		if !builtin.Builtin {
+			continue
+		}
+		s.Do("PATCH", "/admin/edit-role", token, &dto.RoleRequest{ID: builtin.ID, Permissions: []string{helpers.PermissionCustomersWrite}}).
+			ExpectError(http.StatusForbidden, "builtin_role")
+	}
+	s.Do("GET", "/admin/list-roles", token, nil).ExpectSuccess()
+
+	//a user with the new role may use the back office with its permissions
+	s.CreateUser("audrey", "auditor")
+	s.Do("GET", "/admin/audit-logs", s.LoginAdmin("audrey"), nil).ExpectSuccess()
+}
+
+func TestDeleteRole(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+
+	role := &dto.RoleResponse{}
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{Name: "auditor", Permissions: []string{helpers.PermissionAuditRead}}).ExpectSuccess().Decode(role)
+	audrey := s.CreateUser("audrey", "auditor")
+
+	roles := &dto.ListRolesResponse{}
+	s.Do("GET", "/admin/list-roles", token, nil).ExpectSuccess().Decode(roles)
+	for _, builtin := range roles.Roles {
+		if builtin.Builtin {
+			s.Do("DELETE", fmt.Sprintf("/admin/delete-role?id=%v", builtin.ID), token, nil).ExpectFail("built-in roles cannot be deleted")
+			break
+		}
+	}
+
+	path := fmt.Sprintf("/admin/delete-role?id=%v", role.ID)
+	s.Do("DELETE", path, token, nil).ExpectFail("role is still assigned to users")
+	s.Do("PATCH", "/admin/assign-role", token, &dto.AssignRoleRequest{UserID: audrey.ID, Role: helpers.RoleSupport}).ExpectSuccess()
+	s.Do("DELETE", path, token, nil).ExpectSuccess()
+	s.Do("DELETE", path, token, nil).ExpectError(http.StatusNotFound, "not_found")
+
+	s.Do("DELETE", "/admin/delete-role", token, nil).ExpectFail("Url param key not exist")
+	s.Do("DELETE", "/admin/delete-role?id=auditor", token, nil).ExpectError(http.StatusBadRequest, "invalid_parameter")
+}
+
+func TestAssignRole(t *testing.T) {
+	s := apptest.New(t)
+	root, token := s.NewAdmin("root")
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+
+	user := &dto.UserResponse{}
+	s.Do("PATCH", "/admin/assign-role", token, &dto.AssignRoleRequest{UserID: alice.ID, Role: helpers.RoleWarehouse}).ExpectSuccess().Decode(user)
+	if user.Role != helpers.RoleWarehouse {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	//staff leave the customer login for the admin login
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: apptest.Password}).ExpectFail("Invalid username or password")
+	s.Do("GET", "/order/list-orders", s.LoginAdmin("alice"), nil).ExpectSuccess()
+
+	s.Do("PATCH", "/admin/assign-role", token, &dto.AssignRoleRequest{UserID: alice.ID}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("role")
+	s.Do("PATCH", "/admin/assign-role", token, &dto.AssignRoleRequest{UserID: alice.ID, Role: "wizard"}).ExpectFail("Role wizard does not exist")
+	s.Do("PATCH", "/admin/assign-role", token, &dto.AssignRoleRequest{UserID: root.ID, Role: helpers.RoleCustomer}).ExpectFail("You cannot change your own role")
+	s.Do("PATCH", "/admin/assign-role", token, &dto.AssignRoleRequest{UserID: 999, Role: helpers.RoleCustomer}).ExpectError(http.StatusNotFound, "not_found")
+}
+
+func TestRoleChangesApplyToIssuedTokens(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+
+	role := &dto.RoleResponse{}
+	s.Do("POST", "/admin/create-role", token, &dto.RoleRequest{Name: "auditor", Permissions: []string{helpers.PermissionAuditRead, helpers.PermissionCustomersRead}}).ExpectSuccess().Decode(role)
+	audrey := s.CreateUser("audrey", "auditor")
+	audreyToken := s.LoginAdmin("audrey")
+	s.Do("GET", "/admin/list-customers", audreyToken, nil).ExpectSuccess()
+
+	//a permission taken from the role is gone on the next request
+	s.Do("PATCH", "/admin/edit-role", token, &dto.RoleRequest{ID: role.ID, Permissions: []string{helpers.PermissionAuditRead}}).ExpectSuccess()
+	s.Do("GET", "/admin/list-customers", audreyToken, nil).ExpectFail("You do not have permission for this operation")
+	s.Do("GET", "/admin/audit-logs", audreyToken, nil).ExpectSuccess()
+
+	//and so is a role taken from the user
+	s.Do("PATCH", "/admin/assign-role", token, &dto.AssignRoleRequest{UserID: audrey.ID, Role: helpers.RoleCustomer}).ExpectSuccess()
+	s.Do("GET", "/admin/audit-logs", audreyToken, nil).ExpectFail("You do not have permission for this operation")
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"github.com/gorilla/mux"
+
+	"future-fashion/handlers"
+)
+
+func newRouter(userHandler *handlers.UserHandler, adminHandler *handlers.AdminHandler, productHandler *handlers.ProductHandler, orderHandler *handlers.OrderHandler) *mux.Router {
+	r := mux.NewRouter()
+	//User Handlers
+	r.HandleFunc("/user/signup", userHandler.SignUp).Methods("POST")
+	r.HandleFunc("/user/login", userHandler.Login).Methods("POST")
+	r.HandleFunc("/user/edit-personal-info", userHandler.EditPersonalInfo).Methods("PATCH")
+	r.HandleFunc("/user/personal-info", userHandler.GetPersonalInfo).Methods("GET")
+	r.HandleFunc("/user/verify-email", userHandler.VerifyEmail).Methods("GET")
+	r.HandleFunc("/user/resend-verification", userHandler.ResendVerification).Methods("POST")
+	r.HandleFunc("/user/oidc/login", userHandler.OIDCLogin).Methods("GET")
+	r.HandleFunc("/user/export-data", userHandler.ExportData).Methods("GET")
+	r.HandleFunc("/user/erase-account", userHandler.EraseAccount).Methods("POST")
+	r.HandleFunc("/user/oidc/callback", userHandler.OIDCCallback).Methods("GET", "POST")
+
+	//Admin Handlers
+	r.HandleFunc("/admin/create-customer", adminHandler.CreateCustomer).Methods("POST")
+	r.HandleFunc("/admin/delete-customer", adminHandler.DeleteCustomer).Methods("DELETE")
+	r.HandleFunc("/admin/list-customers", adminHandler.ListCustomers).Methods("GET")
+	r.HandleFunc("/admin/get-customer-info", adminHandler.GetCustomerInfo).Methods("GET")
+	r.HandleFunc("/admin/edit-customer", adminHandler.EditCustomer).Methods("PATCH")
+	r.HandleFunc("/admin/login", adminHandler.AdminLogin).Methods("POST")
+	r.HandleFunc("/admin/unlock-account", adminHandler.UnlockAccount).Methods("PATCH")
+	r.HandleFunc("/admin/list-lockout-events", adminHandler.ListLockoutEvents).Methods("GET")
+	r.HandleFunc("/admin/login/verify-2fa", adminHandler.VerifyTwoFactorLogin).Methods("POST")
+	r.HandleFunc("/admin/2fa/enroll", adminHandler.EnrollTwoFactor).Methods("POST")
+	r.HandleFunc("/admin/2fa/confirm", adminHandler.ConfirmTwoFactor).Methods("POST")
+	r.HandleFunc("/admin/2fa/recovery-codes", adminHandler.RegenerateRecoveryCodes).Methods("POST")
+	r.HandleFunc("/admin/2fa/disable", adminHandler.DisableTwoFactor).Methods("POST")
+	r.HandleFunc("/admin/list-roles", adminHandler.ListRoles).Methods("GET")
+	r.HandleFunc("/admin/create-role", adminHandler.CreateRole).Methods("POST")
+	r.HandleFunc("/admin/edit-role", adminHandler.EditRole).Methods("PATCH")
+	r.HandleFunc("/admin/delete-role", adminHandler.DeleteRole).Methods("DELETE")
+	r.HandleFunc("/admin/assign-role", adminHandler.AssignRole).Methods("PATCH")
+	r.HandleFunc("/admin/create-api-key", adminHandler.CreateAPIKey).Methods("POST")
+	r.HandleFunc("/admin/list-api-keys", adminHandler.ListAPIKeys).Methods("GET")
+	r.HandleFunc("/admin/revoke-api-key", adminHandler.RevokeAPIKey).Methods("DELETE")
+	r.HandleFunc("/admin/audit-logs", adminHandler.ListAuditLogs).Methods("GET")
+	r.HandleFunc("/admin/list-trashed-customers", adminHandler.ListTrashedCustomers).Methods("GET")
+	r.HandleFunc("/admin/restore-customer", adminHandler.RestoreCustomer).Methods("PATCH")
+
+	//Product Handlers
+	r.HandleFunc("/product/create-product", productHandler.CreateProduct).Methods("POST")
+	r.HandleFunc("/product/delete-product", productHandler.DeleteProduct).Methods("DELETE")
+	r.HandleFunc("/product/list-products", productHandler.ListProducts).Methods("GET")
+	r.HandleFunc("/product/edit-product", productHandler.EditProduct).Methods("PATCH")
+	r.HandleFunc("/product/list-trashed-products", productHandler.ListTrashedProducts).Methods("GET")
+	r.HandleFunc("/product/restore-product", productHandler.RestoreProduct).Methods("PATCH")
+
+	//Order Handlers
+	r.HandleFunc("/order/create-order", orderHandler.CreateOrder).Methods("POST")
+	r.HandleFunc("/order/delete-order", orderHandler.DeleteOrder).Methods("DELETE")
+	r.HandleFunc("/order/edit-order-status", orderHandler.EditOrderStatus).Methods("PATCH")
+	r.HandleFunc("/order/list-orders", orderHandler.ListOrders).Methods("GET")
+	r.HandleFunc("/order/list-orders-user", orderHandler.ListOrdersByUserID).Methods("GET")
+	r.HandleFunc("/order/list-trashed-orders", orderHandler.ListTrashedOrders).Methods("GET")
+	r.HandleFunc("/order/restore-order", orderHandler.RestoreOrder).Methods("PATCH")
+
+	return r
+}
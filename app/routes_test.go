@@ -0,0 +1,249 @@
+package app_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"future-fashion/app/apptest"
+	"future-fashion/helpers"
+)
+
+const (
+	//anyone may call the route
+	accessPublic = iota
+	//any logged in user
+	accessUser
+	//customers only
+	accessCustomer
+	//back office accounts only
+	accessStaff
+	//the challenge token of a two-factor login
+	accessChallenge
+)
+
+type route struct {
+	method string
+	path   string
+	access int
+	//the route decodes a json body
+	json bool
+}
+
+// routes lists every route of the api, a new route should be added here too
+var routes = []route{
+	{"POST", "/user/signup", accessPublic, true},
+	{"POST", "/user/login", accessPublic, true},
+	{"PATCH", "/user/edit-personal-info", accessUser, true},
+	{"GET", "/user/personal-info", accessUser, false},
+	{"GET", "/user/verify-email", accessPublic, false},
+	{"POST", "/user/resend-verification", accessUser, false},
+	{"GET", "/user/oidc/login", accessPublic, false},
+	{"GET", "/user/export-data", accessUser, false},
+	{"POST", "/user/erase-account", accessCustomer, true},
+	{"GET", "/user/oidc/callback", accessPublic, false},
+	{"POST", "/user/oidc/callback", accessPublic, false},
+
+	{"POST", "/admin/create-customer", accessStaff, true},
+	{"DELETE", "/admin/delete-customer", accessStaff, false},
+	{"GET", "/admin/list-customers", accessStaff, false},
+	{"GET", "/admin/get-customer-info", accessStaff, false},
+	{"PATCH", "/admin/edit-customer", accessStaff, true},
+	{"POST", "/admin/login", accessPublic, true},
+	{"PATCH", "/admin/unlock-account", accessStaff, true},
+	{"GET", "/admin/list-lockout-events", accessStaff, false},
+	{"POST", "/admin/login/verify-2fa", accessChallenge, true},
+	{"POST", "/admin/2fa/enroll", accessStaff, false},
+	{"POST", "/admin/2fa/confirm", accessStaff, true},
+	{"POST", "/admin/2fa/recovery-codes", accessStaff, true},
+	{"POST", "/admin/2fa/disable", accessStaff, true},
+	{"GET", "/admin/list-roles", accessStaff, false},
+	{"POST", "/admin/create-role", accessStaff, true},
+	{"PATCH", "/admin/edit-role", accessStaff, true},
+	{"DELETE", "/admin/delete-role", accessStaff, false},
+	{"PATCH", "/admin/assign-role", accessStaff, true},
+	{"POST", "/admin/create-api-key", accessStaff, true},
+	{"GET", "/admin/list-api-keys", accessStaff, false},
+	{"DELETE", "/admin/revoke-api-key", accessStaff, false},
+	{"GET", "/admin/audit-logs", accessStaff, false},
+	{"GET", "/admin/list-trashed-customers", accessStaff, false},
+	{"PATCH", "/admin/restore-customer", accessStaff, false},
+
+	{"POST", "/product/create-product", accessStaff, true},
+	{"DELETE", "/product/delete-product", accessStaff, false},
+	{"GET", "/product/list-products", accessPublic, false},
+	{"PATCH", "/product/edit-product", accessStaff, true},
+	{"GET", "/product/list-trashed-products", accessStaff, false},
+	{"PATCH", "/product/restore-product", accessStaff, false},
+
+	{"POST", "/order/create-order", accessUser, true},
+	{"DELETE", "/order/delete-order", accessStaff, false},
+	{"PATCH", "/order/edit-order-status", accessStaff, true},
+	{"GET", "/order/list-orders", accessStaff, false},
+	{"GET", "/order/list-orders-user", accessUser, false},
+	{"GET", "/order/list-trashed-orders", accessStaff, false},
+	{"PATCH", "/order/restore-order", accessStaff, false},
+}
+
+func (r route) String() string {
+	return r.method + " " + r.path
+}
+
+func newToken(t *testing.T, s *apptest.Server, claims *helpers.Claims) string {
+	t.Helper()
+	token, err := claims.CreateToken(s.TokenKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRoutesRejectMissingToken(t *testing.T) {
+	s := apptest.New(t)
+	for _, r := range routes {
+		if r.access == accessPublic {
+			continue
+		}
+		t.Run(r.String(), func(t *testing.T) {
+			s.Do(r.method, r.path, "", nil).ExpectError(http.StatusUnauthorized, "missing_token")
+		})
+	}
+}
+
+func TestRoutesRejectInvalidToken(t *testing.T) {
+	s := apptest.New(t)
+	customer := s.CreateUser("alice", helpers.RoleCustomer)
+
+	expired := helpers.NewClaim(customer.ID, customer.Username, customer.Role, nil)
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	otherKey, err := helpers.NewClaim(customer.ID, customer.Username, customer.Role, nil).CreateToken("not-the-token-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizations := map[string]string{
+		"garbage":       "Bearer not-a-jwt",
+		"other key":     "Bearer " + otherKey,
+		"expired":       "Bearer " + newToken(t, s, expired),
+		"other scheme":  "Basic YWxpY2U6c2VjcmV0",
+		"missing space": "Bearer" + newToken(t, s, helpers.NewClaim(customer.ID, customer.Username, customer.Role, nil)),
+	}
+
+	for _, r := range routes {
+		if r.access == accessPublic {
+			continue
+		}
+		for name, authorization := range authorizations {
+			t.Run(r.String()+"/"+name, func(t *testing.T) {
+				res := s.Request(r.method, r.path, nil, http.Header{"Authorization": {authorization}})
+				res.ExpectError(http.StatusUnauthorized, "invalid_token")
+			})
+		}
+	}
+}
+
+func TestRoutesRejectChallengeToken(t *testing.T) {
+	s := apptest.New(t)
+	admin := s.CreateUser("root", helpers.RoleSuperAdmin)
+	challenge := newToken(t, s, helpers.NewScopedClaim(admin.ID, admin.Username, admin.Role, helpers.ScopeTwoFactorVerify, time.Minute))
+
+	for _, r := range routes {
+		if r.access == accessPublic || r.access == accessChallenge {
+			continue
+		}
+		t.Run(r.String(), func(t *testing.T) {
+			s.Do(r.method, r.path, challenge, nil).ExpectError(http.StatusUnauthorized, "wrong_token_scope")
+		})
+	}
+
+	//and the challenge route takes nothing but a challenge token
+	token := s.LoginAdmin("root")
+	s.Do("POST", "/admin/login/verify-2fa", token, map[string]string{"code": "000000"}).ExpectError(http.StatusUnauthorized, "wrong_token_scope")
+}
+
+func TestStaffRoutesRejectCustomers(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+
+	for _, r := range routes {
+		if r.access != accessStaff {
+			continue
+		}
+		t.Run(r.String(), func(t *testing.T) {
+			res := s.Do(r.method, r.path, token, nil)
+			if res.ErrorCode != "staff_only" {
+				res.ExpectError(http.StatusForbidden, "permission_denied")
+			}
+		})
+	}
+}
+
+func TestCustomerRoutesRejectStaff(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+
+	for _, r := range routes {
+		if r.access != accessCustomer {
+			continue
+		}
+		t.Run(r.String(), func(t *testing.T) {
+			s.Do(r.method, r.path, token, map[string]string{"password": apptest.Password}).ExpectError(http.StatusForbidden, "permission_denied")
+		})
+	}
+}
+
+func TestRoutesRejectMalformedJSON(t *testing.T) {
+	s := apptest.New(t)
+	admin, adminToken := s.NewAdmin("root")
+	_, customerToken := s.NewCustomer("alice")
+	challenge := newToken(t, s, helpers.NewScopedClaim(admin.ID, admin.Username, admin.Role, helpers.ScopeTwoFactorVerify, time.Minute))
+
+	bodies := map[string]string{
+		"empty":         "",
+		"truncated":     `{"username":`,
+		"not json":      `username=alice`,
+		"array":         `[]`,
+		"unknown field": `{"role":"super-admin"}`,
+		"two objects":   `{} {}`,
+		"wrong type":    `{"id":"1","user_id":"1","username":1,"item":1,"total":"1","code":1,"password":1}`,
+	}
+
+	for _, r := range routes {
+		if !r.json {
+			continue
+		}
+
+		token := ""
+		switch r.access {
+		case accessUser, accessCustomer:
+			token = customerToken
+		case accessStaff:
+			token = adminToken
+		case accessChallenge:
+			token = challenge
+		}
+
+		for name, body := range bodies {
+			t.Run(r.String()+"/"+name, func(t *testing.T) {
+				res := s.Do(r.method, r.path, token, body).ExpectFail("NOTE: ")
+				if res.Code != http.StatusBadRequest {
+					t.Fatalf("expected 400, got %v %v", res.Code, res.ErrorCode)
+				}
+			})
+		}
+	}
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	s := apptest.New(t)
+
+	res := s.Do("GET", "/user/does-not-exist", "", nil)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %v", res.Code)
+	}
+
+	res = s.Do("DELETE", "/product/list-products", "", nil)
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %v", res.Code)
+	}
+}
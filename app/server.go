@@ -0,0 +1,51 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"future-fashion/config"
+)
+
+// Serve runs the api on listener until ctx is done, then stops taking new connections and
+// waits up to the shutdown timeout for the requests in flight. It returns nil after a clean
+// shutdown ...
+func (app *App) Serve(ctx context.Context, listener net.Listener, cfg config.ServerConfig) error {
+	server := &http.Server{
+		Handler:           app.Handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	atomic.StoreInt32(&app.draining, 1)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		//the timeout ran out, cut the remaining connections
+		server.Close()
+		return err
+	}
+
+	err = <-served
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
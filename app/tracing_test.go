@@ -0,0 +1,129 @@
+package app_test
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"future-fashion/app/apptest"
+	"future-fashion/config"
+	"future-fashion/dto"
+)
+
+type collectedSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Attributes   map[string]string
+}
+
+func (s *collectedSpan) attribute(key string) string {
+	return s.Attributes[key]
+}
+
+// collector is an OTLP/HTTP receiver that keeps the spans posted to it
+type collector struct {
+	mu    sync.Mutex
+	spans []*collectedSpan
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	request := &coltracepb.ExportTraceServiceRequest{}
+	if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" || proto.Unmarshal(body, request) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				collected := &collectedSpan{
+					TraceID:      hex.EncodeToString(span.TraceId),
+					SpanID:       hex.EncodeToString(span.SpanId),
+					ParentSpanID: hex.EncodeToString(span.ParentSpanId),
+					Name:         span.Name,
+					Attributes:   map[string]string{},
+				}
+				for _, attribute := range span.Attributes {
+					collected.Attributes[attribute.Key] = attribute.Value.GetStringValue()
+				}
+				c.spans = append(c.spans, collected)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+}
+
+func (c *collector) find(traceID, name string) *collectedSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.TraceID == traceID && span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	spans := &collector{}
+	otlp := httptest.NewServer(spans)
+	defer otlp.Close()
+
+	s := apptest.New(t, func(cfg *config.Config) {
+		cfg.Tracing.Exporter = "otlp"
+		cfg.Tracing.Endpoint = otlp.URL + "/v1/traces"
+	})
+	_, token := s.NewCustomer("alice")
+
+	stockCart(t, s)
+
+	//the caller's trace is continued
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	callerSpanID := "00f067aa0ba902b7"
+	s.Request("POST", "/order/create-order", &dto.OrderRequest{Total: 99.8, Snapshots: cart}, http.Header{
+		"Authorization": {"Bearer " + token},
+		"Traceparent":   {"00-" + traceID + "-" + callerSpanID + "-01"},
+	}).ExpectSuccess()
+	s.Do("GET", "/healthz", "", nil).ExpectSuccess()
+	//flushes the spans
+	s.App.Close()
+
+	server := spans.find(traceID, "POST /order/create-order")
+	if server == nil {
+		t.Fatalf("no span for the request in %+v", spans.spans)
+	}
+	if server.ParentSpanID != callerSpanID || server.attribute("http.route") != "/order/create-order" {
+		t.Fatalf("unexpected request span %+v", server)
+	}
+
+	for _, name := range []string{"verify caller", "SELECT credentials", "INSERT orders"} {
+		span := spans.find(traceID, name)
+		if span == nil {
+			t.Fatalf("no %q span", name)
+		}
+		if span.ParentSpanID != server.SpanID {
+			t.Fatalf("%q is not a child of the request span: %+v", name, span)
+		}
+	}
+	if statement := spans.find(traceID, "INSERT orders").attribute("db.statement"); statement == "" {
+		t.Fatal("the insert span has no statement")
+	}
+
+	//probes are not traced
+	for _, span := range spans.spans {
+		if span.attribute("http.target") == "/healthz" {
+			t.Fatalf("the health check was traced: %+v", span)
+		}
+	}
+}
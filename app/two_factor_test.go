@@ -0,0 +1,212 @@
+package app_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"future-fashion/app/apptest"
+	"future-fashion/config"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+// totpCode returns the code of the secret offset steps away from now
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := helpers.TOTPCode(secret, helpers.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// enrollTwoFactor enrolls the owner of the token and returns the secret and recovery codes,
+// the enrolment uses the previous step so the current and next one are left for logins
+func enrollTwoFactor(t *testing.T, s *apptest.Server, token string) (string, []string) {
+	t.Helper()
+	enrollment := &dto.TwoFactorEnrollResponse{}
+	s.Do("POST", "/admin/2fa/enroll", token, nil).ExpectSuccess().Decode(enrollment)
+	confirmation := &dto.TwoFactorConfirmResponse{}
+	s.Do("POST", "/admin/2fa/confirm", token, &dto.TwoFactorCodeRequest{Code: totpCode(t, enrollment.Secret, -1)}).
+		ExpectSuccess().Decode(confirmation)
+	return enrollment.Secret, confirmation.RecoveryCodes
+}
+
+// adminChallenge logs in through /admin/login and returns the two-factor challenge
+func adminChallenge(t *testing.T, s *apptest.Server, username string) *dto.TwoFactorLoginResponse {
+	t.Helper()
+	challenge := &dto.TwoFactorLoginResponse{}
+	s.Do("POST", "/admin/login", "", &dto.LoginRequest{Username: username, Password: apptest.Password}).
+		ExpectSuccess().Decode(challenge)
+	return challenge
+}
+
+func TestEnrollTwoFactor(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	_, customerToken := s.NewCustomer("alice")
+
+	s.Do("POST", "/admin/2fa/enroll", customerToken, nil).ExpectFail("Only staff accounts can use two-factor authentication")
+	s.Do("POST", "/admin/2fa/confirm", token, &dto.TwoFactorCodeRequest{Code: "123456"}).ExpectFail("Please start the two-factor enrolment first")
+
+	enrollment := &dto.TwoFactorEnrollResponse{}
+	s.Do("POST", "/admin/2fa/enroll", token, nil).ExpectSuccess().Decode(enrollment)
+	if enrollment.Secret == "" || enrollment.OTPAuthURI == "" {
+		t.Fatalf("unexpected enrolment %+v", enrollment)
+	}
+	s.Do("POST", "/admin/2fa/confirm", token, &dto.TwoFactorCodeRequest{Code: "000000x"}).ExpectFail("Invalid two-factor code")
+	s.Do("POST", "/admin/2fa/confirm", token, &dto.TwoFactorCodeRequest{Code: totpCode(t, enrollment.Secret, -5)}).ExpectFail("Invalid two-factor code")
+
+	confirmation := &dto.TwoFactorConfirmResponse{}
+	s.Do("POST", "/admin/2fa/confirm", token, &dto.TwoFactorCodeRequest{Code: totpCode(t, enrollment.Secret, 0)}).
+		ExpectSuccess().Decode(confirmation)
+	if len(confirmation.RecoveryCodes) != 10 || confirmation.Token != "" {
+		t.Fatalf("unexpected confirmation %+v", confirmation)
+	}
+
+	s.Do("POST", "/admin/2fa/enroll", token, nil).ExpectFail("Two-factor authentication is already enabled")
+	s.Do("GET", "/admin/list-customers", token, nil).ExpectSuccess()
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	secret, recoveryCodes := enrollTwoFactor(t, s, token)
+
+	challenge := adminChallenge(t, s, "root")
+	if !challenge.TwoFactorRequired || challenge.TwoFactorSetupRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+	//the challenge token is not a login
+	s.Do("GET", "/admin/list-customers", challenge.ChallengeToken, nil).ExpectFail("token is not valid for this operation")
+	s.Do("POST", "/admin/login/verify-2fa", token, &dto.TwoFactorCodeRequest{Code: totpCode(t, secret, 0)}).
+		ExpectFail("token is not valid for this operation")
+
+	//the step used to confirm the enrolment cannot be replayed
+	s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{Code: totpCode(t, secret, -1)}).
+		ExpectFail("Invalid two-factor code")
+	s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{}).
+		ExpectFail("Invalid two-factor code")
+
+	loginToken := s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{Code: totpCode(t, secret, 0)}).Token()
+	s.Do("GET", "/admin/list-customers", loginToken, nil).ExpectSuccess()
+	s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{Code: totpCode(t, secret, 0)}).
+		ExpectFail("Invalid two-factor code")
+
+	//recovery codes work once, with or without the dash
+	recoveryCode := recoveryCodes[0]
+	s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{RecoveryCode: recoveryCode}).Token()
+	s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{RecoveryCode: recoveryCode}).
+		ExpectFail("Invalid two-factor code")
+}
+
+func TestConcurrentTwoFactorCodesAreUsedOnce(t *testing.T) {
+	s := apptest.New(t)
+	user, token := s.NewAdmin("root")
+	enrollTwoFactor(t, s, token)
+	twoFactor := &models.TwoFactorOperationsImpl{
+		DB:     s.DB,
+		Logger: zap.NewNop().Sugar(),
+	}
+
+	//logins with the same code fired at once
+	const logins = 20
+	step := helpers.TOTPStep(time.Now())
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	used := make(chan bool, logins)
+	for i := 0; i < logins; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ok, err := twoFactor.UseStep(user.ID, step)
+			if err != nil {
+				t.Error(err)
+			}
+			used <- ok
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(used)
+
+	accepted := 0
+	for ok := range used {
+		if ok {
+			accepted++
+		}
+	}
+	if accepted != 1 {
+		t.Fatalf("the code was accepted %v times", accepted)
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	secret, recoveryCodes := enrollTwoFactor(t, s, token)
+
+	s.Do("POST", "/admin/2fa/recovery-codes", token, &dto.TwoFactorCodeRequest{RecoveryCode: recoveryCodes[0]}).
+		ExpectFail("Invalid two-factor code")
+
+	renewed := &dto.TwoFactorConfirmResponse{}
+	s.Do("POST", "/admin/2fa/recovery-codes", token, &dto.TwoFactorCodeRequest{Code: totpCode(t, secret, 0)}).
+		ExpectSuccess().Decode(renewed)
+	if len(renewed.RecoveryCodes) != 10 {
+		t.Fatalf("unexpected recovery codes %+v", renewed)
+	}
+
+	challenge := adminChallenge(t, s, "root")
+	s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{RecoveryCode: recoveryCodes[1]}).
+		ExpectFail("Invalid two-factor code")
+	s.Do("POST", "/admin/login/verify-2fa", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{RecoveryCode: renewed.RecoveryCodes[1]}).Token()
+}
+
+func TestDisableTwoFactor(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewAdmin("root")
+	_, recoveryCodes := enrollTwoFactor(t, s, token)
+
+	s.Do("POST", "/admin/2fa/disable", token, &dto.TwoFactorCodeRequest{RecoveryCode: "nope"}).ExpectFail("Invalid two-factor code")
+	s.Do("POST", "/admin/2fa/disable", token, &dto.TwoFactorCodeRequest{RecoveryCode: recoveryCodes[0]}).ExpectSuccess()
+	s.Do("POST", "/admin/2fa/disable", token, &dto.TwoFactorCodeRequest{RecoveryCode: recoveryCodes[1]}).
+		ExpectFail("Two-factor authentication is not enabled")
+
+	//without two-factor authentication the password is enough again
+	s.LoginAdmin("root")
+}
+
+func TestRequiredTwoFactor(t *testing.T) {
+	s := apptest.New(t, func(cfg *config.Config) {
+		cfg.Auth.RequireAdmin2FA = true
+	})
+	s.CreateUser("root", helpers.RoleSuperAdmin)
+	s.CreateUser("alice", helpers.RoleCustomer)
+
+	//customers are not affected
+	s.LoginCustomer("alice")
+
+	challenge := adminChallenge(t, s, "root")
+	if challenge.TwoFactorRequired || !challenge.TwoFactorSetupRequired {
+		t.Fatalf("unexpected challenge %+v", challenge)
+	}
+	s.Do("GET", "/admin/list-customers", challenge.ChallengeToken, nil).ExpectFail("token is not valid for this operation")
+
+	enrollment := &dto.TwoFactorEnrollResponse{}
+	s.Do("POST", "/admin/2fa/enroll", challenge.ChallengeToken, nil).ExpectSuccess().Decode(enrollment)
+	confirmation := &dto.TwoFactorConfirmResponse{}
+	s.Do("POST", "/admin/2fa/confirm", challenge.ChallengeToken, &dto.TwoFactorCodeRequest{Code: totpCode(t, enrollment.Secret, 0)}).
+		ExpectSuccess().Decode(confirmation)
+	if confirmation.Token == "" {
+		t.Fatal("expected the forced enrolment to finish the login")
+	}
+	s.Do("GET", "/admin/list-customers", confirmation.Token, nil).ExpectSuccess()
+
+	s.Do("POST", "/admin/2fa/disable", confirmation.Token, &dto.TwoFactorCodeRequest{RecoveryCode: confirmation.RecoveryCodes[0]}).
+		ExpectFail("Two-factor authentication is required for all admins")
+}
@@ -0,0 +1,529 @@
+package app_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"future-fashion/app/apptest"
+	"future-fashion/config"
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/migrations"
+	"future-fashion/models"
+	"future-fashion/oidcmock"
+)
+
+var verifyLinkPattern = regexp.MustCompile(`token=(\S+)`)
+
+func signUp(s *apptest.Server, username string) *apptest.Response {
+	return s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: apptest.Password,
+		DOB:      "1990-01-01",
+	})
+}
+
+// lastVerifyToken reads the token from the last verification mail sent to the address
+func lastVerifyToken(t *testing.T, s *apptest.Server, email string) string {
+	t.Helper()
+	mail := s.Mailer.Last()
+	if mail == nil || mail.To != email {
+		t.Fatalf("expected a verification mail to %v, got %+v", email, mail)
+	}
+	match := verifyLinkPattern.FindStringSubmatch(mail.Body)
+	if match == nil {
+		t.Fatalf("no verification link in %q", mail.Body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSignUp(t *testing.T) {
+	s := apptest.New(t)
+
+	user := &dto.UserResponse{}
+	signUp(s, "alice").ExpectSuccess().Decode(user)
+	if user.Role != helpers.RoleCustomer || user.EmailVerified || user.Email != "alice@example.com" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if !strings.HasPrefix(s.Mailer.Last().Body, "Hi alice") {
+		t.Fatalf("unexpected mail %q", s.Mailer.Last().Body)
+	}
+
+	//emails are compared case-insensitively
+	s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: "alice2",
+		Email:    "Alice@Example.com",
+		Password: apptest.Password,
+		DOB:      "1990-01-01",
+	}).ExpectFail("Email address is already registered")
+	//so are usernames, they are stored lowercased
+	s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: "Alice",
+		Email:    "alice2@example.com",
+		Password: apptest.Password,
+		DOB:      "1990-01-01",
+	}).ExpectError(http.StatusConflict, "duplicate")
+
+	s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: "bob",
+		Email:    "bob@example.com",
+	}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("password").ExpectFieldError("dob")
+
+	s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: "bob",
+		Email:    "Bob <bob@example.com>",
+		Password: apptest.Password,
+		DOB:      "1990-01-01",
+	}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("email")
+
+	//the role is never read from the request
+	s.Do("POST", "/user/signup", "", `{"username":"eve","email":"eve@example.com","password":"x","dob":"1990-01-01","role":"super-admin"}`).
+		ExpectFail("Field \"role\" is not allowed")
+}
+
+func TestSignUpFailsWhenEmailLookupFails(t *testing.T) {
+	s := apptest.New(t)
+	err := s.DB.Callback().Query().Before("gorm:query").Register("fail_user_lookup", func(db *gorm.DB) {
+		if db.Statement.Table == "users" {
+			db.AddError(errors.New("lookup failed"))
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//an error is not a free address
+	signUp(s, "alice").ExpectError(http.StatusInternalServerError, "internal")
+	err = s.DB.Callback().Query().Remove("fail_user_lookup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users int64
+	err = s.DB.Model(&models.User{}).Count(&users).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users != 0 {
+		t.Fatalf("expected no user, got %v", users)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	s := apptest.New(t)
+	signUp(s, "alice").ExpectSuccess()
+	token := lastVerifyToken(t, s, "alice@example.com")
+
+	s.Do("GET", "/user/verify-email", "", nil).ExpectFail("Url param key not exist")
+	s.Do("GET", "/user/verify-email?token=not-the-token", "", nil).ExpectFail("Verification link is invalid")
+
+	s.Do("GET", "/user/verify-email?token="+url.QueryEscape(token), "", nil).ExpectSuccess()
+	//a token works once
+	s.Do("GET", "/user/verify-email?token="+url.QueryEscape(token), "", nil).ExpectFail("Verification link is invalid")
+
+	user := &dto.UserResponse{}
+	s.Do("GET", "/user/personal-info", s.LoginCustomer("alice"), nil).ExpectSuccess().Decode(user)
+	if !user.EmailVerified {
+		t.Fatal("expected the email address to be verified")
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	s := apptest.New(t)
+	signUp(s, "alice").ExpectSuccess()
+	firstToken := lastVerifyToken(t, s, "alice@example.com")
+	token := s.LoginCustomer("alice")
+
+	s.Do("POST", "/user/resend-verification", token, nil).ExpectFail("Verification email was sent recently")
+
+	err := s.DB.Model(&models.EmailVerification{}).Where("1 = 1").Update("sent_at", time.Now().Add(-2*time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Do("POST", "/user/resend-verification", token, nil).ExpectSuccess()
+
+	//the new mail replaces the previous link
+	secondToken := lastVerifyToken(t, s, "alice@example.com")
+	s.Do("GET", "/user/verify-email?token="+url.QueryEscape(firstToken), "", nil).ExpectFail("Verification link is invalid")
+	s.Do("GET", "/user/verify-email?token="+url.QueryEscape(secondToken), "", nil).ExpectSuccess()
+
+	s.Do("POST", "/user/resend-verification", token, nil).ExpectFail("Email address is already verified")
+}
+
+func TestLogin(t *testing.T) {
+	s := apptest.New(t)
+	s.CreateUser("alice", helpers.RoleCustomer)
+	s.CreateUser("root", helpers.RoleSuperAdmin)
+
+	token := s.LoginCustomer("alice")
+	claims, err := (&helpers.Claims{}).VerifyToken(token, s.TokenKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Username != "alice" || claims.Role != helpers.RoleCustomer || len(claims.Permissions) != 0 {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "ALICE", Password: apptest.Password}).ExpectSuccess()
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice"}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("password")
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "nobody", Password: apptest.Password}).ExpectFail("Invalid username or password")
+	//staff use the admin login
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "root", Password: apptest.Password}).ExpectFail("Invalid username or password")
+
+	//the account is delayed after a few failures, even for the right password
+	for i := 0; i < models.DefaultAccountThrottlePolicy.FreeAttempts; i++ {
+		s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: "wrong"}).ExpectFail("Invalid username or password")
+	}
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: apptest.Password}).ExpectFail("Too many failed login attempts")
+}
+
+func TestUniqueUserEmail(t *testing.T) {
+	s := apptest.New(t)
+	alice := s.CreateUser("alice", helpers.RoleCustomer)
+
+	//the database refuses a second active user with the address, whatever the handlers checked
+	userModel := &models.UserCRUDOperationsImpl{DB: s.DB, Logger: zap.NewNop().Sugar()}
+	_, err := userModel.Insert(&dto.UserRequest{Username: "alice2", Email: alice.Email, Role: helpers.RoleCustomer})
+	if err == nil {
+		t.Fatal("expected the duplicate address to be refused")
+	}
+
+	//erased users have no address, any number of them may exist
+	for _, name := range []string{"bob", "carol"} {
+		user := s.CreateUser(name, helpers.RoleCustomer)
+		_, err = userModel.Erase(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLowercaseUserIdentifiersMigration(t *testing.T) {
+	s := apptest.New(t)
+	//users signed up before identifiers were lowercased
+	for i, name := range []string{"alice", "Alice", "ALICE"} {
+		err := s.DB.Exec("INSERT INTO users (created_at, updated_at, username, email, password, role) VALUES (?, ?, ?, ?, ?, ?)",
+			time.Now(), time.Now(), name, fmt.Sprintf("%v.%v@Example.com", name, i), "x", helpers.RoleCustomer).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.DB.Exec("DELETE FROM schema_migrations WHERE version = 4").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = migrations.New(s.DB, zap.NewNop().Sugar()).Up()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var users []*models.User
+	err = s.DB.Order("id").Find(&users).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[0].Username != "alice" || users[0].Email != "alice.0@example.com" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+	for _, user := range users[1:] {
+		if user.Username != fmt.Sprintf("alice-%v", user.ID) || user.Email != strings.ToLower(user.Email) {
+			t.Fatalf("unexpected user %+v", user)
+		}
+	}
+}
+
+func TestConcurrentLoginFailuresAreAllCounted(t *testing.T) {
+	s := apptest.New(t)
+	loginAttempts := &models.LoginAttemptOperationsImpl{
+		DB:            s.DB,
+		Logger:        zap.NewNop().Sugar(),
+		AccountPolicy: models.DefaultAccountThrottlePolicy,
+		IPPolicy:      models.DefaultIPThrottlePolicy,
+	}
+
+	//guesses fired at once, starting with the first failure of the key
+	const guesses = 20
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make(chan error, guesses)
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := loginAttempts.RecordFailure(models.ThrottleKindIP, "192.0.2.1", "192.0.2.1")
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	throttle := &models.LoginThrottle{}
+	err := s.DB.Where("kind = ? AND identifier = ?", models.ThrottleKindIP, "192.0.2.1").First(throttle).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != guesses || throttle.LockedUntil.IsZero() {
+		t.Fatalf("expected %v failures and a delay, got %+v", guesses, throttle)
+	}
+}
+
+func TestPersonalInfo(t *testing.T) {
+	s := apptest.New(t)
+	alice, token := s.NewCustomer("alice")
+
+	user := &dto.UserResponse{}
+	s.Do("GET", "/user/personal-info", token, nil).ExpectSuccess().Decode(user)
+	if user.ID != alice.ID || user.Username != "alice" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	_, adminToken := s.NewAdmin("root")
+	profileKey := createAPIKey(t, s, adminToken, alice.ID, helpers.ScopeProfileRead)
+	ordersKey := createAPIKey(t, s, adminToken, alice.ID, helpers.ScopeOrdersOwn)
+
+	s.DoWithAPIKey("GET", "/user/personal-info", profileKey, nil).ExpectSuccess()
+	s.DoWithAPIKey("GET", "/user/personal-info", ordersKey, nil).ExpectFail("You do not have permission for this operation")
+	s.DoWithAPIKey("GET", "/user/personal-info", "ffk_unknown_key", nil).ExpectFail("invalid api key")
+}
+
+func TestEditPersonalInfo(t *testing.T) {
+	s := apptest.New(t)
+	alice, token := s.NewCustomer("alice")
+	s.CreateUser("bob", helpers.RoleCustomer)
+
+	user := &dto.UserResponse{}
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{DOB: "1991-02-03", Chest: 90}).ExpectSuccess().Decode(user)
+	if user.DOB != "1991-02-03" || user.Chest != 90 || user.Email != alice.Email {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	//the own address in another case is not a change
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{Email: "ALICE@Example.com"}).
+		ExpectSuccess().Decode(user)
+	if user.Email != alice.Email || !user.EmailVerified {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{Email: "new@example.com"}).
+		ExpectFail("Current password is required")
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{Password: "new-password", CurrentPassword: "wrong"}).
+		ExpectFail("Current password is required")
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{Email: "bob@example.com", CurrentPassword: apptest.Password}).
+		ExpectFail("Email address is already registered")
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{Email: "not-an-email", CurrentPassword: apptest.Password}).
+		ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("email")
+
+	//a new address has to be verified again
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{Email: "new@example.com", CurrentPassword: apptest.Password}).
+		ExpectSuccess().Decode(user)
+	if user.Email != "new@example.com" || user.EmailVerified {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	lastVerifyToken(t, s, "new@example.com")
+
+	s.Do("PATCH", "/user/edit-personal-info", token, &dto.EditPersonalInfoRequest{Password: "new-password", CurrentPassword: apptest.Password}).ExpectSuccess()
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: "new-password"}).ExpectSuccess()
+
+	//the id always comes from the token
+	s.Do("PATCH", "/user/edit-personal-info", token, `{"id":2,"username":"mallory"}`).ExpectFail("Field \"id\" is not allowed")
+}
+
+func TestExportData(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+	placeOrder(t, s, token)
+
+	res := s.Do("GET", "/user/export-data", token, nil)
+	if res.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected a zip archive, got %v: %s", res.Header.Get("Content-Type"), res.Body)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(res.Body), int64(len(res.Body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name], err = io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := &dto.DataExportManifest{}
+	err = json.Unmarshal(files["manifest.json"], manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range manifest.Files {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("%v is listed in the manifest but missing", name)
+		}
+	}
+
+	orders := &dto.ListOrdersResponse{}
+	err = json.Unmarshal(files["orders.json"], orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders.Orders) != 1 {
+		t.Fatalf("expected 1 order, got %v", len(orders.Orders))
+	}
+	if bytes.Contains(files["profile.json"], []byte("$2a$")) {
+		t.Fatal("the export must not contain the password hash")
+	}
+}
+
+func TestEraseAccount(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+
+	s.Do("POST", "/user/erase-account", token, &dto.EraseAccountRequest{Password: "wrong"}).ExpectFail("Password is required to erase the account")
+	s.Do("POST", "/user/erase-account", token, &dto.EraseAccountRequest{Password: apptest.Password}).ExpectSuccess()
+
+	s.Do("POST", "/user/login", "", &dto.LoginRequest{Username: "alice", Password: apptest.Password}).ExpectFail("Invalid username or password")
+	//tokens of the erased account stop working at once
+	s.Do("GET", "/user/personal-info", token, nil).ExpectError(http.StatusUnauthorized, "invalid_token")
+}
+
+func newOIDCServer(t *testing.T) (*apptest.Server, *oidcmock.Server) {
+	t.Helper()
+	mock, err := oidcmock.NewServer("future-fashion", "client-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+
+	s := apptest.New(t, func(cfg *config.Config) {
+		cfg.OIDC.Providers = map[string]config.OIDCProviderConfig{
+			"mock": {
+				Issuer:       mock.Issuer(),
+				ClientID:     mock.ClientID,
+				ClientSecret: config.Secret(mock.ClientSecret),
+			},
+		}
+	})
+	return s, mock
+}
+
+// oidcCallback runs the whole login through the mock provider and returns the callback response
+func oidcCallback(t *testing.T, s *apptest.Server) *helpers.Response {
+	t.Helper()
+	res, err := http.Get(s.URL + "/user/oidc/login?provider=mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body := &helpers.Response{}
+	err = json.NewDecoder(res.Body).Decode(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// oidcLogin logs in through the mock provider and returns the user
+func oidcLogin(t *testing.T, s *apptest.Server) *dto.UserResponse {
+	t.Helper()
+	body := oidcCallback(t, s)
+	if body.Status != "SUCCESS" {
+		t.Fatalf("oidc login failed: %v", body.Message)
+	}
+
+	user := &dto.UserResponse{}
+	s.Do("GET", "/user/personal-info", body.Details.(string), nil).ExpectSuccess().Decode(user)
+	return user
+}
+
+func TestOIDCLogin(t *testing.T) {
+	s, mock := newOIDCServer(t)
+
+	s.Do("GET", "/user/oidc/login?provider=unknown", "", nil).ExpectFail("Unknown login provider")
+
+	res := s.Do("GET", "/user/oidc/login?provider=mock", "", nil)
+	if res.Code != http.StatusFound || !strings.HasPrefix(res.Header.Get("Location"), mock.URL+"/authorize") {
+		t.Fatalf("expected a redirect to the provider, got %v %v", res.Code, res.Header.Get("Location"))
+	}
+
+	user := oidcLogin(t, s)
+	if user.Email != mock.Email || !user.EmailVerified || user.Role != helpers.RoleCustomer {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	//the second login finds the linked account
+	if again := oidcLogin(t, s); again.ID != user.ID {
+		t.Fatalf("expected user %v, got %v", user.ID, again.ID)
+	}
+}
+
+func TestOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	s, mock := newOIDCServer(t)
+	mock.EmailVerified = false
+
+	body := oidcCallback(t, s)
+	if body.Status != "FAIL" || !strings.Contains(body.Message, "did not share a verified email address") {
+		t.Fatalf("unexpected response %+v", body)
+	}
+}
+
+func TestOIDCLoginRejectsStaff(t *testing.T) {
+	s, mock := newOIDCServer(t)
+	staff := s.CreateUser("root", helpers.RoleSuperAdmin)
+	mock.Email = staff.Email
+
+	body := oidcCallback(t, s)
+	if body.Status != "FAIL" || !strings.Contains(body.Message, "cannot sign in with a login provider") {
+		t.Fatalf("unexpected response %+v", body)
+	}
+	//nothing is linked to the staff account
+	var identities int64
+	err := s.DB.Model(&models.UserIdentity{}).Count(&identities).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identities != 0 {
+		t.Fatalf("expected no linked identity, got %v", identities)
+	}
+}
+
+func TestOIDCCallback(t *testing.T) {
+	s, _ := newOIDCServer(t)
+
+	s.Do("GET", "/user/oidc/callback?error=access_denied", "", nil).ExpectFail("Login was not completed (access_denied)")
+	s.Do("GET", "/user/oidc/callback?state=abc", "", nil).ExpectFail("Login callback is missing the state or code")
+	s.Do("GET", "/user/oidc/callback?state=abc&code=def", "", nil).ExpectFail("Login session is invalid or has expired")
+
+	res := s.Request("POST", "/user/oidc/callback", "state=abc&code=def", http.Header{"Content-Type": {"application/x-www-form-urlencoded"}})
+	res.ExpectFail("Login session is invalid or has expired")
+}
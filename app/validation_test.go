@@ -0,0 +1,64 @@
+package app_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"future-fashion/app/apptest"
+	"future-fashion/dto"
+)
+
+func TestValidationReportsEveryField(t *testing.T) {
+	s := apptest.New(t)
+
+	res := s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: "al",
+		Email:    "not-an-email",
+		Password: "short",
+		DOB:      "01/02/1990",
+		Chest:    -1,
+	}).ExpectError(http.StatusBadRequest, "invalid_fields")
+	for _, field := range []string{"username", "email", "password", "dob", "chest"} {
+		res.ExpectFieldError(field)
+	}
+	if len(res.Errors) != 5 {
+		t.Fatalf("expected 5 field errors, got %+v", res.Errors)
+	}
+
+	s.Do("POST", "/user/signup", "", &dto.UserRequest{
+		Username: "alice",
+		Email:    "alice@example.com",
+		Password: apptest.Password,
+		DOB:      time.Now().AddDate(0, 0, 1).Format("2006-01-02"),
+	}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("dob")
+}
+
+func TestValidationOfNestedFields(t *testing.T) {
+	s := apptest.New(t)
+	_, token := s.NewCustomer("alice")
+	_, adminToken := s.NewAdmin("root")
+
+	res := s.Do("POST", "/order/create-order", token, &dto.OrderRequest{
+		Total: 10,
+		Snapshots: []*dto.CartModel{
+			{Id: "1", Item: "linen-shirt", Price: 10, Sizing: "m", Quantity: 1},
+			{Id: "2", Item: "wool-coat", Price: -5, Sizing: "XXL", Quantity: 0},
+		},
+	}).ExpectError(http.StatusBadRequest, "invalid_fields")
+	for _, field := range []string{"snapshots[1].price", "snapshots[1].sizing", "snapshots[1].quantity"} {
+		res.ExpectFieldError(field)
+	}
+
+	s.Do("POST", "/product/create-product", adminToken, &dto.ProductRequest{
+		Item:  "linen-shirt",
+		Price: 39.9,
+		XS:    &dto.Sizing{Chest: -80},
+	}).ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("xs.chest")
+
+	product := createProduct(t, s, adminToken, "linen-shirt")
+	s.Do("PATCH", "/product/edit-product", adminToken, &dto.UpdateProductRequest{ID: product.ID, Price: -1}).
+		ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("price")
+	s.Do("PATCH", "/product/edit-product", adminToken, &dto.UpdateProductRequest{ID: product.ID, Stock: -1}).
+		ExpectError(http.StatusBadRequest, "invalid_fields").ExpectFieldError("stock")
+}
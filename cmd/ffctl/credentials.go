@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+// the token key signs every JWT, shorter keys are easy to brute force
+const minTokenKeyLength = 32
+
+func setCredential(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("set-credential", flag.ContinueOnError)
+	credentialType := flags.String("type", models.CredentialTypeTokenKey, "credential type")
+	value := flags.String("value", "", "credential value, read from stdin when empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	credentialValue, err := ctl.readSecret(*value, "Value")
+	if err != nil {
+		return err
+	}
+	return storeCredential(ctl, *credentialType, credentialValue)
+}
+
+// rotateCredential replaces the credential with a random value ...
+func rotateCredential(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("rotate-credential", flag.ContinueOnError)
+	credentialType := flags.String("type", models.CredentialTypeTokenKey, "credential type")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	value, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	return storeCredential(ctl, *credentialType, value)
+}
+
+func storeCredential(ctl *ctl, credentialType, value string) error {
+	if credentialType == models.CredentialTypeTokenKey && len(value) < minTokenKeyLength {
+		return fmt.Errorf("%v must be at least %v characters", credentialType, minTokenKeyLength)
+	}
+
+	credential, err := ctl.CredentialModel.Set(credentialType, value)
+	if err != nil {
+		return err
+	}
+
+	//only the type is recorded, never the value
+	ctl.audit(models.AuditActionCredentialSet, models.AuditTargetCredential, credential.Type, nil)
+	fmt.Fprintf(ctl.Out, "%v is set\n", credential.Type)
+	if credentialType == models.CredentialTypeTokenKey {
+		fmt.Fprintln(ctl.Out, "tokens signed with the previous key are no longer accepted, everyone has to log in again")
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Command ffctl bootstraps and operates a future-fashion deployment: it creates admins,
+// sets and rotates credentials, seeds demo data, resets passwords and runs migrations
+// against the database of the given configuration.
+//
+//	ffctl [config flags] <command> [command flags]
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"future-fashion/config"
+	"future-fashion/helpers"
+	"future-fashion/infra"
+	"future-fashion/migrations"
+	"future-fashion/models"
+)
+
+// actor recorded in the audit log for changes made with ffctl
+const ctlActor = "ffctl"
+
+type command struct {
+	name  string
+	usage string
+	//migrate works on the database as it is, everything else needs the schema up to date
+	rawDB bool
+	run   func(ctl *ctl, args []string) error
+}
+
+var commands = []*command{
+	{name: "create-admin", usage: "-username NAME -email EMAIL [-role super-admin] [-password PASSWORD]", run: createAdmin},
+	{name: "reset-password", usage: "-username NAME [-password PASSWORD]", run: resetPassword},
+	{name: "set-credential", usage: "[-type jwt-token-key] [-value VALUE]", run: setCredential},
+	{name: "rotate-credential", usage: "[-type jwt-token-key]", run: rotateCredential},
+	{name: "seed-demo", usage: "[-force]", run: seedDemo},
+	{name: "migrate", usage: migrations.CommandUsage, rawDB: true, run: migrate},
+}
+
+// ctl holds what the commands share, built from the same models as the server
+type ctl struct {
+	DB                *gorm.DB
+	UserModel         *models.UserCRUDOperationsImpl
+	CredentialModel   *models.CredentialOperationsImpl
+	ProductModel      *models.ProductCRUDOperationsImpl
+	RoleModel         *models.RoleOperationsImpl
+	LoginAttemptModel *models.LoginAttemptOperationsImpl
+	AuditModel        *models.AuditLogOperationsImpl
+	Logger            *zap.SugaredLogger
+	In                *bufio.Reader
+	Out               io.Writer
+}
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ffctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	cfg, args, err := config.LoadCommand(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New(usage())
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+		}
+	}
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q\n%v", args[0], usage())
+	}
+
+	logger, err := helpers.InitLogger(cfg.Logger.Level, cfg.Logger.Format)
+	if err != nil {
+		return err
+	}
+
+	var db *gorm.DB
+	if cmd.rawDB {
+		db, err = infra.OpenDB(cfg.Database)
+	} else {
+		db, err = infra.InitDB(cfg.Database, logger)
+	}
+	if err != nil {
+		return err
+	}
+
+	return cmd.run(&ctl{
+		DB:              db,
+		UserModel:       &models.UserCRUDOperationsImpl{DB: db, Logger: logger},
+		CredentialModel: &models.CredentialOperationsImpl{DB: db},
+		ProductModel:    &models.ProductCRUDOperationsImpl{DB: db, Logger: logger},
+		RoleModel:       &models.RoleOperationsImpl{DB: db, Logger: logger},
+		LoginAttemptModel: &models.LoginAttemptOperationsImpl{
+			DB:            db,
+			Logger:        logger,
+			AccountPolicy: models.DefaultAccountThrottlePolicy,
+			IPPolicy:      models.DefaultIPThrottlePolicy,
+		},
+		AuditModel: &models.AuditLogOperationsImpl{DB: db, Logger: logger},
+		Logger:     logger,
+		In:         bufio.NewReader(os.Stdin),
+		Out:        os.Stdout,
+	}, args[1:])
+}
+
+func usage() string {
+	lines := []string{"usage: ffctl [config flags] <command> [command flags]", "commands:"}
+	for _, c := range commands {
+		lines = append(lines, fmt.Sprintf("  %v %v", c.name, c.usage))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func migrate(ctl *ctl, args []string) error {
+	return migrations.New(ctl.DB, ctl.Logger).Command(args, ctl.Out)
+}
+
+// readSecret returns value, or reads one line from stdin when it is empty so secrets
+// do not have to show up in the shell history or the process list ...
+func (ctl *ctl) readSecret(value, prompt string) (string, error) {
+	if value != "" {
+		return value, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "%v: ", prompt)
+	line, err := ctl.In.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("%v cannot be empty", strings.ToLower(prompt))
+	}
+	return line, nil
+}
+
+// audit records a change made with ffctl, a failed write is logged and does not undo the change ...
+func (ctl *ctl) audit(action, targetType string, targetID interface{}, after interface{}) {
+	entry := &models.AuditLog{
+		ActorUsername: ctlActor,
+		Action:        action,
+		TargetType:    targetType,
+		TargetID:      fmt.Sprint(targetID),
+	}
+	if after != nil {
+		afterJSON, err := json.Marshal(after)
+		if err == nil {
+			entry.After = string(afterJSON)
+		}
+	}
+
+	_, err := ctl.AuditModel.Insert(entry)
+	if err != nil {
+		ctl.Logger.Errorw("failed to write audit log", "action", action, "target_type", targetType, "target_id", targetID, "error", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"future-fashion/dto"
+	"future-fashion/models"
+)
+
+type demoProduct struct {
+	Item     string
+	Price    float32
+	Stock    int
+	Pictures []string
+	Sizes    [5]*dto.Sizing
+}
+
+func sizing(chest, waist, hip float32) *dto.Sizing {
+	return &dto.Sizing{Chest: chest, Waist: waist, Hip: hip}
+}
+
+// demoCatalogue has sizes in the order xs, s, m, l, xl, nil when the size is not made
+var demoCatalogue = []*demoProduct{
+	{
+		Item:     "Linen Wrap Dress",
+		Price:    89.90,
+		Stock:    25,
+		Pictures: []string{"https://picsum.photos/seed/wrap-dress/600/800"},
+		Sizes:    [5]*dto.Sizing{sizing(80, 62, 86), sizing(84, 66, 90), sizing(88, 70, 94), sizing(94, 76, 100), nil},
+	},
+	{
+		Item:     "Oversized Cotton Shirt",
+		Price:    49.50,
+		Stock:    40,
+		Pictures: []string{"https://picsum.photos/seed/cotton-shirt/600/800", "https://picsum.photos/seed/cotton-shirt-back/600/800"},
+		Sizes:    [5]*dto.Sizing{nil, sizing(100, 96, 102), sizing(106, 102, 108), sizing(112, 108, 114), sizing(118, 114, 120)},
+	},
+	{
+		Item:     "High Waist Tailored Trousers",
+		Price:    69.00,
+		Stock:    30,
+		Pictures: []string{"https://picsum.photos/seed/trousers/600/800"},
+		Sizes:    [5]*dto.Sizing{sizing(0, 60, 84), sizing(0, 64, 88), sizing(0, 68, 92), sizing(0, 74, 98), sizing(0, 80, 104)},
+	},
+	{
+		Item:     "Ribbed Knit Cardigan",
+		Price:    59.90,
+		Stock:    0,
+		Pictures: []string{"https://picsum.photos/seed/cardigan/600/800"},
+		Sizes:    [5]*dto.Sizing{sizing(84, 70, 88), sizing(88, 74, 92), sizing(92, 78, 96), nil, nil},
+	},
+	{
+		Item:     "Pleated Midi Skirt",
+		Price:    54.00,
+		Stock:    18,
+		Pictures: []string{"https://picsum.photos/seed/midi-skirt/600/800"},
+		Sizes:    [5]*dto.Sizing{sizing(0, 62, 0), sizing(0, 66, 0), sizing(0, 70, 0), sizing(0, 76, 0), sizing(0, 82, 0)},
+	},
+}
+
+// seedDemo fills an empty catalogue with demo products ...
+func seedDemo(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("seed-demo", flag.ContinueOnError)
+	force := flags.Bool("force", false, "add the demo products even when the catalogue is not empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	products, err := ctl.ProductModel.GetAll()
+	if err != nil {
+		return err
+	}
+	if len(products) > 0 && !*force {
+		fmt.Fprintf(ctl.Out, "catalogue already has %v products, use -force to add the demo products anyway\n", len(products))
+		return nil
+	}
+
+	for _, demo := range demoCatalogue {
+		product, err := demo.model()
+		if err != nil {
+			return err
+		}
+		product, err = ctl.ProductModel.Insert(product)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(ctl.Out, "created product %v (id %v)\n", product.Item, product.ID)
+	}
+	return nil
+}
+
+// model stores pictures and sizes as json strings, like the product handler does
+func (d *demoProduct) model() (*models.Product, error) {
+	picturesJsonByte, err := json.Marshal(d.Pictures)
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes [5]string
+	for i, size := range d.Sizes {
+		sizeJsonByte, err := json.Marshal(size)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = string(sizeJsonByte)
+	}
+
+	return &models.Product{
+		Item:     d.Item,
+		Price:    d.Price,
+		Stock:    d.Stock,
+		Pictures: string(picturesJsonByte),
+		XS:       sizes[0],
+		S:        sizes[1],
+		M:        sizes[2],
+		L:        sizes[3],
+		XL:       sizes[4],
+	}, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/mappers"
+	"future-fashion/models"
+)
+
+// createAdmin creates a staff user with a verified email, e.g. the first super-admin ...
+func createAdmin(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	username := flags.String("username", "", "username of the admin")
+	email := flags.String("email", "", "email address of the admin")
+	role := flags.String("role", helpers.RoleSuperAdmin, "staff role to give the admin")
+	password := flags.String("password", "", "password, read from stdin when empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *username == "" || *email == "" {
+		return errors.New("-username and -email are required")
+	}
+
+	if *role == helpers.RoleCustomer {
+		return errors.New("-role must be a staff role")
+	}
+	_, err = ctl.RoleModel.GetByName(*role)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("role %q does not exist", *role)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = ctl.UserModel.GetByUsername(*username)
+	if err == nil {
+		return fmt.Errorf("username %q is already taken", *username)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	_, err = ctl.UserModel.GetByEmail(*email)
+	if err == nil {
+		return fmt.Errorf("email address %q is already registered", *email)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	plainPassword, err := ctl.readSecret(*password, "Password")
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plainPassword), 8)
+	if err != nil {
+		return err
+	}
+
+	user, err := ctl.UserModel.Insert(&dto.UserRequest{
+		Username: *username,
+		Email:    *email,
+		Password: string(hashedPassword),
+		Role:     *role,
+	})
+	if err != nil {
+		return err
+	}
+	//the operator vouches for the address, staff never go through the verification email
+	user, err = ctl.UserModel.MarkEmailVerified(user.ID)
+	if err != nil {
+		return err
+	}
+
+	ctl.audit(models.AuditActionStaffCreate, models.AuditTargetUser, user.ID, mappers.User(user))
+	fmt.Fprintf(ctl.Out, "created %v %v (id %v)\n", user.Role, user.Username, user.ID)
+	return nil
+}
+
+// resetPassword sets a new password and lifts a lockout of the account ...
+func resetPassword(ctl *ctl, args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	username := flags.String("username", "", "username of the account")
+	password := flags.String("password", "", "new password, read from stdin when empty")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("-username is required")
+	}
+
+	foundUser, err := ctl.UserModel.GetByUsername(*username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("user %q does not exist", *username)
+	}
+	if err != nil {
+		return err
+	}
+
+	plainPassword, err := ctl.readSecret(*password, "New password")
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plainPassword), 8)
+	if err != nil {
+		return err
+	}
+
+	_, err = ctl.UserModel.Update(&models.User{
+		Model: gorm.Model{
+			ID: foundUser.ID,
+		},
+		Password: string(hashedPassword),
+	})
+	if err != nil {
+		return err
+	}
+
+	accountKey := strings.ToLower(strings.TrimSpace(foundUser.Username))
+	lockedUntil, err := ctl.LoginAttemptModel.GetLockedUntil(models.ThrottleKindAccount, accountKey)
+	if err != nil {
+		return err
+	}
+	if !lockedUntil.IsZero() {
+		err = ctl.LoginAttemptModel.Unlock(models.ThrottleKindAccount, accountKey, ctlActor)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctl.audit(models.AuditActionUserPasswordReset, models.AuditTargetUser, foundUser.ID, nil)
+	fmt.Fprintf(ctl.Out, "password of %v is reset\n", foundUser.Username)
+	return nil
+}
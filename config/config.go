@@ -0,0 +1,227 @@
+// Package config loads the server configuration. Values are layered as
+// defaults < config file < FF_* environment variables < command line flags,
+// secrets can be given as env:NAME or file:/path references, and the result is
+// validated before the server starts.
+package config
+
+import "time"
+
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// Database drivers, sqlite needs no server and is meant for local development and tests
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// InMemorySQLiteDSN is an SQLite database that is gone once the connection closes
+const InMemorySQLiteDSN = ":memory:"
+
+type Config struct {
+	Environment string          `yaml:"environment"`
+	Server      ServerConfig    `yaml:"server"`
+	Database    DatabaseConfig  `yaml:"database"`
+	Logger      LoggerConfig    `yaml:"logger"`
+	Auth        AuthConfig      `yaml:"auth"`
+	CORS        CORSConfig      `yaml:"cors"`
+	RateLimit   RateLimitConfig `yaml:"rate_limit"`
+	Purge       PurgeConfig     `yaml:"purge"`
+	Mailer      MailerConfig    `yaml:"mailer"`
+	OIDC        OIDCConfig      `yaml:"oidc"`
+	Metrics     MetricsConfig   `yaml:"metrics"`
+	Tracing     TracingConfig   `yaml:"tracing"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	//base url the api is reached at, used for links in emails and login redirects
+	PublicURL string `yaml:"public_url"`
+	//zero turns a timeout off
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	//how long requests in flight may take to finish once a shutdown starts
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	//load balancers in front of the api, as IPs or CIDR ranges. X-Forwarded-For is only
+	//read from these, without any every client has the address of the proxy
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
+
+type DatabaseConfig struct {
+	//mysql, postgres or sqlite
+	Driver string `yaml:"driver"`
+	DSN    Secret `yaml:"dsn"`
+	//apply pending migrations on startup, turn off to run them with the migrate command instead
+	AutoMigrate bool `yaml:"auto_migrate"`
+	//connection pool, zero means no limit, sqlite always uses a single connection
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+type LoggerConfig struct {
+	Level string `yaml:"level"`
+	//console for people, json for log collectors
+	Format string `yaml:"format"`
+}
+
+type AuthConfig struct {
+	TokenTTL        time.Duration `yaml:"token_ttl"`
+	RequireAdmin2FA bool          `yaml:"require_admin_2fa"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string      `yaml:"allowed_origins"`
+	AllowedMethods []string      `yaml:"allowed_methods"`
+	AllowedHeaders []string      `yaml:"allowed_headers"`
+	MaxAge         time.Duration `yaml:"max_age"`
+}
+
+type RouteLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+	KeyBy    string        `yaml:"key_by"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool                  `yaml:"enabled"`
+	Default RouteLimit            `yaml:"default"`
+	Routes  map[string]RouteLimit `yaml:"routes"`
+}
+
+type PurgeConfig struct {
+	Retention time.Duration `yaml:"retention"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+type MailerConfig struct {
+	//log or smtp
+	Driver string     `yaml:"driver"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+type MetricsConfig struct {
+	//serve /metrics for Prometheus
+	Enabled bool `yaml:"enabled"`
+	//scrapers send it as a bearer token, the endpoint is open when empty
+	Token Secret `yaml:"token"`
+}
+
+type TracingConfig struct {
+	//none, stdout or otlp
+	Exporter string `yaml:"exporter"`
+	//url the otlp exporter posts spans to, usually the /v1/traces path of a collector
+	Endpoint string `yaml:"endpoint"`
+	//sent with every export, e.g. the api key of a hosted backend
+	Headers     map[string]Secret `yaml:"headers"`
+	ServiceName string            `yaml:"service_name"`
+	//share of the traces started here that are kept, incoming requests keep the caller's decision
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type OIDCConfig struct {
+	//keyed by provider name, google and apple only need client credentials
+	Providers map[string]OIDCProviderConfig `yaml:"providers"`
+}
+
+type OIDCProviderConfig struct {
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret Secret   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	ResponseMode string   `yaml:"response_mode"`
+}
+
+// Default is the configuration before any file, environment variable or flag is applied ...
+func Default() *Config {
+	return &Config{
+		Environment: EnvDevelopment,
+		Server: ServerConfig{
+			Addr:              ":8080",
+			PublicURL:         "http://127.0.0.1:8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:          DriverSQLite,
+			DSN:             "future_fashion.db",
+			AutoMigrate:     true,
+			MaxOpenConns:    20,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Logger: LoggerConfig{
+			Level:  "info",
+			Format: "console",
+		},
+		Auth: AuthConfig{
+			TokenTTL: 3000 * time.Minute,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "X-API-Key"},
+			MaxAge:         10 * time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Default: RouteLimit{Requests: 120, Per: time.Minute, KeyBy: "user"},
+			Routes: map[string]RouteLimit{
+				"/product/list-products":    {Requests: 30, Per: time.Minute, KeyBy: "ip"},
+				"/user/login":               {Requests: 10, Per: time.Minute, KeyBy: "ip"},
+				"/admin/login":              {Requests: 10, Per: time.Minute, KeyBy: "ip"},
+				"/user/signup":              {Requests: 5, Per: time.Minute, KeyBy: "ip"},
+				"/user/resend-verification": {Requests: 5, Per: time.Minute, KeyBy: "ip"},
+			},
+		},
+		Purge: PurgeConfig{
+			Retention: 30 * 24 * time.Hour,
+			Interval:  24 * time.Hour,
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "future-fashion",
+			SampleRatio: 1,
+		},
+		Mailer: MailerConfig{
+			Driver: "log",
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		OIDC: OIDCConfig{
+			Providers: map[string]OIDCProviderConfig{},
+		},
+	}
+}
+
+// applyEnvironmentDefaults fills in what depends on the environment once it is known ...
+func (c *Config) applyEnvironmentDefaults() {
+	//only development may be called from a local frontend without configuring it
+	if c.Environment == EnvDevelopment && len(c.CORS.AllowedOrigins) == 0 {
+		c.CORS.AllowedOrigins = []string{"http://localhost:3000", "http://127.0.0.1:3000"}
+	}
+}
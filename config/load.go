@@ -0,0 +1,293 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const envPrefix = "FF_"
+
+// DefaultFile is read when no config file is given and it exists ...
+const DefaultFile = "config.yaml"
+
+// Load builds the configuration from defaults, the config file, FF_* environment
+// variables and the command line args, in that order of precedence.
+func Load(args []string) (*Config, error) {
+	config, rest, err := LoadCommand(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", rest[0])
+	}
+	return config, nil
+}
+
+// LoadCommand is Load for command line tools, the config flags come first and the
+// arguments after them are returned, e.g. the subcommand and its flags.
+func LoadCommand(args []string) (*Config, []string, error) {
+	config := Default()
+
+	flags := flag.NewFlagSet("future-fashion", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path of the YAML config file (env FF_CONFIG)")
+	environment := flags.String("env", "", "development, staging or production")
+	addr := flags.String("addr", "", "address the server listens on, e.g. :8080")
+	publicURL := flags.String("public-url", "", "base url the api is reached at")
+	dbDriver := flags.String("db-driver", "", "database driver")
+	dbDSN := flags.String("db-dsn", "", "database dsn, or an env: or file: reference")
+	logLevel := flags.String("log-level", "", "debug, info, warn or error")
+	err := flags.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+	if path == "" {
+		if _, err := os.Stat(DefaultFile); err == nil {
+			path = DefaultFile
+		}
+	}
+	if path != "" {
+		err = config.loadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = config.loadEnv(os.Environ())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//only flags given on the command line override, so their empty defaults never win
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "env":
+			config.Environment = *environment
+		case "addr":
+			config.Server.Addr = *addr
+		case "public-url":
+			config.Server.PublicURL = *publicURL
+		case "db-driver":
+			config.Database.Driver = *dbDriver
+		case "db-dsn":
+			config.Database.DSN = Secret(*dbDSN)
+		case "log-level":
+			config.Logger.Level = *logLevel
+		}
+	})
+
+	config.applyEnvironmentDefaults()
+
+	err = config.resolveSecrets()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, flags.Args(), nil
+}
+
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	//a typo in a key should fail loudly instead of silently keeping the default
+	decoder.KnownFields(true)
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %v: %v", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv(environ []string) error {
+	setters := map[string]func(string) error{
+		"ENVIRONMENT":                 setString(&c.Environment),
+		"SERVER_ADDR":                 setString(&c.Server.Addr),
+		"SERVER_PUBLIC_URL":           setString(&c.Server.PublicURL),
+		"SERVER_READ_TIMEOUT":         setDuration(&c.Server.ReadTimeout),
+		"SERVER_READ_HEADER_TIMEOUT":  setDuration(&c.Server.ReadHeaderTimeout),
+		"SERVER_WRITE_TIMEOUT":        setDuration(&c.Server.WriteTimeout),
+		"SERVER_IDLE_TIMEOUT":         setDuration(&c.Server.IdleTimeout),
+		"SERVER_SHUTDOWN_TIMEOUT":     setDuration(&c.Server.ShutdownTimeout),
+		"SERVER_TRUSTED_PROXIES":      setList(&c.Server.TrustedProxies),
+		"DATABASE_DRIVER":             setString(&c.Database.Driver),
+		"DATABASE_DSN":                setSecret(&c.Database.DSN),
+		"DATABASE_AUTO_MIGRATE":       setBool(&c.Database.AutoMigrate),
+		"DATABASE_MAX_OPEN_CONNS":     setInt(&c.Database.MaxOpenConns),
+		"DATABASE_MAX_IDLE_CONNS":     setInt(&c.Database.MaxIdleConns),
+		"DATABASE_CONN_MAX_LIFETIME":  setDuration(&c.Database.ConnMaxLifetime),
+		"DATABASE_CONN_MAX_IDLE_TIME": setDuration(&c.Database.ConnMaxIdleTime),
+		"LOG_LEVEL":                   setString(&c.Logger.Level),
+		"LOG_FORMAT":                  setString(&c.Logger.Format),
+		"AUTH_TOKEN_TTL":              setDuration(&c.Auth.TokenTTL),
+		"AUTH_REQUIRE_ADMIN_2FA":      setBool(&c.Auth.RequireAdmin2FA),
+		"CORS_ALLOWED_ORIGINS":        setList(&c.CORS.AllowedOrigins),
+		"CORS_ALLOWED_METHODS":        setList(&c.CORS.AllowedMethods),
+		"CORS_ALLOWED_HEADERS":        setList(&c.CORS.AllowedHeaders),
+		"CORS_MAX_AGE":                setDuration(&c.CORS.MaxAge),
+		"RATE_LIMIT_ENABLED":          setBool(&c.RateLimit.Enabled),
+		"RATE_LIMIT_DEFAULT_REQUESTS": setInt(&c.RateLimit.Default.Requests),
+		"RATE_LIMIT_DEFAULT_PER":      setDuration(&c.RateLimit.Default.Per),
+		"RATE_LIMIT_DEFAULT_BURST":    setInt(&c.RateLimit.Default.Burst),
+		"RATE_LIMIT_DEFAULT_KEY_BY":   setString(&c.RateLimit.Default.KeyBy),
+		"PURGE_RETENTION":             setDuration(&c.Purge.Retention),
+		"PURGE_INTERVAL":              setDuration(&c.Purge.Interval),
+		"METRICS_ENABLED":             setBool(&c.Metrics.Enabled),
+		"METRICS_TOKEN":               setSecret(&c.Metrics.Token),
+		"TRACING_EXPORTER":            setString(&c.Tracing.Exporter),
+		"TRACING_ENDPOINT":            setString(&c.Tracing.Endpoint),
+		"TRACING_SAMPLE_RATIO":        setFloat(&c.Tracing.SampleRatio),
+		"TRACING_SERVICE_NAME":        setString(&c.Tracing.ServiceName),
+		"MAILER_DRIVER":               setString(&c.Mailer.Driver),
+		"MAILER_SMTP_HOST":            setString(&c.Mailer.SMTP.Host),
+		"MAILER_SMTP_PORT":            setInt(&c.Mailer.SMTP.Port),
+		"MAILER_SMTP_USERNAME":        setString(&c.Mailer.SMTP.Username),
+		"MAILER_SMTP_PASSWORD":        setSecret(&c.Mailer.SMTP.Password),
+		"MAILER_SMTP_FROM":            setString(&c.Mailer.SMTP.From),
+	}
+
+	for _, entry := range environ {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], envPrefix) {
+			continue
+		}
+		name, value := parts[0], parts[1]
+		key := strings.TrimPrefix(name, envPrefix)
+
+		if setter, ok := setters[key]; ok {
+			err := setter(value)
+			if err != nil {
+				return fmt.Errorf("%v: %v", name, err)
+			}
+			continue
+		}
+
+		//FF_OIDC_<PROVIDER>_CLIENT_ID, _CLIENT_SECRET and _ISSUER
+		if strings.HasPrefix(key, "OIDC_") {
+			err := c.setOIDCEnv(strings.TrimPrefix(key, "OIDC_"), value)
+			if err != nil {
+				return fmt.Errorf("%v: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) setOIDCEnv(key, value string) error {
+	for _, field := range []string{"CLIENT_ID", "CLIENT_SECRET", "ISSUER"} {
+		if !strings.HasSuffix(key, "_"+field) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(key, "_"+field))
+		if name == "" {
+			break
+		}
+
+		if c.OIDC.Providers == nil {
+			c.OIDC.Providers = map[string]OIDCProviderConfig{}
+		}
+		provider := c.OIDC.Providers[name]
+		switch field {
+		case "CLIENT_ID":
+			provider.ClientID = value
+		case "CLIENT_SECRET":
+			provider.ClientSecret = Secret(value)
+		case "ISSUER":
+			provider.Issuer = value
+		}
+		c.OIDC.Providers[name] = provider
+		return nil
+	}
+	return errors.New("unknown oidc setting, expected FF_OIDC_<PROVIDER>_CLIENT_ID, _CLIENT_SECRET or _ISSUER")
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func setSecret(target *Secret) func(string) error {
+	return func(value string) error {
+		*target = Secret(value)
+		return nil
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setInt(target *int) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setFloat(target *float64) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setDuration(target *time.Duration) func(string) error {
+	return func(value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+// comma separated, empty entries are dropped
+func setList(target *[]string) func(string) error {
+	return func(value string) error {
+		*target = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*target = append(*target, item)
+			}
+		}
+		return nil
+	}
+}
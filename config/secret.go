@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret is a config value that may be a reference instead of the value itself:
+// env:NAME reads the environment variable, file:/path reads the file (trailing
+// newlines are dropped). String never prints the value.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) resolve() (Secret, error) {
+	value := string(s)
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %v is not set", name)
+		}
+		return Secret(resolved), nil
+	case strings.HasPrefix(value, "file:"):
+		path := strings.TrimPrefix(value, "file:")
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return Secret(strings.TrimRight(string(content), "\r\n")), nil
+	}
+	return s, nil
+}
+
+// resolveSecrets replaces every secret reference with its value ...
+func (c *Config) resolveSecrets() error {
+	var err error
+	c.Database.DSN, err = c.Database.DSN.resolve()
+	if err != nil {
+		return fmt.Errorf("database.dsn: %v", err)
+	}
+
+	c.Mailer.SMTP.Password, err = c.Mailer.SMTP.Password.resolve()
+	if err != nil {
+		return fmt.Errorf("mailer.smtp.password: %v", err)
+	}
+
+	c.Metrics.Token, err = c.Metrics.Token.resolve()
+	if err != nil {
+		return fmt.Errorf("metrics.token: %v", err)
+	}
+
+	for name, header := range c.Tracing.Headers {
+		c.Tracing.Headers[name], err = header.resolve()
+		if err != nil {
+			return fmt.Errorf("tracing.headers.%v: %v", name, err)
+		}
+	}
+
+	for name, provider := range c.OIDC.Providers {
+		provider.ClientSecret, err = provider.ClientSecret.resolve()
+		if err != nil {
+			return fmt.Errorf("oidc.providers.%v.client_secret: %v", name, err)
+		}
+		c.OIDC.Providers[name] = provider
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Validate reports every problem at once, so a broken deployment is fixed in one go ...
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch c.Environment {
+	case EnvDevelopment, EnvStaging, EnvProduction:
+	default:
+		add("environment must be development, staging or production, got %q", c.Environment)
+	}
+
+	if c.Server.Addr == "" {
+		add("server.addr is required")
+	}
+	if c.Server.ReadTimeout < 0 || c.Server.ReadHeaderTimeout < 0 || c.Server.WriteTimeout < 0 || c.Server.IdleTimeout < 0 {
+		add("server timeouts cannot be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		add("server.shutdown_timeout must be positive")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		if err != nil && net.ParseIP(proxy) == nil {
+			add("server.trusted_proxies must be IPs or CIDR ranges, got %q", proxy)
+		}
+	}
+	publicURL, err := url.Parse(c.Server.PublicURL)
+	if err != nil || publicURL.Scheme == "" || publicURL.Host == "" {
+		add("server.public_url must be an absolute url, got %q", c.Server.PublicURL)
+	} else if c.Environment == EnvProduction && publicURL.Scheme != "https" {
+		add("server.public_url must use https in production")
+	}
+
+	switch c.Database.Driver {
+	case DriverMySQL, DriverPostgres:
+	case DriverSQLite:
+		if c.Environment == EnvProduction {
+			add("database.driver sqlite is for development and tests, use mysql or postgres in production")
+		}
+	default:
+		add("database.driver must be mysql, postgres or sqlite, got %q", c.Database.Driver)
+	}
+	if c.Database.DSN == "" {
+		add("database.dsn is required")
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 || c.Database.ConnMaxIdleTime < 0 {
+		add("database connection pool settings cannot be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		add("database.max_idle_conns cannot be more than database.max_open_conns")
+	}
+
+	switch c.Logger.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("logger.level must be debug, info, warn or error, got %q", c.Logger.Level)
+	}
+	switch c.Logger.Format {
+	case "console", "json":
+	default:
+		add("logger.format must be console or json, got %q", c.Logger.Format)
+	}
+
+	if c.Auth.TokenTTL <= 0 {
+		add("auth.token_ttl must be positive")
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" && c.Environment != EnvDevelopment {
+			add("cors.allowed_origins cannot contain * outside development")
+		}
+	}
+
+	c.validateRouteLimit("rate_limit.default", c.RateLimit.Default, add)
+	for route, limit := range c.RateLimit.Routes {
+		c.validateRouteLimit("rate_limit.routes."+route, limit, add)
+	}
+
+	if c.Purge.Interval > 0 && c.Purge.Retention <= 0 {
+		add("purge.retention must be positive when the purge job runs")
+	}
+
+	switch c.Mailer.Driver {
+	case "log":
+		if c.Environment == EnvProduction {
+			add("mailer.driver log only writes emails to the log, use smtp in production")
+		}
+	case "smtp":
+		if c.Mailer.SMTP.Host == "" || c.Mailer.SMTP.Port <= 0 || c.Mailer.SMTP.From == "" {
+			add("mailer.smtp needs host, port and from")
+		}
+	default:
+		add("mailer.driver must be log or smtp, got %q", c.Mailer.Driver)
+	}
+
+	if c.Metrics.Enabled && c.Metrics.Token == "" && c.Environment != EnvDevelopment {
+		//the metrics include the revenue
+		add("metrics.token is required outside development")
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		endpoint, err := url.Parse(c.Tracing.Endpoint)
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			add("tracing.endpoint must be an absolute url, got %q", c.Tracing.Endpoint)
+		}
+	default:
+		add("tracing.exporter must be none, stdout or otlp, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio must be between 0 and 1")
+	}
+
+	for name, provider := range c.OIDC.Providers {
+		if provider.ClientID == "" || provider.ClientSecret == "" {
+			add("oidc.providers.%v needs client_id and client_secret", name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %v", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func (c *Config) validateRouteLimit(name string, limit RouteLimit, add func(string, ...interface{})) {
+	if limit.Requests < 0 || limit.Burst < 0 {
+		add("%v cannot be negative", name)
+	}
+	if limit.Requests > 0 && limit.Per <= 0 {
+		add("%v.per must be positive", name)
+	}
+	switch limit.KeyBy {
+	case "ip", "user", "api-key":
+	default:
+		add("%v.key_by must be ip, user or api-key, got %q", name, limit.KeyBy)
+	}
+}
@@ -0,0 +1,32 @@
+package dto
+
+import "time"
+
+type CreateAPIKeyRequest struct {
+	UserID        uint     `json:"user_id" validate:"required"`
+	Name          string   `json:"name" validate:"required,max=64"`
+	Scopes        []string `json:"scopes" validate:"required,max=32"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"gte=0,lte=3650"`
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	UserID     uint       `json:"user_id"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreateAPIKeyResponse is the only response that ever contains the full key
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+type ListAPIKeysResponse struct {
+	APIKeys []*APIKeyResponse `json:"api_keys"`
+}
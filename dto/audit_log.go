@@ -0,0 +1,26 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditLogResponse struct {
+	ID            uint            `json:"id"`
+	ActorID       uint            `json:"actor_id"`
+	ActorUsername string          `json:"actor_username"`
+	ActorRole     string          `json:"actor_role"`
+	ViaAPIKey     bool            `json:"via_api_key"`
+	Action        string          `json:"action"`
+	TargetType    string          `json:"target_type"`
+	TargetID      string          `json:"target_id"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+	Diff          json.RawMessage `json:"diff"`
+	IP            string          `json:"ip"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+type ListAuditLogsResponse struct {
+	AuditLogs []*AuditLogResponse `json:"audit_logs"`
+}
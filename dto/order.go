@@ -2,17 +2,17 @@ package dto
 
 import "time"
 
+// OrderRequest is the checkout form, status and owner are set by the server
 type OrderRequest struct {
-	Total     float32      `json:"total"`
-	Status    string       `json:"status"`
-	Snapshots []*CartModel `json:"snapshots"`
-	UserID    uint         `json:"user_id"`
+	Total     float32      `json:"total" validate:"gt=0"`
+	Status    string       `json:"-"`
+	Snapshots []*CartModel `json:"snapshots" validate:"required,max=100"`
+	UserID    uint         `json:"-"`
 }
 
 type EditOrderRequest struct {
-	ID     uint   `json:"id"`
-	Status string `json:"status"`
-	UserID uint   `json:"user_id"`
+	ID     uint   `json:"id" validate:"required"`
+	Status string `json:"status" validate:"required,max=64"`
 }
 
 type OrderResponse struct {
@@ -22,14 +22,16 @@ type OrderResponse struct {
 	Snapshots []*CartModel `json:"snapshots,omitempty"`
 	UserID    uint         `json:"userID"`
 	CreatedAt time.Time    `json:"createdAt"`
+	DeletedAt *time.Time   `json:"deleted_at,omitempty"`
 }
 
+// CartModel is one line of the cart, Sizing names one of the product sizes
 type CartModel struct {
-	Id       string          `json:"id"`
-	Item     string          `json:"item"`
-	Price    float32         `json:"price"`
-	Sizing   string          `json:"sizing"`
-	Quantity int             `json:"quantity"`
+	Id       string          `json:"id" validate:"required,max=64"`
+	Item     string          `json:"item" validate:"required,max=100"`
+	Price    float32         `json:"price" validate:"gt=0"`
+	Sizing   string          `json:"sizing" validate:"required,oneof=xs s m l xl"`
+	Quantity int             `json:"quantity" validate:"gt=0,lte=100"`
 	Product  ProductResponse `json:"product"`
 }
 
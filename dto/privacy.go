@@ -0,0 +1,31 @@
+package dto
+
+import "time"
+
+type EraseAccountRequest struct {
+	Password string `json:"password" validate:"max=72"`
+}
+
+// DataExportManifest is manifest.json in the data export archive ...
+type DataExportManifest struct {
+	UserID      uint      `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+	Notes       []string  `json:"notes"`
+}
+
+type MeasurementsResponse struct {
+	Chest float32 `json:"chest"`
+	Waist float32 `json:"waist"`
+	Hip   float32 `json:"hip"`
+}
+
+type UserIdentityResponse struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ListUserIdentitiesResponse struct {
+	Identities []*UserIdentityResponse `json:"identities"`
+}
@@ -1,12 +1,12 @@
 package dto
 
-import "errors"
+import "time"
 
 type ProductRequest struct {
-	Item     string   `json:"item"`
-	Price    float32  `json:"price"`
-	Stock    int      `json:"stock"`
-	Pictures []string `json:"pictures"`
+	Item     string   `json:"item" validate:"required,max=100"`
+	Price    float32  `json:"price" validate:"gt=0"`
+	Stock    int      `json:"stock" validate:"gte=0"`
+	Pictures []string `json:"pictures" validate:"max=20"`
 	XS       *Sizing  `json:"xs"`
 	S        *Sizing  `json:"s"`
 	M        *Sizing  `json:"m"`
@@ -14,12 +14,13 @@ type ProductRequest struct {
 	XL       *Sizing  `json:"xl"`
 }
 
+// UpdateProductRequest changes the fields that are sent, zero values are left as they are
 type UpdateProductRequest struct {
-	ID       uint     `json:"id"`
-	Item     string   `json:"item"`
-	Price    float32  `json:"price"`
-	Stock    int      `json:"stock"`
-	Pictures []string `json:"pictures"`
+	ID       uint     `json:"id" validate:"required"`
+	Item     string   `json:"item" validate:"max=100"`
+	Price    float32  `json:"price" validate:"gte=0"`
+	Stock    int      `json:"stock" validate:"gte=0"`
+	Pictures []string `json:"pictures" validate:"max=20"`
 	XS       *Sizing  `json:"xs"`
 	S        *Sizing  `json:"s"`
 	M        *Sizing  `json:"m"`
@@ -28,31 +29,26 @@ type UpdateProductRequest struct {
 }
 
 type ProductResponse struct {
-	ID       uint     `json:"id"`
-	Item     string   `json:"item"`
-	Price    float32  `json:"price"`
-	Stock    int      `json:"stock"`
-	Pictures []string `json:"pictures"`
-	XS       *Sizing  `json:"xs"`
-	S        *Sizing  `json:"s"`
-	M        *Sizing  `json:"m"`
-	L        *Sizing  `json:"l"`
-	XL       *Sizing  `json:"xl"`
+	ID        uint       `json:"id"`
+	Item      string     `json:"item"`
+	Price     float32    `json:"price"`
+	Stock     int        `json:"stock"`
+	Pictures  []string   `json:"pictures"`
+	XS        *Sizing    `json:"xs"`
+	S         *Sizing    `json:"s"`
+	M         *Sizing    `json:"m"`
+	L         *Sizing    `json:"l"`
+	XL        *Sizing    `json:"xl"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type ListProductsResponse struct {
 	Products []*ProductResponse `json:"products"`
 }
 
+// Sizing is the body measurements of a size, in centimetres
 type Sizing struct {
-	Chest float32 `json:"chest"`
-	Waist float32 `json:"waist"`
-	Hip   float32 `json:"hip"`
-}
-
-func (p *ProductRequest) Validate() error {
-	if p.Item == "" || p.Price == 0 {
-		return errors.New("item name or price cannot be empty")
-	}
-	return nil
+	Chest float32 `json:"chest" validate:"gte=0,lte=300"`
+	Waist float32 `json:"waist" validate:"gte=0,lte=300"`
+	Hip   float32 `json:"hip" validate:"gte=0,lte=300"`
 }
@@ -0,0 +1,26 @@
+package dto
+
+// RoleRequest creates a role from Name, or edits the role with ID
+type RoleRequest struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name" validate:"omitempty,slug,min=2,max=64"`
+	Description string   `json:"description" validate:"max=255"`
+	Permissions []string `json:"permissions" validate:"max=64"`
+}
+
+type AssignRoleRequest struct {
+	UserID uint   `json:"user_id" validate:"required"`
+	Role   string `json:"role" validate:"required,max=64"`
+}
+
+type RoleResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Builtin     bool     `json:"builtin"`
+	Permissions []string `json:"permissions"`
+}
+
+type ListRolesResponse struct {
+	Roles []*RoleResponse `json:"roles"`
+}
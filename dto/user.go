@@ -1,37 +1,108 @@
 package dto
 
+import "time"
+
+// UserRequest is the sign up form, also used by admins to create customers.
+// Role is decided by the server and is never read from the request body.
 type UserRequest struct {
-	Username string  `json:"username"`
-	Password string  `json:"password"`
-	DOB      string  `json:"dob"`
-	Role     string  `json:"role"`
-	Chest    float32 `json:"chest"`
-	Waist    float32 `json:"waist"`
-	Hip      float32 `json:"hip"`
+	Username string  `json:"username" validate:"required,min=3,max=32"`
+	Email    string  `json:"email" validate:"required,email,max=254"`
+	Password string  `json:"password" validate:"required,min=8,max=72"`
+	DOB      string  `json:"dob" validate:"required,date,past"`
+	Role     string  `json:"-"`
+	Chest    float32 `json:"chest" validate:"gte=0,lte=300"`
+	Waist    float32 `json:"waist" validate:"gte=0,lte=300"`
+	Hip      float32 `json:"hip" validate:"gte=0,lte=300"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" validate:"required,max=254"`
+	Password string `json:"password" validate:"required,max=72"`
 }
 
 type ListUsersResponse struct {
 	Users []*UserResponse `json:"users"`
 }
 
+// EditUserReq lists the fields an admin may change on a customer, roles are assigned separately
 type EditUserReq struct {
-	ID       uint    `json:"id"`
-	Username string  `json:"username"`
-	Password string  `json:"password"`
-	DOB      string  `json:"dob"`
-	Role     string  `json:"role"`
-	Chest    float32 `json:"chest"`
-	Waist    float32 `json:"waist"`
-	Hip      float32 `json:"hip"`
+	ID       uint    `json:"id" validate:"required"`
+	Username string  `json:"username" validate:"omitempty,min=3,max=32"`
+	Email    string  `json:"email" validate:"omitempty,email,max=254"`
+	Password string  `json:"password" validate:"omitempty,min=8,max=72"`
+	DOB      string  `json:"dob" validate:"omitempty,date,past"`
+	Chest    float32 `json:"chest" validate:"gte=0,lte=300"`
+	Waist    float32 `json:"waist" validate:"gte=0,lte=300"`
+	Hip      float32 `json:"hip" validate:"gte=0,lte=300"`
+}
+
+// EditPersonalInfoRequest lists the fields a user may change on their own account.
+// Changing the email or password needs the current password.
+type EditPersonalInfoRequest struct {
+	Username        string  `json:"username" validate:"omitempty,min=3,max=32"`
+	Email           string  `json:"email" validate:"omitempty,email,max=254"`
+	Password        string  `json:"password" validate:"omitempty,min=8,max=72"`
+	CurrentPassword string  `json:"current_password" validate:"max=72"`
+	DOB             string  `json:"dob" validate:"omitempty,date,past"`
+	Chest           float32 `json:"chest" validate:"gte=0,lte=300"`
+	Waist           float32 `json:"waist" validate:"gte=0,lte=300"`
+	Hip             float32 `json:"hip" validate:"gte=0,lte=300"`
 }
 
 type UserResponse struct {
-	ID       uint    `json:"id"`
-	Username string  `json:"username"`
-	Password string  `json:"password"`
-	DOB      string  `json:"dob"`
-	Role     string  `json:"role"`
-	Chest    float32 `json:"chest"`
-	Waist    float32 `json:"waist"`
-	Hip      float32 `json:"hip"`
+	ID               uint       `json:"id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	EmailVerified    bool       `json:"email_verified"`
+	DOB              string     `json:"dob"`
+	Role             string     `json:"role"`
+	Chest            float32    `json:"chest"`
+	Waist            float32    `json:"waist"`
+	Hip              float32    `json:"hip"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UnlockAccountRequest clears the lock of the username, the IP or both
+type UnlockAccountRequest struct {
+	Username string `json:"username" validate:"max=254"`
+	IP       string `json:"ip" validate:"max=45"`
+}
+
+type LockoutEventResponse struct {
+	ID          uint      `json:"id"`
+	Kind        string    `json:"kind"`
+	Identifier  string    `json:"identifier"`
+	Event       string    `json:"event"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	IP          string    `json:"ip"`
+	Actor       string    `json:"actor"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type ListLockoutEventsResponse struct {
+	Events []*LockoutEventResponse `json:"events"`
+}
+
+type TwoFactorLoginResponse struct {
+	TwoFactorRequired      bool   `json:"two_factor_required"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required"`
+	ChallengeToken         string `json:"challenge_token"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code" validate:"max=16"`
+	RecoveryCode string `json:"recovery_code" validate:"max=32"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+	Token         string   `json:"token,omitempty"`
 }
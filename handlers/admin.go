@@ -1,10 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"future-fashion/dto"
 	"future-fashion/helpers"
+	"future-fashion/mappers"
 	"future-fashion/models"
 	"strconv"
 
@@ -15,6 +17,8 @@ import (
 	"gorm.io/gorm"
 )
 
+var errOutranked = helpers.NewForbiddenError("outranked", "NOTE: You cannot manage an account with permissions you do not have")
+
 type AdminHandlerActions interface {
 	CreateCustomer(w http.ResponseWriter, r *http.Request)
 	DeleteCustomer(w http.ResponseWriter, r *http.Request)
@@ -22,94 +26,189 @@ type AdminHandlerActions interface {
 	EditCustomers(w http.ResponseWriter, r *http.Request)
 	GetCustomerInfo(w http.ResponseWriter, r *http.Request)
 	AdminLogin(w http.ResponseWriter, r *http.Request)
+	UnlockAccount(w http.ResponseWriter, r *http.Request)
+	ListLockoutEvents(w http.ResponseWriter, r *http.Request)
+	VerifyTwoFactorLogin(w http.ResponseWriter, r *http.Request)
+	EnrollTwoFactor(w http.ResponseWriter, r *http.Request)
+	ConfirmTwoFactor(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	DisableTwoFactor(w http.ResponseWriter, r *http.Request)
+	ListRoles(w http.ResponseWriter, r *http.Request)
+	CreateRole(w http.ResponseWriter, r *http.Request)
+	EditRole(w http.ResponseWriter, r *http.Request)
+	DeleteRole(w http.ResponseWriter, r *http.Request)
+	AssignRole(w http.ResponseWriter, r *http.Request)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	ListAPIKeys(w http.ResponseWriter, r *http.Request)
+	RevokeAPIKey(w http.ResponseWriter, r *http.Request)
+	ListAuditLogs(w http.ResponseWriter, r *http.Request)
+	ListTrashedCustomers(w http.ResponseWriter, r *http.Request)
+	RestoreCustomer(w http.ResponseWriter, r *http.Request)
 }
 
 type AdminHandler struct {
-	UserModel       *models.UserCRUDOperationsImpl
-	CredentialModel *models.CredentialOperationsImpl
-	Logger          *zap.SugaredLogger
+	UserModel         models.UserCRUDOperation
+	CredentialModel   models.CredentialOperations
+	LoginAttemptModel models.LoginAttemptOperation
+	TwoFactorModel    models.TwoFactorOperation
+	RoleModel         models.RoleOperation
+	APIKeyModel       models.APIKeyOperation
+	AuditModel        models.AuditLogOperation
+	//when set every staff account has to enrol in two-factor authentication on the next login
+	Require2FA bool
+	Logger     *zap.SugaredLogger
 }
 
 // Login ...
 func (a *AdminHandler) AdminLogin(w http.ResponseWriter, r *http.Request) {
-	loginReq := &dto.UserRequest{}
-	err := json.NewDecoder(r.Body).Decode(loginReq)
+	loginReq := &dto.LoginRequest{}
+	err := helpers.DecodeJSON(r, loginReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	if loginReq.Username == "" || loginReq.Password == "" {
-		helpers.JsonResponse(
+	ip := helpers.ClientIP(r)
+	locked, err := loginLocked(a.LoginAttemptModel.WithContext(r.Context()), loginReq.Username, ip)
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Username or password cannot be empty",
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	foundUser, err := a.UserModel.GetByUsername(loginReq.Username)
-	if err != nil {
-		helpers.JsonResponse(
+	if locked {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: User does not exist. Please create a user account.",
-			nil,
+			r,
+			a.Logger,
+			errLockedOut,
 		)
 		return
 	}
 
-	if foundUser.Role != "admin" {
-		helpers.JsonResponse(
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByUsername(loginReq.Username)
+	if err != nil {
+		//compare against a dummy hash so unknown usernames take as long as wrong passwords
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(loginReq.Password))
+		recordLoginFailure(a.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), a.Logger), loginReq.Username, ip)
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"You are not admin",
-			nil,
+			r,
+			a.Logger,
+			errInvalidCredentials,
 		)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(loginReq.Password))
 	if err != nil {
-		helpers.JsonResponse(
+		recordLoginFailure(a.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), a.Logger), loginReq.Username, ip)
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Incorrect Password. Please try again.",
-			nil,
+			r,
+			a.Logger,
+			errInvalidCredentials,
 		)
 		return
 	}
 
-	token := helpers.NewClaim(
-		foundUser.ID,
-		foundUser.Username,
-		foundUser.Role,
-	)
+	//only roles with at least one permission may use the back office
+	permissions, err := a.RoleModel.WithContext(r.Context()).GetPermissions(foundUser.Role)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
 
-	tokenKey, err := a.CredentialModel.GetTokenKey()
+	if len(permissions) == 0 {
+		recordLoginFailure(a.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), a.Logger), loginReq.Username, ip)
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errInvalidCredentials,
+		)
+		return
+	}
+
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewInternalError(err),
+		)
+		return
+	}
+
+	//with two-factor authentication the password only earns a short lived challenge token,
+	//failures are reset once the second step succeeds
+	if foundUser.TOTPEnabled || a.Require2FA {
+		scope := helpers.ScopeTwoFactorVerify
+		if !foundUser.TOTPEnabled {
+			scope = helpers.ScopeTwoFactorEnroll
+		}
+
+		challengeToken, err := helpers.NewScopedClaim(
+			foundUser.ID,
+			foundUser.Username,
+			foundUser.Role,
+			scope,
+			twoFactorChallengeTTL,
+		).CreateToken(tokenKey)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewInternalError(err),
+			)
+			return
+		}
+
 		helpers.JsonResponse(
 			w,
-			"FAIL",
-			"NOTE: Failed to get token key",
-			nil,
+			"SUCCESS",
+			"NOTE: Two-factor authentication is required to complete the login",
+			&dto.TwoFactorLoginResponse{
+				TwoFactorRequired:      foundUser.TOTPEnabled,
+				TwoFactorSetupRequired: !foundUser.TOTPEnabled,
+				ChallengeToken:         challengeToken,
+			},
 		)
 		return
 	}
 
+	resetLoginFailures(a.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), a.Logger), loginReq.Username)
+
+	token := helpers.NewClaim(
+		foundUser.ID,
+		foundUser.Username,
+		foundUser.Role,
+		permissions,
+	)
+
 	tokenEncodedString, err := token.CreateToken(tokenKey)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Failed to create token",
-			nil,
+			r,
+			a.Logger,
+			helpers.NewInternalError(err),
 		)
 		return
 	}
@@ -123,121 +222,132 @@ func (a *AdminHandler) AdminLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *AdminHandler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := a.CredentialModel.GetTokenKey()
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionCustomersWrite) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 	newCustomer := &dto.UserRequest{}
-	err = json.NewDecoder(r.Body).Decode(newCustomer)
+	err = helpers.DecodeJSON(r, newCustomer)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	if newCustomer.Username == "" || newCustomer.Password == "" || newCustomer.DOB == "" {
-		helpers.JsonResponse(
+	_, err = a.UserModel.WithContext(r.Context()).GetByEmail(newCustomer.Email)
+	if err == nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Please fill in all the required information to sign up an accouont",
-			nil,
+			r,
+			a.Logger,
+			helpers.NewConflictError("email_taken", "NOTE: Email address is already registered"),
+		)
+		return
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newCustomer.Password), 8)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
 	newCustomer.Password = string(hashedPassword)
-	newCustomer.Role = "customer"
+	newCustomer.Role = helpers.RoleCustomer
 
-	dbUserRes, err := a.UserModel.Insert(newCustomer)
+	dbUserRes, err := a.UserModel.WithContext(r.Context()).Insert(newCustomer)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionCustomerCreate, models.AuditTargetUser, dbUserRes.ID, nil, mappers.User(dbUserRes))
 
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
 		fmt.Sprintf("%v is inserted successfully", dbUserRes.Username),
-		dbUserRes,
+		mappers.User(dbUserRes),
 	)
 }
 
 func (a *AdminHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := a.CredentialModel.GetTokenKey()
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionCustomersDelete) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
@@ -245,11 +355,11 @@ func (a *AdminHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
 	//retrieve parameter from url
 	param, ok := r.URL.Query()["id"]
 	if !ok || len(param[0]) < 1 {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Url param key not exist",
-			nil,
+			r,
+			a.Logger,
+			helpers.NewMissingParamError("id"),
 		)
 		return
 	}
@@ -257,169 +367,206 @@ func (a *AdminHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
 	// convert id to uint64 type
 	uintID, err := strconv.ParseUint(param[0], 10, 64)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
 		)
 		return
 	}
 
-	deletedUser, err := a.UserModel.Delete(uint(uintID))
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(uint(uintID))
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	err = a.checkCanManage(r.Context(), verifiedToken, foundUser)
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
+	deletedUser, err := a.UserModel.WithContext(r.Context()).Delete(foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionCustomerDelete, models.AuditTargetUser, deletedUser.ID, mappers.User(deletedUser), nil)
+
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
 		fmt.Sprintf("%v is deleted successfully", deletedUser.Username),
-		deletedUser,
+		mappers.User(deletedUser),
 	)
 }
 
 func (a *AdminHandler) ListCustomers(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := a.CredentialModel.GetTokenKey()
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionCustomersRead) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 
-	users, err := a.UserModel.GetAll()
+	users, err := a.UserModel.WithContext(r.Context()).GetAll()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	usersResponse := &dto.ListUsersResponse{
-		Users: []*dto.UserResponse{},
-	}
-
-	for _, user := range users {
-		usersResponse.Users = append(usersResponse.Users, &dto.UserResponse{
-			ID:       user.ID,
-			Username: user.Username,
-			Password: user.Password,
-			DOB:      user.DOB,
-			Role:     user.Role,
-			Chest:    user.Chest,
-			Waist:    user.Waist,
-			Hip:      user.Hip,
-		})
-	}
-
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
 		"SUCCESS",
-		usersResponse,
+		mappers.Users(users),
 	)
 }
 
 func (a *AdminHandler) EditCustomer(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := a.CredentialModel.GetTokenKey()
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionCustomersWrite) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 
 	//dto user does not have all user fields - etc: chest, waist, hip
 	editUserReq := &dto.EditUserReq{}
-	err = json.NewDecoder(r.Body).Decode(editUserReq)
+	err = helpers.DecodeJSON(r, editUserReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	// check if customer ID is provided
-	if editUserReq.ID == 0 {
-		helpers.JsonResponse(
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(editUserReq.ID)
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"User request ID does not exist",
-			nil,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	err = a.checkCanManage(r.Context(), verifiedToken, foundUser)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
+	if editUserReq.Email != "" {
+		existingUser, err := a.UserModel.WithContext(r.Context()).GetByEmail(editUserReq.Email)
+		if err == nil && existingUser.ID != editUserReq.ID {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewConflictError("email_taken", "NOTE: Email address is already registered"),
+			)
+			return
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				err,
+			)
+			return
+		}
+	}
+
 	var hashedPassword []byte
 	if editUserReq.Password != "" {
 		hashedPassword, err = bcrypt.GenerateFromPassword([]byte(editUserReq.Password), 8)
 		if err != nil {
-			helpers.JsonResponse(
+			helpers.ErrorResponse(
 				w,
-				"FAIL",
-				err.Error(),
-				nil,
+				r,
+				a.Logger,
+				err,
 			)
 			return
 		}
@@ -428,43 +575,80 @@ func (a *AdminHandler) EditCustomer(w http.ResponseWriter, r *http.Request) {
 
 	userModel, err := a.convertEditUserDTOToUserModel(editUserReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	dbUserRes, err := a.UserModel.Update(userModel)
+	dbUserRes, err := a.UserModel.WithContext(r.Context()).Update(userModel)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionCustomerUpdate, models.AuditTargetUser, dbUserRes.ID, mappers.User(foundUser), mappers.User(dbUserRes))
+	//the password hash is not part of the dto, so a reset gets its own entry
+	if editUserReq.Password != "" {
+		recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionCustomerPasswordReset, models.AuditTargetUser, dbUserRes.ID, nil, nil)
+	}
 
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
 		fmt.Sprintf("%v is updated successfully", dbUserRes.Username),
-		dbUserRes,
+		mappers.User(dbUserRes),
 	)
 }
 
 func (a *AdminHandler) GetCustomerInfo(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionCustomersRead) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
 	//retrieve parameter from url
 	param, ok := r.URL.Query()["id"]
 	if !ok || len(param[0]) < 1 {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Url param key not exist",
-			nil,
+			r,
+			a.Logger,
+			helpers.NewMissingParamError("id"),
 		)
 		return
 	}
@@ -472,53 +656,357 @@ func (a *AdminHandler) GetCustomerInfo(w http.ResponseWriter, r *http.Request) {
 	// convert id to uint64 type
 	uintID, err := strconv.ParseUint(param[0], 10, 64)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
 		)
 		return
 	}
 
-	foundUser, err := a.UserModel.GetByID(uint(uintID))
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(uint(uintID))
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	err = a.checkCanManage(r.Context(), verifiedToken, foundUser)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"SUCCESS",
+		mappers.User(foundUser),
+	)
+}
+
+func (a *AdminHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionAccountsUnlock) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	unlockReq := &dto.UnlockAccountRequest{}
+	err = helpers.DecodeJSON(r, unlockReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if unlockReq.Username == "" && unlockReq.IP == "" {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewValidationError("missing_fields", "NOTE: Username or IP is required"),
+		)
+		return
+	}
+
+	if unlockReq.Username != "" {
+		err = a.LoginAttemptModel.WithContext(r.Context()).Unlock(models.ThrottleKindAccount, loginAccountKey(unlockReq.Username), verifiedToken.Username)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				err,
+			)
+			return
+		}
+		//the username is personal data and would outlive an erasure, the log keeps the user id
+		foundUser, err := a.UserModel.WithContext(r.Context()).GetByUsername(unlockReq.Username)
+		switch {
+		case err == nil:
+			recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionAccountUnlock, models.AuditTargetUser, foundUser.ID, nil, nil)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionAccountUnlock, models.AuditTargetAccount, models.ThrottleKindAccount, nil, nil)
+		default:
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				err,
+			)
+			return
+		}
+	}
+
+	if unlockReq.IP != "" {
+		err = a.LoginAttemptModel.WithContext(r.Context()).Unlock(models.ThrottleKindIP, unlockReq.IP, verifiedToken.Username)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				err,
+			)
+			return
+		}
+		recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionAccountUnlock, models.AuditTargetAccount, models.ThrottleKindIP+":"+unlockReq.IP, nil, nil)
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"Account is unlocked successfully",
+		nil,
+	)
+}
+
+func (a *AdminHandler) ListLockoutEvents(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			a.Logger,
+			err,
 		)
 		return
 	}
 
-	userRes := &dto.UserResponse{
-		ID:       foundUser.ID,
-		Username: foundUser.Username,
-		Password: foundUser.Password,
-		DOB:      foundUser.DOB,
-		Role:     foundUser.Role,
-		Chest:    foundUser.Chest,
-		Waist:    foundUser.Waist,
-		Hip:      foundUser.Hip,
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionAccountsUnlock) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	events, err := a.LoginAttemptModel.WithContext(r.Context()).GetLockoutEvents(100)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
 	}
 
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
-		fmt.Sprintf("%v is deleted successfully", userRes.Username),
-		userRes,
+		"SUCCESS",
+		mappers.LockoutEvents(events),
 	)
 }
 
+func (a *AdminHandler) ListTrashedCustomers(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionCustomersDelete) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	users, err := a.UserModel.WithContext(r.Context()).GetTrashed()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"SUCCESS",
+		mappers.Users(users),
+	)
+}
+
+func (a *AdminHandler) RestoreCustomer(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionCustomersDelete) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	//retrieve parameter from url
+	param, ok := r.URL.Query()["id"]
+	if !ok || len(param[0]) < 1 {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewMissingParamError("id"),
+		)
+		return
+	}
+
+	// convert id to uint64 type
+	uintID, err := strconv.ParseUint(param[0], 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
+		)
+		return
+	}
+
+	restoredUser, err := a.UserModel.WithContext(r.Context()).Restore(uint(uintID))
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionCustomerRestore, models.AuditTargetUser, restoredUser.ID, nil, mappers.User(restoredUser))
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is restored successfully", restoredUser.Username),
+		mappers.User(restoredUser),
+	)
+}
+
+// checkCanManage refuses to act on an account whose role grants a permission the caller
+// lacks, otherwise customers:write would be enough to take over a super-admin ...
+func (a *AdminHandler) checkCanManage(ctx context.Context, caller *helpers.Claims, target *models.User) error {
+	if target.Role == helpers.RoleCustomer {
+		return nil
+	}
+	permissions, err := a.RoleModel.WithContext(ctx).GetPermissions(target.Role)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if !caller.HasPermission(permission) {
+			return errOutranked
+		}
+	}
+	return nil
+}
+
 func (a *AdminHandler) convertEditUserDTOToUserModel(userReq *dto.EditUserReq) (*models.User, error) {
 	return &models.User{
 		Model: gorm.Model{
 			ID: userReq.ID,
 		},
 		Username: userReq.Username,
+		Email:    userReq.Email,
 		Password: userReq.Password,
-		Role:     userReq.Role,
 		DOB:      userReq.DOB,
 		Chest:    userReq.Chest,
 		Waist:    userReq.Waist,
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/mappers"
+	"future-fashion/models"
+)
+
+const defaultAPIKeyExpiryDays = 365
+
+func (a *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionAPIKeysManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	apiKeyReq := &dto.CreateAPIKeyRequest{}
+	err = helpers.DecodeJSON(r, apiKeyReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(apiKeyReq.UserID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	permissions, err := a.RoleModel.WithContext(r.Context()).GetPermissions(foundUser.Role)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	//a key can never do more than its owner's role allows
+	owner := helpers.NewClaim(foundUser.ID, foundUser.Username, foundUser.Role, permissions)
+	for _, scope := range apiKeyReq.Scopes {
+		if !helpers.IsKnownScope(scope) {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewValidationError("unknown_scope", fmt.Sprintf("NOTE: Unknown scope %v", scope), helpers.FieldError{Field: "scopes", Message: fmt.Sprintf("%v is not a known scope", scope)}),
+			)
+			return
+		}
+		if helpers.IsKnownPermission(scope) && !owner.HasPermission(scope) {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewValidationError("scope_not_granted", fmt.Sprintf("NOTE: Role %v does not grant %v", foundUser.Role, scope), helpers.FieldError{Field: "scopes", Message: fmt.Sprintf("%v is not granted by the role of the user", scope)}),
+			)
+			return
+		}
+		//nor more than the issuer could do
+		if helpers.IsKnownPermission(scope) && !verifiedToken.HasPermission(scope) {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewForbiddenError("scope_not_held", fmt.Sprintf("NOTE: You cannot grant %v, you do not have it", scope)),
+			)
+			return
+		}
+	}
+
+	//a key acts as its owner, so it is a way to manage the owner's account
+	err = a.checkCanManage(r.Context(), verifiedToken, foundUser)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	key, apiKey, err := models.GenerateAPIKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	expiresInDays := apiKeyReq.ExpiresInDays
+	if expiresInDays == 0 {
+		expiresInDays = defaultAPIKeyExpiryDays
+	}
+	expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+
+	apiKey.Name = apiKeyReq.Name
+	apiKey.UserID = foundUser.ID
+	apiKey.Scopes = strings.Join(apiKeyReq.Scopes, " ")
+	apiKey.ExpiresAt = &expiresAt
+
+	dbAPIKeyRes, err := a.APIKeyModel.WithContext(r.Context()).Insert(apiKey)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionAPIKeyCreate, models.AuditTargetAPIKey, dbAPIKeyRes.ID, nil, mappers.APIKey(dbAPIKeyRes))
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is created successfully, the key is only shown once", dbAPIKeyRes.Prefix),
+		&dto.CreateAPIKeyResponse{
+			APIKeyResponse: *mappers.APIKey(dbAPIKeyRes),
+			Key:            key,
+		},
+	)
+}
+
+func (a *AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionAPIKeysManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	//optional filter by owner
+	var userID uint64
+	param, ok := r.URL.Query()["user_id"]
+	if ok && len(param[0]) > 0 {
+		userID, err = strconv.ParseUint(param[0], 10, 64)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewInvalidParamError("user_id", "NOTE: user_id must be a positive number"),
+			)
+			return
+		}
+	}
+
+	apiKeys, err := a.APIKeyModel.WithContext(r.Context()).GetAll(uint(userID))
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"SUCCESS",
+		mappers.APIKeys(apiKeys),
+	)
+}
+
+func (a *AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionAPIKeysManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	//retrieve parameter from url
+	param, ok := r.URL.Query()["id"]
+	if !ok || len(param[0]) < 1 {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewMissingParamError("id"),
+		)
+		return
+	}
+
+	// convert id to uint64 type
+	uintID, err := strconv.ParseUint(param[0], 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
+		)
+		return
+	}
+
+	foundKey, err := a.APIKeyModel.WithContext(r.Context()).GetByID(uint(uintID))
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	revokedKey, err := a.APIKeyModel.WithContext(r.Context()).Revoke(uint(uintID))
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionAPIKeyRevoke, models.AuditTargetAPIKey, revokedKey.ID, mappers.APIKey(foundKey), mappers.APIKey(revokedKey))
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is revoked successfully", revokedKey.Prefix),
+		mappers.APIKey(revokedKey),
+	)
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"future-fashion/helpers"
+	"future-fashion/mappers"
+	"future-fashion/models"
+
+	"go.uber.org/zap"
+)
+
+// recordAudit appends an audit log entry for a mutating staff operation. before and after are
+// the mapped response dtos, so hashes and secrets never reach the log. The log cannot be changed,
+// so personal data of users is left out, see redactPersonalFields. A failed write is logged and
+// does not fail the request, the change has already been made.
+func recordAudit(auditModel models.AuditLogOperation, logger *zap.SugaredLogger, r *http.Request, actor *helpers.Claims, action, targetType string, targetID interface{}, before, after interface{}) {
+	entry := &models.AuditLog{
+		ActorID:    actor.Id,
+		ActorRole:  actor.Role,
+		ViaAPIKey:  actor.APIKeyScopes != nil,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		IP:         helpers.ClientIP(r),
+	}
+	//customers act on their own account only, the id is enough and outlives an erasure
+	if actor.IsStaff() {
+		entry.ActorUsername = actor.Username
+	}
+
+	beforeFields, err := auditFields(before)
+	if err == nil {
+		var afterFields map[string]interface{}
+		afterFields, err = auditFields(after)
+		if err == nil {
+			var diff map[string]interface{}
+			if beforeFields != nil || afterFields != nil {
+				diff = auditDiff(beforeFields, afterFields)
+			}
+			if targetType == models.AuditTargetUser {
+				redactPersonalFields(beforeFields, afterFields, diff)
+			}
+			entry.Before = auditJSON(beforeFields)
+			entry.After = auditJSON(afterFields)
+			entry.Diff = auditJSON(diff)
+		}
+	}
+	if err != nil {
+		helpers.Logger(r.Context(), logger).Errorw("failed to encode audit state", "action", action, "error", err)
+	}
+
+	_, err = auditModel.Insert(entry)
+	if err != nil {
+		helpers.Logger(r.Context(), logger).Errorw("failed to write audit log", "action", action, "actor", actor.Username, "target", entry.TargetID, "error", err)
+	}
+}
+
+// round trips through json so the diff uses the same field names as the api
+func auditFields(state interface{}) (map[string]interface{}, error) {
+	if state == nil || reflect.ValueOf(state).Kind() == reflect.Ptr && reflect.ValueOf(state).IsNil() {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	err = json.Unmarshal(encoded, &fields)
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// only the fields that changed, as {"field": {"before": x, "after": y}}
+func auditDiff(before, after map[string]interface{}) map[string]interface{} {
+	diff := map[string]interface{}{}
+	for field, value := range before {
+		if !reflect.DeepEqual(value, after[field]) {
+			diff[field] = map[string]interface{}{"before": value, "after": after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			diff[field] = map[string]interface{}{"before": nil, "after": value}
+		}
+	}
+	return diff
+}
+
+// auditPersonalFields are the fields of a user that identify or describe the person ...
+var auditPersonalFields = []string{"username", "email", "dob", "chest", "waist", "hip"}
+
+const auditRedacted = "[redacted]"
+
+// redactPersonalFields drops the personal fields from the states of a user, the diff only
+// keeps the names of the ones that changed. An erased user leaves nothing behind in the log.
+func redactPersonalFields(before, after, diff map[string]interface{}) {
+	for _, field := range auditPersonalFields {
+		delete(before, field)
+		delete(after, field)
+		if _, ok := diff[field]; ok {
+			diff[field] = map[string]interface{}{"before": auditRedacted, "after": auditRedacted}
+		}
+	}
+}
+
+func auditJSON(fields map[string]interface{}) string {
+	if fields == nil {
+		return ""
+	}
+	encoded, _ := json.Marshal(fields)
+	return string(encoded)
+}
+
+// List Audit Logs filters by actor_id, action, target_type, target_id, since and until (RFC 3339) ...
+func (a *AdminHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionAuditRead) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := &models.AuditLogFilter{
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+	}
+
+	for param, target := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if query.Get(param) == "" {
+			continue
+		}
+		*target, err = strconv.Atoi(query.Get(param))
+		if err != nil || *target < 0 {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewInvalidParamError(param, fmt.Sprintf("NOTE: %v must be a positive number", param)),
+			)
+			return
+		}
+	}
+
+	if query.Get("actor_id") != "" {
+		actorID, err := strconv.ParseUint(query.Get("actor_id"), 10, 64)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewInvalidParamError("actor_id", "NOTE: actor_id must be a number"),
+			)
+			return
+		}
+		filter.ActorID = uint(actorID)
+	}
+
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if query.Get(param) == "" {
+			continue
+		}
+		*target, err = time.Parse(time.RFC3339, query.Get(param))
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewInvalidParamError(param, fmt.Sprintf("NOTE: %v must be an RFC 3339 timestamp", param)),
+			)
+			return
+		}
+	}
+
+	entries, err := a.AuditModel.WithContext(r.Context()).Find(filter)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"SUCCESS",
+		mappers.AuditLogs(entries),
+	)
+}
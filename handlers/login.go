@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+var (
+	//same error for unknown user, wrong role and wrong password so usernames cannot be probed
+	errInvalidCredentials = helpers.NewUnauthorizedError("invalid_credentials", "NOTE: Invalid username or password")
+	errLockedOut          = helpers.NewTooManyRequestsError("login_locked", "NOTE: Too many failed login attempts. Please try again later.")
+)
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("future-fashion"), 8)
+
+func loginAccountKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// loginLocked reports whether the account or the client IP is currently blocked ...
+func loginLocked(loginAttemptModel models.LoginAttemptOperation, username, ip string) (bool, error) {
+	lockedUntil, err := loginAttemptModel.GetLockedUntil(models.ThrottleKindAccount, loginAccountKey(username))
+	if err != nil {
+		return false, err
+	}
+	if !lockedUntil.IsZero() {
+		return true, nil
+	}
+
+	lockedUntil, err = loginAttemptModel.GetLockedUntil(models.ThrottleKindIP, ip)
+	if err != nil {
+		return false, err
+	}
+	return !lockedUntil.IsZero(), nil
+}
+
+func recordLoginFailure(loginAttemptModel models.LoginAttemptOperation, logger *zap.SugaredLogger, username, ip string) {
+	_, err := loginAttemptModel.RecordFailure(models.ThrottleKindAccount, loginAccountKey(username), ip)
+	if err != nil {
+		logger.Errorw("failed to record login failure", "kind", models.ThrottleKindAccount, "error", err)
+	}
+
+	_, err = loginAttemptModel.RecordFailure(models.ThrottleKindIP, ip, ip)
+	if err != nil {
+		logger.Errorw("failed to record login failure", "kind", models.ThrottleKindIP, "error", err)
+	}
+}
+
+func resetLoginFailures(loginAttemptModel models.LoginAttemptOperation, logger *zap.SugaredLogger, username string) {
+	err := loginAttemptModel.Reset(models.ThrottleKindAccount, loginAccountKey(username))
+	if err != nil {
+		logger.Errorw("failed to reset login failures", "error", err)
+	}
+}
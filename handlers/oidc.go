@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/metrics"
+	"future-fashion/models"
+
+	"gorm.io/gorm"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var oidcUsernameCleaner = regexp.MustCompile(`[^a-z0-9]+`)
+
+// staff accounts must use the admin login with its second factor
+var errProviderLoginNotAllowed = helpers.NewForbiddenError("provider_login_not_allowed", "NOTE: This account cannot sign in with a login provider")
+
+// OIDC Login redirects the user to the login page of the provider in the query param ...
+func (u *UserHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := u.OIDCProviders[r.URL.Query().Get("provider")]
+	if !ok {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewNotFoundError("unknown_provider", "NOTE: Unknown login provider"),
+		)
+		return
+	}
+
+	state, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	nonce, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	codeVerifier, codeChallenge, err := helpers.NewPKCE()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(state, nonce, codeChallenge)
+	if err != nil {
+		helpers.Logger(r.Context(), u.Logger).Errorw("oidc discovery failed", "provider", provider.Name, "error", err)
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewUnavailableError("provider_unavailable", "NOTE: Login provider is not available"),
+		)
+		return
+	}
+
+	_, err = u.OIDCModel.WithContext(r.Context()).SaveState(&models.OIDCLoginState{
+		State:        state,
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	})
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDC Callback finishes the login, links or creates the user and returns our usual token ...
+func (u *UserHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	//providers send the result as query params, or as a form post with response_mode=form_post
+	if providerErr := r.FormValue("error"); providerErr != "" {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewUnauthorizedError("provider_login_failed", fmt.Sprintf("NOTE: Login was not completed (%v)", providerErr)),
+		)
+		return
+	}
+
+	state := r.FormValue("state")
+	code := r.FormValue("code")
+	if state == "" || code == "" {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewValidationError("missing_parameter", "NOTE: Login callback is missing the state or code"),
+		)
+		return
+	}
+
+	loginState, err := u.OIDCModel.WithContext(r.Context()).ConsumeState(state)
+	if err != nil || time.Now().After(loginState.ExpiresAt) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewValidationError("invalid_login_state", "NOTE: Login session is invalid or has expired, please try again"),
+		)
+		return
+	}
+
+	provider, ok := u.OIDCProviders[loginState.Provider]
+	if !ok {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewNotFoundError("unknown_provider", "NOTE: Unknown login provider"),
+		)
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(code, loginState.CodeVerifier)
+	if err != nil {
+		helpers.Logger(r.Context(), u.Logger).Warnw("oidc code exchange failed", "provider", provider.Name, "error", err)
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewUnauthorizedError("provider_login_failed", "NOTE: Login could not be completed with the provider"),
+		)
+		return
+	}
+
+	identity, err := provider.VerifyIDToken(rawIDToken, loginState.Nonce)
+	if err != nil {
+		helpers.Logger(r.Context(), u.Logger).Warnw("oidc id token rejected", "provider", provider.Name, "error", err)
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewUnauthorizedError("provider_login_failed", "NOTE: Login could not be completed with the provider"),
+		)
+		return
+	}
+
+	foundUser, err := u.findOrCreateOIDCUser(r.Context(), provider.Name, identity)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	token := helpers.NewClaim(
+		foundUser.ID,
+		foundUser.Username,
+		foundUser.Role,
+		nil,
+	)
+
+	tokenKey, err := u.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewInternalError(err),
+		)
+		return
+	}
+
+	tokenEncodedString, err := token.CreateToken(tokenKey)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewInternalError(err),
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v logged in successfully", foundUser.Username),
+		tokenEncodedString,
+	)
+}
+
+func (u *UserHandler) findOrCreateOIDCUser(ctx context.Context, provider string, identity *helpers.OIDCIdentity) (*models.User, error) {
+	linked, err := u.OIDCModel.WithContext(ctx).GetIdentity(provider, identity.Subject)
+	if err == nil {
+		linkedUser, err := u.UserModel.WithContext(ctx).GetByID(linked.UserID)
+		if err != nil {
+			return nil, err
+		}
+		//the account may have been given a staff role after it was linked
+		if linkedUser.Role != helpers.RoleCustomer {
+			return nil, errProviderLoginNotAllowed
+		}
+		return linkedUser, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	//without a verified email we cannot tell whose account this is
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, helpers.NewForbiddenError("unverified_provider_email", "NOTE: Your login provider did not share a verified email address")
+	}
+
+	foundUser, err := u.UserModel.WithContext(ctx).GetByEmail(identity.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if foundUser != nil {
+		//only link to accounts that proved they own the address, otherwise anyone could
+		//pre-register the email and take over the account later
+		if !foundUser.EmailVerified {
+			return nil, helpers.NewConflictError("email_taken", "NOTE: An account with this email already exists, please log in with your password and verify your email first")
+		}
+		//checked before linking, a staff account never gets an identity it cannot use
+		if foundUser.Role != helpers.RoleCustomer {
+			return nil, errProviderLoginNotAllowed
+		}
+	} else {
+		foundUser, err = u.createOIDCUser(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = u.OIDCModel.WithContext(ctx).LinkIdentity(&models.UserIdentity{
+		UserID:   foundUser.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return foundUser, nil
+}
+
+func (u *UserHandler) createOIDCUser(ctx context.Context, identity *helpers.OIDCIdentity) (*models.User, error) {
+	//usernames are derived from the email, the suffix keeps them unique
+	base := strings.Split(strings.ToLower(identity.Email), "@")[0]
+	base = oidcUsernameCleaner.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 32 {
+		base = base[:32]
+	}
+
+	suffix, err := helpers.GenerateRandomToken(3)
+	if err != nil {
+		return nil, err
+	}
+
+	//no password is set, so the account can only sign in through its provider
+	newUser, err := u.UserModel.WithContext(ctx).Insert(&dto.UserRequest{
+		Username: base + "-" + suffix,
+		Email:    identity.Email,
+		Role:     helpers.RoleCustomer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.Metrics.SignedUp(metrics.SignupOIDC)
+
+	//the provider already verified the address
+	return u.UserModel.WithContext(ctx).MarkEmailVerified(newUser.ID)
+}
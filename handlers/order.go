@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"future-fashion/dto"
 	"future-fashion/helpers"
+	"future-fashion/mappers"
 	"future-fashion/models"
 	"net/http"
 	"strconv"
@@ -19,68 +21,146 @@ type OrderHandlerActions interface {
 	ListOrders(w http.ResponseWriter, r *http.Request)
 	ListOrdersByUserID(w http.ResponseWriter, r *http.Request)
 	EditOrderStatus(w http.ResponseWriter, r *http.Request)
+	ListTrashedOrders(w http.ResponseWriter, r *http.Request)
+	RestoreOrder(w http.ResponseWriter, r *http.Request)
 }
 
 type OrderHandler struct {
-	OrderModel      *models.OrderCRUDOperationsImpl
-	CredentialModel *models.CredentialOperationsImpl
+	OrderModel      models.OrderCRUDOperation
+	ProductModel    models.ProductCRUDOperation
+	UserModel       models.UserCRUDOperation
+	CredentialModel models.CredentialOperations
+	APIKeyModel     models.APIKeyOperation
+	AuditModel      models.AuditLogOperation
 	Logger          *zap.SugaredLogger
 }
 
 func (o *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := o.CredentialModel.GetTokenKey()
+	tokenKey, err := o.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, o.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
-	var orderReq *dto.OrderRequest
-	err = json.NewDecoder(r.Body).Decode(&orderReq)
+
+	if !verifiedToken.InScope(helpers.ScopeOrdersPlace) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	user, err := o.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	if !user.EmailVerified {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			helpers.NewForbiddenError("email_not_verified", "NOTE: Please verify your email address before checking out"),
+		)
+		return
+	}
+
+	orderReq := &dto.OrderRequest{}
+	err = helpers.DecodeJSON(r, orderReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 	orderReq.UserID = verifiedToken.Id
-	orderReq.Status = "Order is comfirmed"
+	orderReq.Status = models.OrderStatusConfirmed
 
 	orderModel, err := o.convertOrderDTOToOrderModel(orderReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	dbOrderRes, err := o.OrderModel.Insert(orderModel)
+	quantities, err := cartQuantities(orderReq.Snapshots)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	err = o.ProductModel.WithContext(r.Context()).TakeStock(quantities)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = helpers.NewValidationError("unknown_product", "NOTE: A product in the cart no longer exists", helpers.FieldError{Field: "snapshots", Message: "a product in the cart no longer exists"})
+	}
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	dbOrderRes, err := o.OrderModel.WithContext(r.Context()).Insert(orderModel)
+	if err != nil {
+		returnErr := o.ProductModel.WithContext(r.Context()).ReturnStock(quantities)
+		if returnErr != nil {
+			helpers.Logger(r.Context(), o.Logger).Errorw("failed to return the stock of a failed checkout", "error", returnErr)
+		}
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	orderRes, err := mappers.Order(dbOrderRes)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
@@ -88,40 +168,40 @@ func (o *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
-		fmt.Sprintf("%v is inserted successfully", dbOrderRes.ID),
-		convertOrderModelToCreateOrderRes(dbOrderRes),
+		fmt.Sprintf("%v is inserted successfully", orderRes.ID),
+		orderRes,
 	)
 }
 
 func (o *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := o.CredentialModel.GetTokenKey()
+	tokenKey, err := o.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, o.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionOrdersDelete) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
@@ -129,11 +209,11 @@ func (o *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	//retrieve parameter from url
 	param, ok := r.URL.Query()["id"]
 	if !ok || len(param[0]) < 1 {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Url param key not exist",
-			nil,
+			r,
+			o.Logger,
+			helpers.NewMissingParamError("id"),
 		)
 		return
 	}
@@ -141,101 +221,100 @@ func (o *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	// convert id to uint64 type
 	uintID, err := strconv.ParseUint(param[0], 10, 64)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
 		)
 		return
 	}
 
-	deletedOrder, err := o.OrderModel.Delete(uint(uintID))
+	deletedOrder, err := o.OrderModel.WithContext(r.Context()).Delete(uint(uintID))
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
+	orderRes, err := mappers.Order(deletedOrder)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(o.AuditModel.WithContext(r.Context()), o.Logger, r, verifiedToken, models.AuditActionOrderDelete, models.AuditTargetOrder, deletedOrder.ID, orderRes, nil)
+
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
-		fmt.Sprintf("%v is deleted successfully", deletedOrder),
-		deletedOrder,
+		fmt.Sprintf("%v is deleted successfully", orderRes.ID),
+		orderRes,
 	)
 
 }
 
 func (o *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := o.CredentialModel.GetTokenKey()
+	tokenKey, err := o.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, o.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionOrdersRead) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 
-	orders, err := o.OrderModel.GetAll()
+	orders, err := o.OrderModel.WithContext(r.Context()).GetAll()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	orderResponse := &dto.ListOrdersResponse{
-		Orders: []*dto.OrderResponse{},
-	}
-	for _, order := range orders {
-		snapshotsObj, err := unmarshalSnapshots(order.Snapshots)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-		orderResponse.Orders = append(orderResponse.Orders, &dto.OrderResponse{
-			ID:        order.ID,
-			Total:     order.Total,
-			Status:    order.Status,
-			Snapshots: snapshotsObj,
-			UserID:    order.UserID,
-			CreatedAt: order.CreatedAt,
-		})
+	orderResponse, err := mappers.Orders(orders)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
 	}
 
 	helpers.JsonResponse(
@@ -247,60 +326,58 @@ func (o *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 }
 
 func (o *OrderHandler) ListOrdersByUserID(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := o.CredentialModel.GetTokenKey()
+	tokenKey, err := o.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, o.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	orders, err := o.OrderModel.GetByUserID(verifiedToken.Id)
-	if err != nil {
-		helpers.JsonResponse(
+	if !verifiedToken.InScope(helpers.ScopeOrdersOwn) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 
-	orderResponse := &dto.ListOrdersResponse{
-		Orders: []*dto.OrderResponse{},
+	orders, err := o.OrderModel.WithContext(r.Context()).GetByUserID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
 	}
-	for _, order := range orders {
-		snapshotsObj, err := unmarshalSnapshots(order.Snapshots)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-		orderResponse.Orders = append(orderResponse.Orders, &dto.OrderResponse{
-			ID:        order.ID,
-			Total:     order.Total,
-			Status:    order.Status,
-			Snapshots: snapshotsObj,
-			CreatedAt: order.CreatedAt,
-		})
+
+	orderResponse, err := mappers.Orders(orders)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
 	}
 
 	helpers.JsonResponse(
@@ -312,88 +389,274 @@ func (o *OrderHandler) ListOrdersByUserID(w http.ResponseWriter, r *http.Request
 }
 
 func (o *OrderHandler) EditOrderStatus(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := o.CredentialModel.GetTokenKey()
+	tokenKey, err := o.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, o.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionOrdersUpdateStatus) && !verifiedToken.HasPermission(helpers.PermissionOrdersCancel) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 
 	updateOrderReq := &dto.EditOrderRequest{}
-	err = json.NewDecoder(r.Body).Decode(updateOrderReq)
+	err = helpers.DecodeJSON(r, updateOrderReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
 	//check if order ID is provided
-	if updateOrderReq.ID == 0 {
-		helpers.JsonResponse(
+	//staff with only the cancel permission may not move orders to any other status
+	if !verifiedToken.HasPermission(helpers.PermissionOrdersUpdateStatus) && updateOrderReq.Status != models.OrderStatusCancelled {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	foundOrder, err := o.OrderModel.WithContext(r.Context()).GetByID(updateOrderReq.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	beforeRes, err := mappers.Order(foundOrder)
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Order request ID does not exist",
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
 	orderModel, err := o.convertEditOrderDTOToOrderModel(updateOrderReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	dbOrderRes, err := o.OrderModel.WithContext(r.Context()).Update(orderModel)
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
 
-	dbOrderRes, err := o.OrderModel.Update(orderModel)
+	orderRes, err := mappers.Order(dbOrderRes)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			o.Logger,
+			err,
 		)
 		return
 	}
+	recordAudit(o.AuditModel.WithContext(r.Context()), o.Logger, r, verifiedToken, models.AuditActionOrderUpdateStatus, models.AuditTargetOrder, dbOrderRes.ID, beforeRes, orderRes)
 
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
 		"SUCCESS",
-		dbOrderRes,
+		orderRes,
+	)
+}
+
+func (o *OrderHandler) ListTrashedOrders(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := o.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, o.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionOrdersDelete) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	orders, err := o.OrderModel.WithContext(r.Context()).GetTrashed()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	ordersResponse, err := mappers.Orders(orders)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"SUCCESS",
+		ordersResponse,
+	)
+}
+
+func (o *OrderHandler) RestoreOrder(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := o.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, o.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionOrdersDelete) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	//retrieve parameter from url
+	param, ok := r.URL.Query()["id"]
+	if !ok || len(param[0]) < 1 {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			helpers.NewMissingParamError("id"),
+		)
+		return
+	}
+
+	// convert id to uint64 type
+	uintID, err := strconv.ParseUint(param[0], 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
+		)
+		return
+	}
+
+	restoredOrder, err := o.OrderModel.WithContext(r.Context()).Restore(uint(uintID))
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+
+	orderRes, err := mappers.Order(restoredOrder)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			o.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(o.AuditModel.WithContext(r.Context()), o.Logger, r, verifiedToken, models.AuditActionOrderRestore, models.AuditTargetOrder, restoredOrder.ID, nil, orderRes)
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is restored successfully", orderRes.ID),
+		orderRes,
 	)
 }
 
@@ -403,10 +666,23 @@ func (o *OrderHandler) convertEditOrderDTOToOrderModel(orderReq *dto.EditOrderRe
 			ID: orderReq.ID,
 		},
 		Status: orderReq.Status,
-		UserID: orderReq.UserID,
 	}, nil
 }
 
+// cartQuantities adds up the quantity ordered of every product, a product can be in the cart in several sizes
+func cartQuantities(snapshots []*dto.CartModel) (map[uint]int, error) {
+	quantities := map[uint]int{}
+	for i, line := range snapshots {
+		id, err := strconv.ParseUint(line.Id, 10, 64)
+		if err != nil || id == 0 {
+			field := fmt.Sprintf("snapshots[%v].id", i)
+			return nil, helpers.NewValidationError("invalid_product", fmt.Sprintf("NOTE: %v is not a product id", line.Id), helpers.FieldError{Field: field, Message: "must be a product id"})
+		}
+		quantities[uint(id)] += line.Quantity
+	}
+	return quantities, nil
+}
+
 func (o *OrderHandler) convertOrderDTOToOrderModel(orderReq *dto.OrderRequest) (*models.Order, error) {
 	snapshotJsonByte, err := json.Marshal(orderReq.Snapshots)
 	if err != nil {
@@ -420,19 +696,3 @@ func (o *OrderHandler) convertOrderDTOToOrderModel(orderReq *dto.OrderRequest) (
 		UserID:    orderReq.UserID,
 	}, nil
 }
-
-func convertOrderModelToCreateOrderRes(orderModel *models.Order) *dto.OrderResponse {
-	return &dto.OrderResponse{
-		Total:  orderModel.Total,
-		Status: orderModel.Status,
-	}
-}
-
-func unmarshalSnapshots(snapshots string) ([]*dto.CartModel, error) {
-	var cartModels []*dto.CartModel
-	err := json.Unmarshal([]byte(snapshots), &cartModels)
-	if err != nil {
-		return nil, err
-	}
-	return cartModels, nil
-}
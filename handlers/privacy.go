@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/mappers"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type archiveEntry struct {
+	name    string
+	content interface{}
+}
+
+// Export Data sends the caller a zip archive of everything we store about them ...
+func (u *UserHandler) ExportData(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := u.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	//api keys cannot export, the archive holds more than any key scope allows
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, u.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	foundUser, err := u.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	orders, err := u.OrderModel.WithContext(r.Context()).GetByUserID(foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	ordersResponse, err := mappers.Orders(orders)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	identities, err := u.OIDCModel.WithContext(r.Context()).GetIdentitiesByUserID(foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	apiKeys, err := u.APIKeyModel.WithContext(r.Context()).GetAll(foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	entries := []archiveEntry{
+		{"profile.json", mappers.User(foundUser)},
+		{"measurements.json", mappers.Measurements(foundUser)},
+		{"orders.json", ordersResponse},
+		{"login_providers.json", mappers.UserIdentities(identities)},
+		{"api_keys.json", mappers.APIKeys(apiKeys)},
+	}
+
+	manifest := &dto.DataExportManifest{
+		UserID:      foundUser.ID,
+		GeneratedAt: time.Now().UTC(),
+		Notes: []string{
+			"Product reviews are not collected by Future Fashion, so the archive has no reviews.",
+			"Passwords, two-factor secrets and api keys are only stored as hashes and are not exported.",
+		},
+	}
+	for _, entry := range entries {
+		manifest.Files = append(manifest.Files, entry.name)
+	}
+	entries = append([]archiveEntry{{"manifest.json", manifest}}, entries...)
+
+	archive, err := writeJSONArchive(entries)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="future-fashion-export-%v-%v.zip"`, foundUser.ID, manifest.GeneratedAt.Format("20060102")))
+	_, err = w.Write(archive.Bytes())
+	if err != nil {
+		helpers.Logger(r.Context(), u.Logger).Errorw("failed to write data export", "user_id", foundUser.ID, "error", err)
+	}
+}
+
+// Erase Account anonymizes the caller's account, orders are kept for accounting ...
+func (u *UserHandler) EraseAccount(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := u.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, u.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	//staff accounts are removed by an administrator, not through self service
+	if verifiedToken.Role != helpers.RoleCustomer {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	eraseReq := &dto.EraseAccountRequest{}
+	err = helpers.DecodeJSON(r, eraseReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	foundUser, err := u.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	//accounts created through a login provider have no password, the token is all they have
+	if foundUser.Password != "" {
+		err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(eraseReq.Password))
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				u.Logger,
+				helpers.NewValidationError("missing_password", "NOTE: Password is required to erase the account", helpers.FieldError{Field: "password", Message: "is required"}),
+			)
+			return
+		}
+	}
+
+	_, err = u.UserModel.WithContext(r.Context()).Erase(foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+	helpers.Logger(r.Context(), u.Logger).Infow("account erased on request", "user_id", foundUser.ID)
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"Your account and personal data are erased",
+		nil,
+	)
+}
+
+func writeJSONArchive(entries []archiveEntry) (*bytes.Buffer, error) {
+	buf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buf)
+	for _, entry := range entries {
+		file, err := zipWriter.Create(entry.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(entry.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := zipWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"future-fashion/dto"
 	"future-fashion/helpers"
+	"future-fashion/mappers"
 	"future-fashion/models"
 )
 
@@ -19,129 +20,134 @@ type ProductHandlerActions interface {
 	DeleteProduct(w http.ResponseWriter, r *http.Request)
 	ListProducts(w http.ResponseWriter, r *http.Request)
 	EditProduct(w http.ResponseWriter, r *http.Request)
+	ListTrashedProducts(w http.ResponseWriter, r *http.Request)
+	RestoreProduct(w http.ResponseWriter, r *http.Request)
 }
 
 type ProductHandler struct {
-	ProductModel    *models.ProductCRUDOperationsImpl
-	CredentialModel *models.CredentialOperationsImpl
+	ProductModel    models.ProductCRUDOperation
+	CredentialModel models.CredentialOperations
+	APIKeyModel     models.APIKeyOperation
+	AuditModel      models.AuditLogOperation
 	Logger          *zap.SugaredLogger
 }
 
 func (p *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := p.CredentialModel.GetTokenKey()
+	tokenKey, err := p.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, p.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionProductsWrite) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			p.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 
 	productReq := &dto.ProductRequest{}
-	err = json.NewDecoder(r.Body).Decode(productReq)
+	err = helpers.DecodeJSON(r, productReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	err = productReq.Validate()
+	productModel, err := p.convertProductDTOToProductModel(productReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	productModel, err := p.convertProductDTOToProductModel(productReq)
+	dbProductRes, err := p.ProductModel.WithContext(r.Context()).Insert(productModel)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	dbProductRes, err := p.ProductModel.Insert(productModel)
+	productRes, err := mappers.Product(dbProductRes)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
+	recordAudit(p.AuditModel.WithContext(r.Context()), p.Logger, r, verifiedToken, models.AuditActionProductCreate, models.AuditTargetProduct, dbProductRes.ID, nil, productRes)
 
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
-		fmt.Sprintf("%v is inserted successfully", dbProductRes.Item),
-		dbProductRes,
+		fmt.Sprintf("%v is inserted successfully", productRes.Item),
+		productRes,
 	)
 }
 
 func (p *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := p.CredentialModel.GetTokenKey()
+	tokenKey, err := p.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, p.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionProductsWrite) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			p.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
@@ -149,11 +155,11 @@ func (p *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	//retrieve parameter from url
 	param, ok := r.URL.Query()["id"]
 	if !ok || len(param[0]) < 1 {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Url param key not exist",
-			nil,
+			r,
+			p.Logger,
+			helpers.NewMissingParamError("id"),
 		)
 		return
 	}
@@ -161,125 +167,66 @@ func (p *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	// convert id to uint64 type
 	uintID, err := strconv.ParseUint(param[0], 10, 64)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
 		)
 		return
 	}
 
-	deletedProduct, err := p.ProductModel.Delete(uint(uintID))
+	deletedProduct, err := p.ProductModel.WithContext(r.Context()).Delete(uint(uintID))
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
+	productRes, err := mappers.Product(deletedProduct)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(p.AuditModel.WithContext(r.Context()), p.Logger, r, verifiedToken, models.AuditActionProductDelete, models.AuditTargetProduct, deletedProduct.ID, productRes, nil)
+
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
-		fmt.Sprintf("%v is deleted successfully", deletedProduct.Item),
-		deletedProduct,
+		fmt.Sprintf("%v is deleted successfully", productRes.Item),
+		productRes,
 	)
 }
 
 func (p *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := p.ProductModel.GetAll()
-	if err != nil {
-		helpers.JsonResponse(
-			w,
-			"FAIL",
-			err.Error(),
-			nil,
-		)
-		return
-	}
-	productsResponse := &dto.ListProductsResponse{
-		Products: []*dto.ProductResponse{},
-	}
-
-	for _, product := range products {
-		var picturesList []string
-		err := json.Unmarshal([]byte(product.Pictures), &picturesList)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-
-		xsModel, err := unmarshalSizing(product.XS)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-		sModel, err := unmarshalSizing(product.S)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-		mModel, err := unmarshalSizing(product.M)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-		lModel, err := unmarshalSizing(product.L)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-		xlModel, err := unmarshalSizing(product.XL)
-		if err != nil {
-			helpers.JsonResponse(
-				w,
-				"FAIL",
-				err.Error(),
-				nil,
-			)
-			return
-		}
-
-		productsResponse.Products = append(productsResponse.Products, &dto.ProductResponse{
-			ID:       product.ID,
-			Item:     product.Item,
-			Price:    product.Price,
-			Stock:    product.Stock,
-			Pictures: picturesList,
-			XS:       xsModel,
-			S:        sModel,
-			M:        mModel,
-			L:        lModel,
-			XL:       xlModel,
-		})
+	products, err := p.ProductModel.WithContext(r.Context()).GetAll()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+	productsResponse, err := mappers.Products(products)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
 	}
 
 	helpers.JsonResponse(
@@ -290,90 +237,168 @@ func (p *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
-func unmarshalSizing(sizing string) (*dto.Sizing, error) {
-	var sizingModel *dto.Sizing
-	err := json.Unmarshal([]byte(sizing), &sizingModel)
-	if err != nil {
-		return nil, err
-	}
-	return sizingModel, nil
-}
-
 func (p *ProductHandler) EditProduct(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := p.CredentialModel.GetTokenKey()
+	tokenKey, err := p.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, p.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	if verifiedToken.Role != "admin" {
-		helpers.JsonResponse(
+	if !verifiedToken.HasPermission(helpers.PermissionProductsWrite) {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Only admin is allowed for this operation",
-			nil,
+			r,
+			p.Logger,
+			helpers.ErrPermissionDenied,
 		)
 		return
 	}
 
 	//dto user does not have all user fields - etc: chest, waist, hip
 	updateProductReq := &dto.UpdateProductRequest{}
-	err = json.NewDecoder(r.Body).Decode(updateProductReq)
+	err = helpers.DecodeJSON(r, updateProductReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
 	//check if product ID is provided
-	if updateProductReq.ID == 0 {
-		helpers.JsonResponse(
+	foundProduct, err := p.ProductModel.WithContext(r.Context()).GetByID(updateProductReq.ID)
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Product request ID does not exist",
-			nil,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	beforeRes, err := mappers.Product(foundProduct)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
 	productModel, err := p.convertUpdateProductDTOToProductModel(updateProductReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	dbProductRes, err := p.ProductModel.WithContext(r.Context()).Update(productModel)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	productRes, err := mappers.Product(dbProductRes)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(p.AuditModel.WithContext(r.Context()), p.Logger, r, verifiedToken, models.AuditActionProductUpdate, models.AuditTargetProduct, dbProductRes.ID, beforeRes, productRes)
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is updated successfully", productRes.Item),
+		productRes,
+	)
+}
+
+func (p *ProductHandler) ListTrashedProducts(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := p.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, p.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionProductsWrite) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	products, err := p.ProductModel.WithContext(r.Context()).GetTrashed()
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
 
-	dbProductRes, err := p.ProductModel.Update(productModel)
+	productsResponse, err := mappers.Products(products)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			p.Logger,
+			err,
 		)
 		return
 	}
@@ -381,8 +406,96 @@ func (p *ProductHandler) EditProduct(w http.ResponseWriter, r *http.Request) {
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
-		fmt.Sprintf("%v is updated successfully", dbProductRes.Item),
-		dbProductRes,
+		"SUCCESS",
+		productsResponse,
+	)
+}
+
+func (p *ProductHandler) RestoreProduct(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := p.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, p.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionProductsWrite) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	//retrieve parameter from url
+	param, ok := r.URL.Query()["id"]
+	if !ok || len(param[0]) < 1 {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			helpers.NewMissingParamError("id"),
+		)
+		return
+	}
+
+	// convert id to uint64 type
+	uintID, err := strconv.ParseUint(param[0], 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
+		)
+		return
+	}
+
+	restoredProduct, err := p.ProductModel.WithContext(r.Context()).Restore(uint(uintID))
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+
+	productRes, err := mappers.Product(restoredProduct)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			p.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(p.AuditModel.WithContext(r.Context()), p.Logger, r, verifiedToken, models.AuditActionProductRestore, models.AuditTargetProduct, restoredProduct.ID, nil, productRes)
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is restored successfully", productRes.Item),
+		productRes,
 	)
 }
 
@@ -431,32 +544,33 @@ func (p *ProductHandler) convertProductDTOToProductModel(productReq *dto.Product
 }
 
 func (p *ProductHandler) convertUpdateProductDTOToProductModel(productReq *dto.UpdateProductRequest) (*models.Product, error) {
-	picturesJsonByte, err := json.Marshal(productReq.Pictures)
+	//fields left out of the request stay empty, so the update does not touch them
+	pictures, err := marshalIfSet(productReq.Pictures, productReq.Pictures != nil)
 	if err != nil {
 		return nil, err
 	}
 
-	xsJsonByte, err := json.Marshal(productReq.XS)
+	xs, err := marshalIfSet(productReq.XS, productReq.XS != nil)
 	if err != nil {
 		return nil, err
 	}
 
-	sJsonByte, err := json.Marshal(productReq.S)
+	s, err := marshalIfSet(productReq.S, productReq.S != nil)
 	if err != nil {
 		return nil, err
 	}
 
-	mJsonByte, err := json.Marshal(productReq.M)
+	m, err := marshalIfSet(productReq.M, productReq.M != nil)
 	if err != nil {
 		return nil, err
 	}
 
-	lJsonByte, err := json.Marshal(productReq.L)
+	l, err := marshalIfSet(productReq.L, productReq.L != nil)
 	if err != nil {
 		return nil, err
 	}
 
-	xlJsonByte, err := json.Marshal(productReq.XL)
+	xl, err := marshalIfSet(productReq.XL, productReq.XL != nil)
 	if err != nil {
 		return nil, err
 	}
@@ -468,11 +582,22 @@ func (p *ProductHandler) convertUpdateProductDTOToProductModel(productReq *dto.U
 		Item:     productReq.Item,
 		Price:    productReq.Price,
 		Stock:    productReq.Stock,
-		Pictures: string(picturesJsonByte),
-		XS:       string(xsJsonByte),
-		S:        string(sJsonByte),
-		M:        string(mJsonByte),
-		L:        string(lJsonByte),
-		XL:       string(xlJsonByte),
+		Pictures: pictures,
+		XS:       xs,
+		S:        s,
+		M:        m,
+		L:        l,
+		XL:       xl,
 	}, nil
 }
+
+func marshalIfSet(v interface{}, set bool) (string, error) {
+	if !set {
+		return "", nil
+	}
+	jsonByte, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonByte), nil
+}
@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/mappers"
+	"future-fashion/models"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]{1,63}$`)
+
+func (a *AdminHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionRolesManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	roles, err := a.RoleModel.WithContext(r.Context()).GetAll()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"SUCCESS",
+		mappers.Roles(roles),
+	)
+}
+
+func (a *AdminHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionRolesManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	roleReq := &dto.RoleRequest{}
+	err = helpers.DecodeJSON(r, roleReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !roleNamePattern.MatchString(roleReq.Name) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewValidationError("invalid_role_name", "NOTE: Role name must be 2 to 64 lowercase letters, digits or dashes", helpers.FieldError{Field: "name", Message: "must be 2 to 64 lowercase letters, digits or dashes"}),
+		)
+		return
+	}
+
+	err = validatePermissions(roleReq.Permissions)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	dbRoleRes, err := a.RoleModel.WithContext(r.Context()).Insert(&models.Role{
+		Name:        roleReq.Name,
+		Description: roleReq.Description,
+		Permissions: models.NewRolePermissions(roleReq.Permissions),
+	})
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionRoleCreate, models.AuditTargetRole, dbRoleRes.ID, nil, mappers.Role(dbRoleRes))
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is inserted successfully", dbRoleRes.Name),
+		mappers.Role(dbRoleRes),
+	)
+}
+
+func (a *AdminHandler) EditRole(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionRolesManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	roleReq := &dto.RoleRequest{}
+	err = helpers.DecodeJSON(r, roleReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	//check if role ID is provided
+	if roleReq.ID == 0 {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewValidationError("missing_id", "Role request ID does not exist", helpers.FieldError{Field: "id", Message: "is required"}),
+		)
+		return
+	}
+
+	err = validatePermissions(roleReq.Permissions)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	foundRole, err := a.RoleModel.WithContext(r.Context()).GetByID(roleReq.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	roleModel := &models.Role{
+		Model: gorm.Model{
+			ID: roleReq.ID,
+		},
+		Description: roleReq.Description,
+	}
+	//a missing permissions field keeps the current set, an empty list clears it
+	if roleReq.Permissions != nil {
+		roleModel.Permissions = models.NewRolePermissions(roleReq.Permissions)
+	}
+
+	dbRoleRes, err := a.RoleModel.WithContext(r.Context()).Update(roleModel)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionRoleUpdate, models.AuditTargetRole, dbRoleRes.ID, mappers.Role(foundRole), mappers.Role(dbRoleRes))
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is updated successfully", dbRoleRes.Name),
+		mappers.Role(dbRoleRes),
+	)
+}
+
+func (a *AdminHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionRolesManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	//retrieve parameter from url
+	param, ok := r.URL.Query()["id"]
+	if !ok || len(param[0]) < 1 {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewMissingParamError("id"),
+		)
+		return
+	}
+
+	// convert id to uint64 type
+	uintID, err := strconv.ParseUint(param[0], 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewInvalidParamError("id", "NOTE: id must be a positive number"),
+		)
+		return
+	}
+
+	deletedRole, err := a.RoleModel.WithContext(r.Context()).Delete(uint(uintID))
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionRoleDelete, models.AuditTargetRole, deletedRole.ID, mappers.Role(deletedRole), nil)
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is deleted successfully", deletedRole.Name),
+		mappers.Role(deletedRole),
+	)
+}
+
+func (a *AdminHandler) AssignRole(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.HasPermission(helpers.PermissionRolesManage) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	assignReq := &dto.AssignRoleRequest{}
+	err = helpers.DecodeJSON(r, assignReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	//prevents the last super-admin from locking everyone out of role management
+	if assignReq.UserID == verifiedToken.Id {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewForbiddenError("own_role", "NOTE: You cannot change your own role"),
+		)
+		return
+	}
+
+	_, err = a.RoleModel.WithContext(r.Context()).GetByName(assignReq.Role)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewValidationError("unknown_role", fmt.Sprintf("NOTE: Role %v does not exist", assignReq.Role), helpers.FieldError{Field: "role", Message: "does not exist"}),
+		)
+		return
+	}
+
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(assignReq.UserID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	dbUserRes, err := a.UserModel.WithContext(r.Context()).UpdateRole(assignReq.UserID, assignReq.Role)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionRoleAssign, models.AuditTargetUser, dbUserRes.ID, mappers.User(foundUser), mappers.User(dbUserRes))
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is now %v", dbUserRes.Username, dbUserRes.Role),
+		mappers.User(dbUserRes),
+	)
+}
+
+func validatePermissions(permissions []string) error {
+	for _, p := range permissions {
+		if !helpers.IsKnownPermission(p) {
+			return helpers.NewValidationError(
+				"unknown_permission",
+				fmt.Sprintf("NOTE: Unknown permission %v", p),
+				helpers.FieldError{Field: "permissions", Message: fmt.Sprintf("%v is not a known permission", p)},
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,643 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+const (
+	twoFactorIssuer       = "Future Fashion"
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+var (
+	errInvalidTwoFactorCode = helpers.NewUnauthorizedError("invalid_two_factor_code", "NOTE: Invalid two-factor code")
+	errStaffOnly            = helpers.NewForbiddenError("staff_only", "NOTE: Only staff accounts can use two-factor authentication")
+)
+
+func (a *AdminHandler) VerifyTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	challenge, err := helpers.GetVerifiedScopedToken(tokenKey, helpers.ScopeTwoFactorVerify, r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	codeReq := &dto.TwoFactorCodeRequest{}
+	err = helpers.DecodeJSON(r, codeReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	ip := helpers.ClientIP(r)
+	locked, err := loginLocked(a.LoginAttemptModel.WithContext(r.Context()), challenge.Username, ip)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if locked {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errLockedOut,
+		)
+		return
+	}
+
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(challenge.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	ok, err := a.checkSecondFactor(r.Context(), foundUser, codeReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !ok {
+		recordLoginFailure(a.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), a.Logger), foundUser.Username, ip)
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errInvalidTwoFactorCode,
+		)
+		return
+	}
+
+	permissions, err := a.RoleModel.WithContext(r.Context()).GetPermissions(foundUser.Role)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	resetLoginFailures(a.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), a.Logger), foundUser.Username)
+
+	tokenEncodedString, err := helpers.NewClaim(
+		foundUser.ID,
+		foundUser.Username,
+		foundUser.Role,
+		permissions,
+	).CreateToken(tokenKey)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewInternalError(err),
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v logged in successfully", foundUser.Username),
+		tokenEncodedString,
+	)
+}
+
+func (a *AdminHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := a.getTwoFactorSetupToken(tokenKey, r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if foundUser.TOTPEnabled {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewConflictError("two_factor_enabled", "NOTE: Two-factor authentication is already enabled"),
+		)
+		return
+	}
+
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	err = a.TwoFactorModel.WithContext(r.Context()).SetPendingSecret(foundUser.ID, secret)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"Scan the QR code with your authenticator app and confirm with a code",
+		&dto.TwoFactorEnrollResponse{
+			Secret:     secret,
+			OTPAuthURI: helpers.TOTPURI(twoFactorIssuer, foundUser.Username, secret),
+		},
+	)
+}
+
+func (a *AdminHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := a.getTwoFactorSetupToken(tokenKey, r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	codeReq := &dto.TwoFactorCodeRequest{}
+	err = helpers.DecodeJSON(r, codeReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if foundUser.TOTPEnabled {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewConflictError("two_factor_enabled", "NOTE: Two-factor authentication is already enabled"),
+		)
+		return
+	}
+
+	if foundUser.TOTPSecret == "" {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewConflictError("two_factor_not_started", "NOTE: Please start the two-factor enrolment first"),
+		)
+		return
+	}
+
+	step, ok := helpers.ValidateTOTP(foundUser.TOTPSecret, codeReq.Code, time.Now())
+	if !ok {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errInvalidTwoFactorCode,
+		)
+		return
+	}
+
+	err = a.TwoFactorModel.WithContext(r.Context()).Enable(foundUser.ID, step)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionTwoFactorEnable, models.AuditTargetUser, foundUser.ID, nil, nil)
+
+	recoveryCodes, err := a.issueRecoveryCodes(r.Context(), foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	confirmRes := &dto.TwoFactorConfirmResponse{
+		RecoveryCodes: recoveryCodes,
+	}
+
+	//a forced enrolment finishes the login, so hand out the real token
+	if verifiedToken.Scope == helpers.ScopeTwoFactorEnroll {
+		permissions, err := a.RoleModel.WithContext(r.Context()).GetPermissions(foundUser.Role)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				err,
+			)
+			return
+		}
+
+		resetLoginFailures(a.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), a.Logger), foundUser.Username)
+
+		confirmRes.Token, err = helpers.NewClaim(
+			foundUser.ID,
+			foundUser.Username,
+			foundUser.Role,
+			permissions,
+		).CreateToken(tokenKey)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				a.Logger,
+				helpers.NewInternalError(err),
+			)
+			return
+		}
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"Two-factor authentication is enabled, keep the recovery codes somewhere safe",
+		confirmRes,
+	)
+}
+
+func (a *AdminHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.IsStaff() {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errStaffOnly,
+		)
+		return
+	}
+
+	codeReq := &dto.TwoFactorCodeRequest{}
+	err = helpers.DecodeJSON(r, codeReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	//recovery codes cannot be used to mint new recovery codes
+	codeReq.RecoveryCode = ""
+	ok, err := a.checkSecondFactor(r.Context(), foundUser, codeReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !ok {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errInvalidTwoFactorCode,
+		)
+		return
+	}
+
+	recoveryCodes, err := a.issueRecoveryCodes(r.Context(), foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionRecoveryCodesRenew, models.AuditTargetUser, foundUser.ID, nil, nil)
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"New recovery codes are generated, the previous ones no longer work",
+		&dto.TwoFactorConfirmResponse{
+			RecoveryCodes: recoveryCodes,
+		},
+	)
+}
+
+func (a *AdminHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := a.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !verifiedToken.IsStaff() {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errStaffOnly,
+		)
+		return
+	}
+
+	if a.Require2FA {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			helpers.NewForbiddenError("two_factor_required", "NOTE: Two-factor authentication is required for all admins"),
+		)
+		return
+	}
+
+	codeReq := &dto.TwoFactorCodeRequest{}
+	err = helpers.DecodeJSON(r, codeReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	foundUser, err := a.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	ok, err := a.checkSecondFactor(r.Context(), foundUser, codeReq)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+
+	if !ok {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			errInvalidTwoFactorCode,
+		)
+		return
+	}
+
+	err = a.TwoFactorModel.WithContext(r.Context()).Disable(foundUser.ID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			a.Logger,
+			err,
+		)
+		return
+	}
+	recordAudit(a.AuditModel.WithContext(r.Context()), a.Logger, r, verifiedToken, models.AuditActionTwoFactorDisable, models.AuditTargetUser, foundUser.ID, nil, nil)
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		"Two-factor authentication is disabled",
+		nil,
+	)
+}
+
+// getTwoFactorSetupToken accepts a normal staff token or the enrolment token handed out
+// by AdminLogin when two-factor authentication is required but not set up yet.
+func (a *AdminHandler) getTwoFactorSetupToken(tokenKey string, r *http.Request) (*helpers.Claims, error) {
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, a.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		//the enrolment token is only issued to staff accounts by AdminLogin
+		return helpers.GetVerifiedScopedToken(tokenKey, helpers.ScopeTwoFactorEnroll, r)
+	}
+
+	if !verifiedToken.IsStaff() {
+		return nil, errStaffOnly
+	}
+	return verifiedToken, nil
+}
+
+// checkSecondFactor validates a TOTP code, refusing a step that was already used,
+// or consumes a recovery code.
+func (a *AdminHandler) checkSecondFactor(ctx context.Context, user *models.User, codeReq *dto.TwoFactorCodeRequest) (bool, error) {
+	if !user.TOTPEnabled {
+		return false, helpers.NewConflictError("two_factor_not_enabled", "NOTE: Two-factor authentication is not enabled")
+	}
+
+	if codeReq.Code != "" {
+		step, ok := helpers.ValidateTOTP(user.TOTPSecret, codeReq.Code, time.Now())
+		if !ok || step <= user.TOTPLastStep {
+			return false, nil
+		}
+		return a.TwoFactorModel.WithContext(ctx).UseStep(user.ID, step)
+	}
+
+	if codeReq.RecoveryCode != "" {
+		return a.TwoFactorModel.WithContext(ctx).UseRecoveryCode(user.ID, helpers.HashToken(normalizeRecoveryCode(codeReq.RecoveryCode)))
+	}
+
+	return false, nil
+}
+
+// issueRecoveryCodes replaces the recovery codes of the user and returns them in plain text, once ...
+func (a *AdminHandler) issueRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes := []string{}
+	codeHashes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := helpers.GenerateRandomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		codeHashes = append(codeHashes, helpers.HashToken(code))
+	}
+
+	err := a.TwoFactorModel.WithContext(ctx).ReplaceRecoveryCodes(userID, codeHashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -1,17 +1,30 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"future-fashion/dto"
 	"future-fashion/helpers"
+	"future-fashion/mappers"
+	"future-fashion/metrics"
 	"future-fashion/models"
 
 	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	verificationTokenTTL     = 24 * time.Hour
+	verificationResendDelay  = time.Minute
+	verificationResendWindow = 24 * time.Hour
+	verificationResendLimit  = 5
 )
 
 type UserHandlerActions interface {
@@ -19,156 +32,389 @@ type UserHandlerActions interface {
 	Login(w http.ResponseWriter, r *http.Request)
 	GetPersonalInfo(w http.ResponseWriter, r *http.Request)
 	EditPersonalInfo(w http.ResponseWriter, r *http.Request)
+	VerifyEmail(w http.ResponseWriter, r *http.Request)
+	ResendVerification(w http.ResponseWriter, r *http.Request)
+	OIDCLogin(w http.ResponseWriter, r *http.Request)
+	OIDCCallback(w http.ResponseWriter, r *http.Request)
+	ExportData(w http.ResponseWriter, r *http.Request)
+	EraseAccount(w http.ResponseWriter, r *http.Request)
 }
 
 type UserHandler struct {
-	UserModel       *models.UserCRUDOperationsImpl
-	CredentialModel *models.CredentialOperationsImpl
-	Logger          *zap.SugaredLogger
+	UserModel         models.UserCRUDOperation
+	CredentialModel   models.CredentialOperations
+	OrderModel        models.OrderCRUDOperation
+	APIKeyModel       models.APIKeyOperation
+	LoginAttemptModel models.LoginAttemptOperation
+	VerificationModel models.EmailVerificationOperation
+	OIDCModel         models.OIDCOperation
+	//identity providers for social login, keyed by provider name
+	OIDCProviders map[string]*helpers.OIDCProvider
+	Mailer        helpers.Mailer
+	//link sent in the verification email, the token is appended as a query param
+	VerifyEmailURL string
+	Metrics        *metrics.Metrics
+	Logger         *zap.SugaredLogger
 }
 
 // Sign Up ...
 func (u *UserHandler) SignUp(w http.ResponseWriter, r *http.Request) {
 	signupReq := &dto.UserRequest{}
-	err := json.NewDecoder(r.Body).Decode(signupReq)
+	err := helpers.DecodeJSON(r, signupReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	if signupReq.Username == "" || signupReq.Password == "" || signupReq.DOB == "" {
-		helpers.JsonResponse(
+	_, err = u.UserModel.WithContext(r.Context()).GetByEmail(signupReq.Email)
+	if err == nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Please fill in all the required information (username, password, and dob) to sign up an account",
-			nil,
+			r,
+			u.Logger,
+			helpers.NewConflictError("email_taken", "NOTE: Email address is already registered"),
 		)
 		return
 	}
-
-	if signupReq.Role == "" {
-		signupReq.Role = "customer"
-	} else {
-		signupReq.Role = "admin"
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
 	}
 
+	//self sign up always creates a customer, staff roles are assigned by an admin
+	signupReq.Role = helpers.RoleCustomer
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(signupReq.Password), 8)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
 	signupReq.Password = string(hashedPassword)
 
-	dbUserRes, err := u.UserModel.Insert(signupReq)
+	dbUserRes, err := u.UserModel.WithContext(r.Context()).Insert(signupReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
+	u.Metrics.SignedUp(metrics.SignupPassword)
+
+	//the account is created even if the mail could not be sent, the user can request a resend
+	message := fmt.Sprintf("%v is inserted successfully, please check your email to verify your account", dbUserRes.Username)
+	err = u.sendVerification(r.Context(), dbUserRes, nil)
+	if err != nil {
+		helpers.Logger(r.Context(), u.Logger).Errorw("failed to send verification email", "user_id", dbUserRes.ID, "error", err)
+		message = fmt.Sprintf("%v is inserted successfully, but the verification email could not be sent", dbUserRes.Username)
+	}
 
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
-		fmt.Sprintf("%v is inserted successfully", dbUserRes.Username),
-		dbUserRes,
+		message,
+		mappers.User(dbUserRes),
 	)
 }
 
+func (u *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	//retrieve parameter from url
+	param, ok := r.URL.Query()["token"]
+	if !ok || len(param[0]) < 1 {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewMissingParamError("token"),
+		)
+		return
+	}
+
+	verification, err := u.VerificationModel.WithContext(r.Context()).GetByTokenHash(helpers.HashToken(param[0]))
+	if err != nil || time.Now().After(verification.ExpiresAt) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewValidationError("invalid_verification_token", "NOTE: Verification link is invalid or has expired. Please request a new one."),
+		)
+		return
+	}
+
+	verifiedUser, err := u.UserModel.WithContext(r.Context()).MarkEmailVerified(verification.UserID)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	err = u.VerificationModel.WithContext(r.Context()).Delete(verification.ID)
+	if err != nil {
+		helpers.Logger(r.Context(), u.Logger).Errorw("failed to delete used verification token", "user_id", verifiedUser.ID, "error", err)
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("%v is verified successfully", verifiedUser.Email),
+		nil,
+	)
+}
+
+func (u *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	tokenKey, err := u.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, u.APIKeyModel.WithContext(r.Context()), r)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	user, err := u.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	if user.EmailVerified {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewConflictError("email_verified", "NOTE: Email address is already verified"),
+		)
+		return
+	}
+
+	if user.Email == "" {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.NewConflictError("missing_email", "NOTE: Please add an email address to your account first"),
+		)
+		return
+	}
+
+	verification, err := u.VerificationModel.WithContext(r.Context()).GetByUserID(user.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	now := time.Now()
+	if verification != nil {
+		if now.Sub(verification.SentAt) < verificationResendDelay {
+			helpers.ErrorResponse(
+				w,
+				r,
+				u.Logger,
+				helpers.NewTooManyRequestsError("verification_throttled", "NOTE: Verification email was sent recently. Please wait a minute before requesting another one."),
+			)
+			return
+		}
+		if now.Sub(verification.WindowStart) < verificationResendWindow && verification.SendCount >= verificationResendLimit {
+			helpers.ErrorResponse(
+				w,
+				r,
+				u.Logger,
+				helpers.NewTooManyRequestsError("verification_limit", "NOTE: Too many verification emails requested. Please try again tomorrow."),
+			)
+			return
+		}
+	}
+
+	err = u.sendVerification(r.Context(), user, verification)
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	helpers.JsonResponse(
+		w,
+		"SUCCESS",
+		fmt.Sprintf("Verification email is sent to %v", user.Email),
+		nil,
+	)
+}
+
+// sendVerification issues a fresh token for the user, replacing any previous one, and mails the link ...
+func (u *UserHandler) sendVerification(ctx context.Context, user *models.User, verification *models.EmailVerification) error {
+	token, err := helpers.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if verification == nil {
+		verification = &models.EmailVerification{
+			UserID: user.ID,
+		}
+	}
+	if now.Sub(verification.WindowStart) >= verificationResendWindow {
+		verification.WindowStart = now
+		verification.SendCount = 0
+	}
+	verification.TokenHash = helpers.HashToken(token)
+	verification.ExpiresAt = now.Add(verificationTokenTTL)
+	verification.SentAt = now
+	verification.SendCount++
+
+	_, err = u.VerificationModel.WithContext(ctx).Save(verification)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%v?token=%v", u.VerifyEmailURL, url.QueryEscape(token))
+	body := fmt.Sprintf(
+		"Hi %v,\n\nPlease verify your email address by opening the link below:\n\n%v\n\nThe link expires in %v hours.",
+		user.Username,
+		link,
+		int(verificationTokenTTL.Hours()),
+	)
+	return u.Mailer.Send(user.Email, "Verify your Future Fashion account", body)
+}
+
 // Login ...
 func (u *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
-	loginReq := &dto.UserRequest{}
-	err := json.NewDecoder(r.Body).Decode(loginReq)
+	loginReq := &dto.LoginRequest{}
+	err := helpers.DecodeJSON(r, loginReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	if loginReq.Username == "" || loginReq.Password == "" {
-		helpers.JsonResponse(
+	ip := helpers.ClientIP(r)
+	locked, err := loginLocked(u.LoginAttemptModel.WithContext(r.Context()), loginReq.Username, ip)
+	if err != nil {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Username or password cannot be empty",
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	foundUser, err := u.UserModel.GetByUsername(loginReq.Username)
-	if err != nil {
-		helpers.JsonResponse(
+	if locked {
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: User does not exist. Please create a user account.",
-			nil,
+			r,
+			u.Logger,
+			errLockedOut,
 		)
 		return
 	}
 
-	if foundUser.Role != "customer" {
-		helpers.JsonResponse(
+	foundUser, err := u.UserModel.WithContext(r.Context()).GetByUsername(loginReq.Username)
+	if err != nil {
+		//compare against a dummy hash so unknown usernames take as long as wrong passwords
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(loginReq.Password))
+		recordLoginFailure(u.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), u.Logger), loginReq.Username, ip)
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"Make sure you are a member.",
-			nil,
+			r,
+			u.Logger,
+			errInvalidCredentials,
 		)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(loginReq.Password))
-	if err != nil {
-		helpers.JsonResponse(
+	if err != nil || foundUser.Role != helpers.RoleCustomer {
+		recordLoginFailure(u.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), u.Logger), loginReq.Username, ip)
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Incorrect Password. Please try again.",
-			nil,
+			r,
+			u.Logger,
+			errInvalidCredentials,
 		)
 		return
 	}
 
+	resetLoginFailures(u.LoginAttemptModel.WithContext(r.Context()), helpers.Logger(r.Context(), u.Logger), loginReq.Username)
+
 	token := helpers.NewClaim(
 		foundUser.ID,
 		foundUser.Username,
 		foundUser.Role,
+		nil,
 	)
 
-	tokenKey, err := u.CredentialModel.GetTokenKey()
+	tokenKey, err := u.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Failed to get token key",
-			nil,
+			r,
+			u.Logger,
+			helpers.NewInternalError(err),
 		)
 		return
 	}
 
 	tokenEncodedString, err := token.CreateToken(tokenKey)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			"NOTE: Failed to create token",
-			nil,
+			r,
+			u.Logger,
+			helpers.NewInternalError(err),
 		)
 		return
 	}
@@ -182,35 +428,45 @@ func (u *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 }
 
 func (u *UserHandler) GetPersonalInfo(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := u.CredentialModel.GetTokenKey()
+	tokenKey, err := u.CredentialModel.WithContext(r.Context()).GetTokenKey()
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	verifiedToken, err := helpers.GetVerifiedCaller(tokenKey, u.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	user, err := u.UserModel.GetByID(verifiedToken.Id)
+	if !verifiedToken.InScope(helpers.ScopeProfileRead) {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			helpers.ErrPermissionDenied,
+		)
+		return
+	}
+
+	user, err := u.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
@@ -219,63 +475,146 @@ func (u *UserHandler) GetPersonalInfo(w http.ResponseWriter, r *http.Request) {
 		w,
 		"SUCCESS",
 		"",
-		user,
+		mappers.User(user),
 	)
 }
 
 func (u *UserHandler) EditPersonalInfo(w http.ResponseWriter, r *http.Request) {
-	tokenKey, err := u.CredentialModel.GetTokenKey()
+	tokenKey, err := u.CredentialModel.WithContext(r.Context()).GetTokenKey()
+	if err != nil {
+		helpers.ErrorResponse(
+			w,
+			r,
+			u.Logger,
+			err,
+		)
+		return
+	}
+
+	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, u.APIKeyModel.WithContext(r.Context()), r)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	verifiedToken, err := helpers.GetVerifiedToken(tokenKey, r)
+	editReq := &dto.EditPersonalInfoRequest{}
+	err = helpers.DecodeJSON(r, editReq)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	//dto user does not have all user fields - etc: chest, waist, hip
-	editReq := &models.User{}
-	err = json.NewDecoder(r.Body).Decode(editReq)
+	foundUser, err := u.UserModel.WithContext(r.Context()).GetByID(verifiedToken.Id)
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
-	editReq.ID = verifiedToken.Id
+	//stored lowercased, so the own address in another case is not a change
+	editReq.Email = models.NormalizeIdentifier(editReq.Email)
+	emailChanged := editReq.Email != "" && editReq.Email != foundUser.Email
+	if emailChanged || editReq.Password != "" {
+		err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(editReq.CurrentPassword))
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				u.Logger,
+				helpers.NewValidationError("missing_current_password", "NOTE: Current password is required to change the email or password", helpers.FieldError{Field: "current_password", Message: "is required"}),
+			)
+			return
+		}
+	}
+
+	if emailChanged {
+		_, err = u.UserModel.WithContext(r.Context()).GetByEmail(editReq.Email)
+		if err == nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				u.Logger,
+				helpers.NewConflictError("email_taken", "NOTE: Email address is already registered"),
+			)
+			return
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			helpers.ErrorResponse(
+				w,
+				r,
+				u.Logger,
+				err,
+			)
+			return
+		}
+	}
 
-	dbUserRes, err := u.UserModel.Update(editReq)
+	if editReq.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(editReq.Password), 8)
+		if err != nil {
+			helpers.ErrorResponse(
+				w,
+				r,
+				u.Logger,
+				err,
+			)
+			return
+		}
+		editReq.Password = string(hashedPassword)
+	}
+
+	//only the allow-listed fields are copied, the ID always comes from the token
+	dbUserRes, err := u.UserModel.WithContext(r.Context()).Update(&models.User{
+		Model: gorm.Model{
+			ID: verifiedToken.Id,
+		},
+		Username: editReq.Username,
+		Email:    editReq.Email,
+		Password: editReq.Password,
+		DOB:      editReq.DOB,
+		Chest:    editReq.Chest,
+		Waist:    editReq.Waist,
+		Hip:      editReq.Hip,
+	})
 	if err != nil {
-		helpers.JsonResponse(
+		helpers.ErrorResponse(
 			w,
-			"FAIL",
-			err.Error(),
-			nil,
+			r,
+			u.Logger,
+			err,
 		)
 		return
 	}
 
+	if emailChanged {
+		verification, err := u.VerificationModel.WithContext(r.Context()).GetByUserID(dbUserRes.ID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			helpers.Logger(r.Context(), u.Logger).Errorw("failed to load verification", "user_id", dbUserRes.ID, "error", err)
+		}
+		err = u.sendVerification(r.Context(), dbUserRes, verification)
+		if err != nil {
+			helpers.Logger(r.Context(), u.Logger).Errorw("failed to send verification email", "user_id", dbUserRes.ID, "error", err)
+		}
+	}
+
 	helpers.JsonResponse(
 		w,
 		"SUCCESS",
 		fmt.Sprintf("%v is updated successfully", dbUserRes.Username),
-		dbUserRes,
+		mappers.User(dbUserRes),
 	)
 }
@@ -0,0 +1,97 @@
+package helpers
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognise in logs and scanners ...
+const APIKeyPrefix = "ffk_"
+
+// Scopes a customer API key can be limited to, staff keys are limited with permissions
+const (
+	ScopeOrdersPlace = "orders:place"
+	ScopeOrdersOwn   = "orders:own"
+	ScopeProfileRead = "profile:read"
+)
+
+var CustomerScopes = []string{
+	ScopeOrdersPlace,
+	ScopeOrdersOwn,
+	ScopeProfileRead,
+}
+
+// CallerVerifier resolves an API key into the claims of its owner and brings the claims of a
+// JWT up to date, so role changes apply to tokens that were issued before them ...
+type CallerVerifier interface {
+	VerifyAPIKey(key string) (*Claims, error)
+	RefreshClaims(claims *Claims) (*Claims, error)
+}
+
+func IsKnownScope(scope string) bool {
+	for _, s := range CustomerScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return IsKnownPermission(scope)
+}
+
+// InScope reports whether an API key caller was granted the scope. Callers with a JWT are not scope limited.
+func (claims *Claims) InScope(scope string) bool {
+	if claims.APIKeyScopes == nil {
+		return true
+	}
+	for _, s := range claims.APIKeyScopes {
+		if s == scope || s == PermissionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAPIKey reads the key from the X-API-Key header or an "Authorization: ApiKey <key>" header ...
+func GetAPIKey(r *http.Request) string {
+	key := r.Header.Get("X-API-Key")
+	if key != "" {
+		return key
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "ApiKey ") {
+		return strings.TrimPrefix(authorization, "ApiKey ")
+	}
+	return ""
+}
+
+// GetVerifiedCaller authenticates the request with an API key when one is sent, otherwise with the bearer JWT ...
+func GetVerifiedCaller(tokenKey string, callers CallerVerifier, r *http.Request) (*Claims, error) {
+	//traced on its own so slow checkouts can be told apart from slow authentication
+	_, span := trace.SpanFromContext(r.Context()).TracerProvider().Tracer("future-fashion/helpers").Start(r.Context(), "verify caller")
+	defer span.End()
+
+	var claims *Claims
+	var err error
+	key := GetAPIKey(r)
+	switch {
+	case key == "":
+		span.SetAttributes(attribute.String("auth.method", "jwt"))
+		claims, err = GetVerifiedToken(tokenKey, callers, r)
+	default:
+		span.SetAttributes(attribute.String("auth.method", "api_key"))
+		claims, err = callers.VerifyAPIKey(key)
+	}
+	span.SetAttributes(attribute.Bool("auth.verified", err == nil))
+	if err != nil {
+		return nil, err
+	}
+
+	//the rest of the request logs who made it
+	if requestLog := GetRequestLog(r.Context()); requestLog != nil {
+		requestLog.UserID = claims.Id
+	}
+	return claims, nil
+}
@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DecodeJSON decodes the request body into v and rejects fields that v does not declare,
+// so a client cannot slip in fields like role or id that the endpoint does not allow.
+// The decoded value is then checked against its validate tags, see Validate.
+func DecodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		return describeDecodeError(err)
+	}
+
+	//a second value after the object means the body was not a single JSON document
+	if decoder.More() {
+		return NewValidationError("invalid_body", "NOTE: Request body must contain a single JSON object")
+	}
+	return Validate(v)
+}
+
+func describeDecodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return NewValidationError("invalid_body", "NOTE: Request body cannot be empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return NewValidationError("invalid_body", "NOTE: Request body is not valid JSON")
+	case errors.As(err, &syntaxErr):
+		return NewValidationError("invalid_body", fmt.Sprintf("NOTE: Request body is not valid JSON (at position %v)", syntaxErr.Offset))
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return NewValidationError("invalid_body", "NOTE: Request body must be a JSON object")
+	case errors.As(err, &typeErr):
+		message := fmt.Sprintf("must be of type %v", typeErr.Type.String())
+		return NewValidationError(
+			"invalid_field",
+			fmt.Sprintf("NOTE: Field %q %v", typeErr.Field, message),
+			FieldError{Field: typeErr.Field, Message: message},
+		)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return NewValidationError(
+			"unknown_field",
+			fmt.Sprintf("NOTE: Field %v is not allowed in this request", field),
+			FieldError{Field: strings.Trim(field, `"`), Message: "is not allowed in this request"},
+		)
+	}
+	return &AppError{Kind: KindValidation, Code: "invalid_body", Message: "NOTE: Request body could not be read", Err: err}
+}
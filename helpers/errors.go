@@ -0,0 +1,151 @@
+package helpers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrorKind decides the HTTP status an error is reported with
+type ErrorKind string
+
+const (
+	KindValidation      ErrorKind = "validation"
+	KindUnauthorized    ErrorKind = "unauthorized"
+	KindForbidden       ErrorKind = "forbidden"
+	KindNotFound        ErrorKind = "not_found"
+	KindConflict        ErrorKind = "conflict"
+	KindTooManyRequests ErrorKind = "too_many_requests"
+	KindUnavailable     ErrorKind = "unavailable"
+	KindInternal        ErrorKind = "internal"
+)
+
+var kindStatus = map[ErrorKind]int{
+	KindValidation:      http.StatusBadRequest,
+	KindUnauthorized:    http.StatusUnauthorized,
+	KindForbidden:       http.StatusForbidden,
+	KindNotFound:        http.StatusNotFound,
+	KindConflict:        http.StatusConflict,
+	KindTooManyRequests: http.StatusTooManyRequests,
+	KindUnavailable:     http.StatusServiceUnavailable,
+	KindInternal:        http.StatusInternalServerError,
+}
+
+// FieldError points a validation failure at one field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// AppError is an error that can be shown to the client. Code is a stable machine readable
+// name for the failure, Message is for humans and may change. Err is the cause, it is
+// logged but never sent.
+type AppError struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// Status is the HTTP status of the error
+func (e *AppError) Status() int {
+	status, ok := kindStatus[e.Kind]
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+// NewValidationError is the constructor of an error about the request the client sent ...
+func NewValidationError(code, message string, fields ...FieldError) *AppError {
+	return &AppError{Kind: KindValidation, Code: code, Message: message, Fields: fields}
+}
+
+// NewUnauthorizedError is the constructor of an error about missing or wrong credentials ...
+func NewUnauthorizedError(code, message string) *AppError {
+	return &AppError{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+// NewForbiddenError is the constructor of an error about a caller that is known but not allowed ...
+func NewForbiddenError(code, message string) *AppError {
+	return &AppError{Kind: KindForbidden, Code: code, Message: message}
+}
+
+// NewNotFoundError is the constructor of an error about a record that does not exist ...
+func NewNotFoundError(code, message string) *AppError {
+	return &AppError{Kind: KindNotFound, Code: code, Message: message}
+}
+
+// NewConflictError is the constructor of an error about a request that clashes with the current state ...
+func NewConflictError(code, message string) *AppError {
+	return &AppError{Kind: KindConflict, Code: code, Message: message}
+}
+
+// NewTooManyRequestsError is the constructor of an error about a caller that has to slow down ...
+func NewTooManyRequestsError(code, message string) *AppError {
+	return &AppError{Kind: KindTooManyRequests, Code: code, Message: message}
+}
+
+// NewUnavailableError is the constructor of an error about a service the request depends on being down ...
+func NewUnavailableError(code, message string) *AppError {
+	return &AppError{Kind: KindUnavailable, Code: code, Message: message}
+}
+
+// NewInternalError wraps an unexpected error, the client only learns that something went wrong ...
+func NewInternalError(err error) *AppError {
+	return &AppError{Kind: KindInternal, Code: "internal", Message: "NOTE: Something went wrong, please try again later", Err: err}
+}
+
+// errors shared by many handlers
+var (
+	ErrPermissionDenied = NewForbiddenError("permission_denied", "NOTE: You do not have permission for this operation")
+	ErrRecordNotFound   = NewNotFoundError("not_found", "NOTE: The requested record does not exist")
+	ErrDuplicateRecord  = NewConflictError("duplicate", "NOTE: The record already exists")
+)
+
+// NewMissingParamError is the error of a required url parameter that was not sent
+func NewMissingParamError(param string) *AppError {
+	return NewValidationError("missing_parameter", "Url param key not exist", FieldError{Field: param, Message: "is required"})
+}
+
+// NewInvalidParamError is the error of a url parameter that could not be parsed
+func NewInvalidParamError(param, message string) *AppError {
+	return NewValidationError("invalid_parameter", message, FieldError{Field: param, Message: message})
+}
+
+// AsAppError turns any error into an AppError. Database errors the client can act on are
+// translated, everything else becomes an internal error.
+func AsAppError(err error) *AppError {
+	var appErr *AppError
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrRecordNotFound
+	case isDuplicateKey(err):
+		return ErrDuplicateRecord
+	}
+	return NewInternalError(err)
+}
+
+// isDuplicateKey matches unique index violations, the drivers do not share an error type for them
+func isDuplicateKey(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unique constraint failed") || //sqlite
+		strings.Contains(message, "duplicate entry") || //mysql
+		strings.Contains(message, "duplicate key") //postgres
+}
@@ -1,7 +1,6 @@
 package helpers
 
 import (
-	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -18,21 +17,52 @@ type ClaimsOperation interface {
 //type assertion
 var _ ClaimsOperation = (*Claims)(nil)
 
+// Token scopes limit a token to one step of a multi step login.
+// Tokens without a scope grant normal access.
+const (
+	ScopeTwoFactorVerify = "2fa-verify"
+	ScopeTwoFactorEnroll = "2fa-enroll"
+)
+
 type Claims struct {
-	Id       uint
-	Username string
-	Role     string
+	Id          uint
+	Username    string
+	Role        string
+	//as of login, GetVerifiedToken replaces them with the current ones
+	Permissions []string `json:",omitempty"`
+	Scope       string   `json:",omitempty"`
+	//set only when the caller authenticated with an API key, never part of a JWT
+	APIKeyScopes []string `json:"-"`
 	jwt.StandardClaims
 }
 
+var errWrongTokenScope = NewUnauthorizedError("wrong_token_scope", "token is not valid for this operation")
+
+// TokenTTL is how long a login token stays valid, set from the config at startup
+var TokenTTL = 3000 * time.Minute
+
 // NewClaim is the constructor of claim ...
-func NewClaim(id uint, username, role string) *Claims {
+func NewClaim(id uint, username, role string, permissions []string) *Claims {
+	return &Claims{
+		Id:          id,
+		Username:    username,
+		Role:        role,
+		Permissions: permissions,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(TokenTTL).Unix(),
+		},
+	}
+}
+
+// NewScopedClaim is the constructor of a short lived claim that is only valid for the given scope ...
+func NewScopedClaim(id uint, username, role, scope string, ttl time.Duration) *Claims {
 	return &Claims{
 		Id:       id,
 		Username: username,
 		Role:     role,
+		Scope:    scope,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(3000 * time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
 		},
 	}
 }
@@ -50,14 +80,13 @@ func (claims *Claims) CreateToken(tokenKey string) (string, error) {
 func (claims *Claims) GetToken(r *http.Request) (string, error) {
 	token := r.Header.Get("Authorization")
 	if token == "" {
-		return "", errors.New("no request token")
+		return "", NewUnauthorizedError("missing_token", "no request token")
 	}
-	if len(token) > 7 {
-		splitToken := strings.Split(token, "Bearer ")
-		token = splitToken[1]
+	if len(token) > 7 && strings.HasPrefix(token, "Bearer ") {
+		token = strings.TrimPrefix(token, "Bearer ")
 		return token, nil
 	} else {
-		return "", errors.New("could not get token string")
+		return "", NewUnauthorizedError("invalid_token", "could not get token string")
 	}
 }
 
@@ -70,7 +99,7 @@ func (claims *Claims) VerifyToken(userToken, tokenKey string) (*Claims, error) {
 		},
 	)
 	if err != nil {
-		return nil, err
+		return nil, &AppError{Kind: KindUnauthorized, Code: "invalid_token", Message: err.Error(), Err: err}
 	}
 
 	claims, ok := token.Claims.(*Claims)
@@ -78,10 +107,12 @@ func (claims *Claims) VerifyToken(userToken, tokenKey string) (*Claims, error) {
 		return claims, nil
 	}
 
-	return nil, errors.New("invalid token")
+	return nil, NewUnauthorizedError("invalid_token", "invalid token")
 }
 
-func GetVerifiedToken(tokenKey string, r *http.Request) (*Claims, error) {
+// GetVerifiedToken checks the bearer JWT and replaces its role and permissions with the
+// current ones of the user, a token of a deleted user is refused ...
+func GetVerifiedToken(tokenKey string, callers CallerVerifier, r *http.Request) (*Claims, error) {
 	claims := &Claims{}
 	requestToken, err := claims.GetToken(r)
 	if err != nil {
@@ -94,5 +125,29 @@ func GetVerifiedToken(tokenKey string, r *http.Request) (*Claims, error) {
 		return nil, err
 	}
 
+	//scoped tokens are only accepted by the endpoint of their login step
+	if verifiedToken.Scope != "" {
+		return nil, errWrongTokenScope
+	}
+
+	return callers.RefreshClaims(verifiedToken)
+}
+
+func GetVerifiedScopedToken(tokenKey, scope string, r *http.Request) (*Claims, error) {
+	claims := &Claims{}
+	requestToken, err := claims.GetToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedToken, err := claims.VerifyToken(requestToken, tokenKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifiedToken.Scope != scope {
+		return nil, errWrongTokenScope
+	}
+
 	return verifiedToken, nil
 }
@@ -1,11 +1,85 @@
 package helpers
 
-import "go.uber.org/zap"
+import (
+	"context"
+	"fmt"
 
-func InitLogger() *zap.SugaredLogger {
-	logger, _ := zap.NewDevelopment()
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Log formats, json is one object per line for log collectors
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// InitLogger builds the logger, level is one of debug, info, warn or error
+func InitLogger(level, format string) (*zap.SugaredLogger, error) {
+	var config zap.Config
+	switch format {
+	case LogFormatConsole, "":
+		config = zap.NewDevelopmentConfig()
+	case LogFormatJSON:
+		config = zap.NewProductionConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	err := config.Level.UnmarshalText([]byte(level))
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := config.Build()
+	if err != nil {
+		return nil, err
+	}
 	defer logger.Sync()
 
 	sugar := logger.Sugar()
-	return sugar
+	return sugar, nil
+}
+
+type requestLogKey struct{}
+
+// RequestLog is what every log line of one request shares. The id is set when the request
+// comes in, the route once it is matched and the user once the caller is verified.
+type RequestLog struct {
+	ID     string
+	Route  string
+	UserID uint
+	logger *zap.SugaredLogger
+}
+
+// WithRequestLog starts the request log of a request, logger is the one it logs to ...
+func WithRequestLog(ctx context.Context, logger *zap.SugaredLogger, id string) (context.Context, *RequestLog) {
+	requestLog := &RequestLog{ID: id, logger: logger}
+	return context.WithValue(ctx, requestLogKey{}, requestLog), requestLog
+}
+
+// GetRequestLog returns the request log of ctx, nil outside a request
+func GetRequestLog(ctx context.Context) *RequestLog {
+	requestLog, _ := ctx.Value(requestLogKey{}).(*RequestLog)
+	return requestLog
+}
+
+// Logger returns the logger of the request in ctx with the request id, route, user and trace
+// id attached. Outside a request it returns fallback ...
+func Logger(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	requestLog := GetRequestLog(ctx)
+	if requestLog == nil {
+		return fallback
+	}
+
+	fields := []interface{}{"request_id", requestLog.ID}
+	if requestLog.Route != "" {
+		fields = append(fields, "route", requestLog.Route)
+	}
+	if requestLog.UserID != 0 {
+		fields = append(fields, "user_id", requestLog.UserID)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(fields, "trace_id", spanContext.TraceID().String())
+	}
+	return requestLog.logger.With(fields...)
 }
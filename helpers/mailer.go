@@ -0,0 +1,98 @@
+package helpers
+
+import (
+	"fmt"
+	"net/smtp"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// type assertion
+var _ Mailer = (*SMTPMailer)(nil)
+var _ Mailer = (*LogMailer)(nil)
+var _ Mailer = (*CaptureMailer)(nil)
+
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// SMTPMailer delivers mail through a plain SMTP relay ...
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	msg := fmt.Sprintf(
+		"From: %v\r\nTo: %v\r\nSubject: %v\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%v\r\n",
+		m.From,
+		to,
+		subject,
+		body,
+	)
+
+	addr := fmt.Sprintf("%v:%v", m.Host, m.Port)
+	return smtp.SendMail(addr, auth, m.From, []string{to}, []byte(msg))
+}
+
+// LogMailer writes mail to the logger instead of sending it, for local development ...
+type LogMailer struct {
+	Logger *zap.SugaredLogger
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	m.Logger.Infow("mail", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+// CaptureMailer keeps every message in memory so tests can inspect them ...
+type CaptureMailer struct {
+	mu       sync.Mutex
+	messages []*MailMessage
+}
+
+func (m *CaptureMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, &MailMessage{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	})
+	return nil
+}
+
+func (m *CaptureMailer) Messages() []*MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]*MailMessage, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+func (m *CaptureMailer) Last() *MailMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.messages) == 0 {
+		return nil
+	}
+	return m.messages[len(m.messages)-1]
+}
@@ -0,0 +1,335 @@
+package helpers
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// OIDCProvider is an OpenID Connect identity provider used with the authorization code flow and PKCE.
+// Endpoints are read from the discovery document of the issuer on first use.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	//form_post for providers that post the callback, such as apple
+	ResponseMode string
+	HTTPClient   *http.Client
+
+	mu                    sync.Mutex
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+	keys                  map[string]*rsa.PublicKey
+	keysFetchedAt         time.Time
+}
+
+// OIDCIdentity is what we keep from a validated ID token ...
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// KnownOIDCProviders are the providers we ship settings for, only the client credentials need configuring ...
+var KnownOIDCProviders = map[string]struct {
+	Issuer       string
+	Scopes       []string
+	ResponseMode string
+}{
+	"google": {
+		Issuer: "https://accounts.google.com",
+		Scopes: []string{"openid", "email", "profile"},
+	},
+	"apple": {
+		Issuer:       "https://appleid.apple.com",
+		Scopes:       []string{"openid", "email", "name"},
+		ResponseMode: "form_post",
+	},
+}
+
+// the JWKS is refetched at most this often when an unknown key id shows up
+const oidcKeysRefreshInterval = time.Minute
+
+func (p *OIDCProvider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (p *OIDCProvider) discover() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tokenEndpoint != "" {
+		return nil
+	}
+
+	res, err := p.client().Get(strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc discovery of %v failed with status %v", p.Name, res.StatusCode)
+	}
+
+	discovery := &struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(discovery)
+	if err != nil {
+		return err
+	}
+
+	if discovery.Issuer != p.Issuer {
+		return fmt.Errorf("oidc discovery of %v returned issuer %v", p.Name, discovery.Issuer)
+	}
+
+	p.authorizationEndpoint = discovery.AuthorizationEndpoint
+	p.tokenEndpoint = discovery.TokenEndpoint
+	p.jwksURI = discovery.JWKSURI
+	return nil
+}
+
+// AuthCodeURL returns the provider login page the user is redirected to ...
+func (p *OIDCProvider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	if p.ResponseMode != "" {
+		params.Set("response_mode", p.ResponseMode)
+	}
+
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.authorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the raw ID token ...
+func (p *OIDCProvider) Exchange(code, codeVerifier string) (string, error) {
+	err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	res, err := p.client().PostForm(p.tokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	tokenRes := &struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(tokenRes)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK || tokenRes.Error != "" {
+		return "", fmt.Errorf("oidc token exchange failed: %v %v", tokenRes.Error, tokenRes.ErrorDescription)
+	}
+	if tokenRes.IDToken == "" {
+		return "", errors.New("oidc token response has no id token")
+	}
+	return tokenRes.IDToken, nil
+}
+
+// VerifyIDToken checks the signature against the provider JWKS and validates issuer,
+// audience, expiry and nonce.
+func (p *OIDCProvider) VerifyIDToken(rawIDToken, nonce string) (*OIDCIdentity, error) {
+	err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, fmt.Errorf("unexpected id token algorithm %v", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(p.Issuer, true) {
+		return nil, errors.New("id token issuer does not match")
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, errors.New("id token audience does not match")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("id token is expired")
+	}
+	if claimString(claims, "nonce") != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	identity := &OIDCIdentity{
+		Subject: claimString(claims, "sub"),
+		Email:   claimString(claims, "email"),
+		Name:    claimString(claims, "name"),
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	//some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	return identity, nil
+}
+
+func (p *OIDCProvider) publicKey(kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	if ok {
+		return key, nil
+	}
+
+	//unknown key id, the provider may have rotated its keys
+	if time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval && p.keys != nil {
+		return nil, fmt.Errorf("unknown id token key %v", kid)
+	}
+
+	keys, err := p.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	key, ok = p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown id token key %v", kid)
+	}
+	return key, nil
+}
+
+func (p *OIDCProvider) fetchKeys() (map[string]*rsa.PublicKey, error) {
+	res, err := p.client().Get(p.jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	jwks := &struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	err = json.NewDecoder(res.Body).Decode(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge ...
+func NewPKCE() (string, string, error) {
+	verifier, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func claimString(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
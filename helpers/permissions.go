@@ -0,0 +1,74 @@
+package helpers
+
+// Built-in role names. Roles are stored in the database, these are only the ones seeded on start.
+const (
+	RoleSuperAdmin     = "super-admin"
+	RoleAdmin          = "admin"
+	RoleWarehouse      = "warehouse"
+	RoleCatalogManager = "catalog-manager"
+	RoleSupport        = "support"
+	RoleCustomer       = "customer"
+)
+
+const (
+	//grants every permission, only given to super-admin
+	PermissionAll = "*"
+
+	PermissionCustomersRead      = "customers:read"
+	PermissionCustomersWrite     = "customers:write"
+	PermissionCustomersDelete    = "customers:delete"
+	PermissionProductsWrite      = "products:write"
+	PermissionOrdersRead         = "orders:read"
+	PermissionOrdersUpdateStatus = "orders:update-status"
+	PermissionOrdersCancel       = "orders:cancel"
+	PermissionOrdersDelete       = "orders:delete"
+	PermissionAccountsUnlock     = "accounts:unlock"
+	PermissionRolesManage        = "roles:manage"
+	PermissionAPIKeysManage      = "api-keys:manage"
+	PermissionAuditRead          = "audit:read"
+)
+
+// Permissions lists every permission a role can be given ...
+var Permissions = []string{
+	PermissionAll,
+	PermissionCustomersRead,
+	PermissionCustomersWrite,
+	PermissionCustomersDelete,
+	PermissionProductsWrite,
+	PermissionOrdersRead,
+	PermissionOrdersUpdateStatus,
+	PermissionOrdersCancel,
+	PermissionOrdersDelete,
+	PermissionAccountsUnlock,
+	PermissionRolesManage,
+	PermissionAPIKeysManage,
+	PermissionAuditRead,
+}
+
+func IsKnownPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the role grants the permission and, for API key callers,
+// whether the key was scoped to it.
+func (claims *Claims) HasPermission(permission string) bool {
+	if !claims.InScope(permission) {
+		return false
+	}
+	for _, p := range claims.Permissions {
+		if p == permission || p == PermissionAll {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the token belongs to a back office account ...
+func (claims *Claims) IsStaff() bool {
+	return len(claims.Permissions) > 0
+}
@@ -0,0 +1,17 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the address of the client. Forwarding headers are only read from the
+// configured trusted proxies, see middleware.TrustedProxies, any client can set them to
+// dodge per-IP limits.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
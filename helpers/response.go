@@ -2,24 +2,22 @@ package helpers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+
+	"go.uber.org/zap"
 )
 
 type Response struct {
-	Status  string      `json:"status"`
-	Message string      `json:"message"`
-	Details interface{} `json:"details"`
+	Status  string       `json:"status"`
+	Code    string       `json:"code,omitempty"`
+	Message string       `json:"message"`
+	Details interface{}  `json:"details"`
+	Errors  []FieldError `json:"errors,omitempty"`
 }
 
+// JsonResponse writes a successful response. A client that went away is no reason to stop
+// the server, so failed writes are only logged to the global logger.
 func JsonResponse(w http.ResponseWriter, status, message string, details interface{}) {
-	var err error
-	defer func() {
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-
 	response := &Response{
 		Status:  status,
 		Message: message,
@@ -27,8 +25,17 @@ func JsonResponse(w http.ResponseWriter, status, message string, details interfa
 	}
 
 	jsonRes, err := json.Marshal(response)
+	if err != nil {
+		zap.S().Errorw("failed to encode response", "error", err)
+		ErrorResponse(w, nil, nil, NewInternalError(err))
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_, err = w.Write(jsonRes)
+	if err != nil {
+		zap.S().Debugw("failed to write response", "error", err)
+	}
 }
 
 func JsonUserList(objectList interface{}, w http.ResponseWriter) error {
@@ -44,3 +51,27 @@ func JsonUserList(objectList interface{}, w http.ResponseWriter) error {
 
 	return nil
 }
+
+// ErrorResponse reports err with the status of its kind. Internal errors are logged with the
+// request logger and their cause is kept from the client, a nil logger logs nothing.
+func ErrorResponse(w http.ResponseWriter, r *http.Request, logger *zap.SugaredLogger, err error) {
+	appErr := AsAppError(err)
+	if appErr.Kind == KindInternal && logger != nil && r != nil {
+		Logger(r.Context(), logger).Errorw("request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+
+	jsonRes, err := json.Marshal(&Response{
+		Status:  "FAIL",
+		Code:    appErr.Code,
+		Message: appErr.Message,
+		Errors:  appErr.Fields,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(appErr.Status())
+	_, _ = w.Write(jsonRes)
+}
@@ -0,0 +1,254 @@
+package helpers
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DateLayout is the ISO 8601 date format of dates sent without a time, like the date of birth
+const DateLayout = "2006-01-02"
+
+var slugPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Validate checks v against the `validate` tags of its fields and reports every failing field at once.
+// Nested structs, pointers to structs and slices of them are checked too. The rules are
+//
+//	required     the value is not empty
+//	omitempty    skip the other rules when the value is empty
+//	min=N max=N  length of strings and slices, value of numbers
+//	gt=N gte=N   value of numbers
+//	lte=N        value of numbers
+//	oneof=a b c  the string is one of the listed values
+//	email        the string is a plain email address
+//	date         the string is a YYYY-MM-DD date
+//	past         the YYYY-MM-DD date lies before today
+//	slug         the string is lowercase letters, digits or dashes starting with a letter
+//
+// Fields are named by their json name, a rule that does not parse is a programming error and panics.
+func Validate(v interface{}) error {
+	fields := validateValue(reflect.ValueOf(v), "")
+	if len(fields) == 0 {
+		return nil
+	}
+
+	messages := []string{}
+	for _, field := range fields {
+		messages = append(messages, field.Field+" "+field.Message)
+	}
+	return NewValidationError("invalid_fields", "NOTE: "+strings.Join(messages, ", "), fields...)
+}
+
+func validateValue(value reflect.Value, path string) []FieldError {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	fields := []FieldError{}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			fields = append(fields, validateValue(value.Index(i), fmt.Sprintf("%v[%v]", path, i))...)
+		}
+	case reflect.Struct:
+		valueType := value.Type()
+		for i := 0; i < valueType.NumField(); i++ {
+			field := valueType.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			fieldPath := joinFieldPath(path, field)
+			if fieldPath == "" {
+				continue
+			}
+
+			if tag := field.Tag.Get("validate"); tag != "" {
+				if message := checkRules(value.Field(i), tag); message != "" {
+					fields = append(fields, FieldError{Field: fieldPath, Message: message})
+					continue
+				}
+			}
+
+			if field.Anonymous {
+				fieldPath = path
+			}
+			fields = append(fields, validateValue(value.Field(i), fieldPath)...)
+		}
+	}
+	return fields
+}
+
+// joinFieldPath names the field after its json name, fields hidden from json are skipped
+func joinFieldPath(path string, field reflect.StructField) string {
+	name := field.Name
+	if tag := field.Tag.Get("json"); tag != "" {
+		if tag == "-" {
+			return ""
+		}
+		if jsonName := strings.Split(tag, ",")[0]; jsonName != "" {
+			name = jsonName
+		}
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// checkRules returns the message of the first rule the value breaks, or "" when it passes ...
+func checkRules(value reflect.Value, tag string) string {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+
+		if name == "omitempty" {
+			if value.IsZero() {
+				return ""
+			}
+			continue
+		}
+
+		message := checkRule(value, name, param)
+		if message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+func checkRule(value reflect.Value, name, param string) string {
+	switch name {
+	case "required":
+		if isEmpty(value) {
+			return "is required"
+		}
+	case "min":
+		if isSized(value) && size(value) < parseInt(param) {
+			return fmt.Sprintf("must have at least %v %v", param, sizeUnit(value))
+		}
+		if !isSized(value) && number(value) < parseFloat(param) {
+			return fmt.Sprintf("must be at least %v", param)
+		}
+	case "max":
+		if isSized(value) && size(value) > parseInt(param) {
+			return fmt.Sprintf("must have at most %v %v", param, sizeUnit(value))
+		}
+		if !isSized(value) && number(value) > parseFloat(param) {
+			return fmt.Sprintf("must be at most %v", param)
+		}
+	case "gt":
+		if number(value) <= parseFloat(param) {
+			return fmt.Sprintf("must be greater than %v", param)
+		}
+	case "gte":
+		if number(value) < parseFloat(param) {
+			return fmt.Sprintf("must be at least %v", param)
+		}
+	case "lte":
+		if number(value) > parseFloat(param) {
+			return fmt.Sprintf("must be at most %v", param)
+		}
+	case "oneof":
+		allowed := strings.Fields(param)
+		for _, option := range allowed {
+			if value.String() == option {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %v", strings.Join(allowed, ", "))
+	case "email":
+		emailAddress, err := mail.ParseAddress(value.String())
+		if err != nil || emailAddress.Address != value.String() {
+			return "must be a valid email address"
+		}
+	case "date":
+		_, err := time.Parse(DateLayout, value.String())
+		if err != nil {
+			return "must be a date in YYYY-MM-DD format"
+		}
+	case "past":
+		date, err := time.Parse(DateLayout, value.String())
+		if err == nil && !date.Before(time.Now()) {
+			return "must be in the past"
+		}
+	case "slug":
+		if !slugPattern.MatchString(value.String()) {
+			return "must be lowercase letters, digits or dashes starting with a letter"
+		}
+	default:
+		panic(fmt.Sprintf("unknown validation rule %q", name))
+	}
+	return ""
+}
+
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// isSized reports whether min and max measure the length, strings count characters and not bytes
+func isSized(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func size(value reflect.Value) int {
+	if value.Kind() == reflect.String {
+		return utf8.RuneCountInString(value.String())
+	}
+	return value.Len()
+}
+
+func sizeUnit(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return "characters"
+	}
+	return "items"
+}
+
+func number(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	}
+	panic(fmt.Sprintf("validation rule used on a %v", value.Kind()))
+}
+
+func parseInt(param string) int {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		panic(fmt.Sprintf("validation rule needs a whole number, got %q", param))
+	}
+	return n
+}
+
+func parseFloat(param string) float64 {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation rule needs a number, got %q", param))
+	}
+	return n
+}
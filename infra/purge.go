@@ -0,0 +1,64 @@
+package infra
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PurgeConfig controls how long soft deleted records stay in the trash ...
+type PurgeConfig struct {
+	//records deleted longer ago than this are removed for good
+	Retention time.Duration
+	//how often the job runs, zero or less turns it off
+	Interval time.Duration
+}
+
+// Purger is implemented by the models that support soft delete ...
+type Purger interface {
+	Purge(before time.Time) (int64, error)
+}
+
+// PurgeTarget names a purger for the logs, targets are purged in the order given
+type PurgeTarget struct {
+	Name   string
+	Purger Purger
+}
+
+// StartPurgeJob purges the targets once right away and then every interval until stop is called ...
+func StartPurgeJob(config PurgeConfig, logger *zap.SugaredLogger, targets ...PurgeTarget) (stop func()) {
+	if config.Interval <= 0 {
+		logger.Infow("purge job is disabled")
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for {
+			RunPurge(config.Retention, logger, targets...)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// RunPurge removes everything deleted longer than retention ago ...
+func RunPurge(retention time.Duration, logger *zap.SugaredLogger, targets ...PurgeTarget) {
+	before := time.Now().Add(-retention)
+	for _, target := range targets {
+		purged, err := target.Purger.Purge(before)
+		if err != nil {
+			logger.Errorw("purge failed", "target", target.Name, "error", err)
+			continue
+		}
+		if purged > 0 {
+			logger.Infow("purged deleted records", "target", target.Name, "count", purged, "deleted_before", before)
+		}
+	}
+}
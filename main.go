@@ -1,106 +1,83 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"future-fashion/handlers"
+	"go.uber.org/zap"
+
+	"future-fashion/app"
+	"future-fashion/config"
 	"future-fashion/helpers"
 	"future-fashion/infra"
-	"future-fashion/models"
-
-	"github.com/gorilla/mux"
-	"github.com/rs/cors"
 )
 
 func main() {
-	// Init DB
-	db, err := infra.InitDB()
+	//future-fashion migrate up|down [n]|status [flags]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Init Config
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
+	helpers.TokenTTL = cfg.Auth.TokenTTL
 
 	// Init Logger
-	logger := helpers.InitLogger()
-
-	// Init Models
-	userModel := &models.UserCRUDOperationsImpl{
-		DB:     db,
-		Logger: logger,
-	}
-
-	credentialModel := &models.CredentialOperationsImpl{
-		DB: db,
+	logger, err := helpers.InitLogger(cfg.Logger.Level, cfg.Logger.Format)
+	if err != nil {
+		log.Fatal(err)
 	}
+	//for the few places without a logger of their own, like failed response writes
+	zap.ReplaceGlobals(logger.Desugar())
 
-	productModel := &models.ProductCRUDOperationsImpl{
-		DB:     db,
-		Logger: logger,
+	// Init DB
+	db, err := infra.InitDB(cfg.Database, logger)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	orderModel := &models.OrderCRUDOperationsImpl{
-		DB:     db,
-		Logger: logger,
-	}
+	// Init Mailer
+	mailer := app.NewMailer(cfg.Mailer, logger)
 
-	// Init Handlers
-	userHandler := &handlers.UserHandler{
-		UserModel:       userModel,
-		CredentialModel: credentialModel,
-		Logger:          logger,
+	// Init App
+	api, err := app.New(cfg, db, mailer, logger)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	adminHandler := &handlers.AdminHandler{
-		UserModel:       userModel,
-		CredentialModel: credentialModel,
-		Logger:          logger,
-	}
+	// Init Server
+	//SIGTERM comes from the orchestrator on deploys, requests in flight are finished first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	productHandler := &handlers.ProductHandler{
-		ProductModel:    productModel,
-		CredentialModel: credentialModel,
-		Logger:          logger,
+	listener, err := net.Listen("tcp", cfg.Server.Addr)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	orderHandler := &handlers.OrderHandler{
-		OrderModel:      orderModel,
-		CredentialModel: credentialModel,
-		Logger:          logger,
+	fmt.Printf("HTTP server running on %v (%v)\n", cfg.Server.Addr, cfg.Environment)
+	err = api.Serve(ctx, listener, cfg.Server)
+	if err != nil {
+		logger.Errorw("server did not shut down cleanly", "error", err)
 	}
 
-	r := mux.NewRouter()
-	//User Handlers
-	r.HandleFunc("/user/signup", userHandler.SignUp).Methods("POST")
-	r.HandleFunc("/user/login", userHandler.Login).Methods("POST")
-	r.HandleFunc("/user/edit-personal-info", userHandler.EditPersonalInfo).Methods("PATCH")
-	r.HandleFunc("/user/personal-info", userHandler.GetPersonalInfo).Methods("GET")
-
-	//Admin Handlers
-	r.HandleFunc("/admin/create-customer", adminHandler.CreateCustomer).Methods("POST")
-	r.HandleFunc("/admin/delete-customer", adminHandler.DeleteCustomer).Methods("DELETE")
-	r.HandleFunc("/admin/list-customers", adminHandler.ListCustomers).Methods("GET")
-	r.HandleFunc("/admin/get-customer-info", adminHandler.GetCustomerInfo).Methods("GET")
-	r.HandleFunc("/admin/edit-customer", adminHandler.EditCustomer).Methods("PATCH")
-	r.HandleFunc("/admin/login", adminHandler.AdminLogin).Methods("POST")
-
-	//Product Handlers
-	r.HandleFunc("/product/create-product", productHandler.CreateProduct).Methods("POST")
-	r.HandleFunc("/product/delete-product", productHandler.DeleteProduct).Methods("DELETE")
-	r.HandleFunc("/product/list-products", productHandler.ListProducts).Methods("GET")
-	r.HandleFunc("/product/edit-product", productHandler.EditProduct).Methods("PATCH")
-
-	//Order Handlers
-	r.HandleFunc("/order/create-order", orderHandler.CreateOrder).Methods("POST")
-	r.HandleFunc("/order/delete-order", orderHandler.DeleteOrder).Methods("DELETE")
-	r.HandleFunc("/order/edit-order-status", orderHandler.EditOrderStatus).Methods("PATCH")
-	r.HandleFunc("/order/list-orders", orderHandler.ListOrders).Methods("GET")
-	r.HandleFunc("/order/list-orders-user", orderHandler.ListOrdersByUserID).Methods("GET")
-
-	fmt.Println("HTTP server running on http://127.0.0.1:8080")
-	handler := cors.AllowAll().Handler(r)
-	err = http.ListenAndServe(":8080", handler)
-	if err != nil {
-		log.Fatal(err)
+	//background jobs stop before the database they use is closed
+	api.Close()
+	sqlDB, err := db.DB()
+	if err == nil {
+		sqlDB.Close()
 	}
+	logger.Infow("server stopped")
 }
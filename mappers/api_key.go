@@ -0,0 +1,30 @@
+package mappers
+
+import (
+	"future-fashion/dto"
+	"future-fashion/models"
+)
+
+func APIKey(apiKey *models.APIKey) *dto.APIKeyResponse {
+	return &dto.APIKeyResponse{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		UserID:     apiKey.UserID,
+		Scopes:     apiKey.ScopeList(),
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		RevokedAt:  apiKey.RevokedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
+
+func APIKeys(apiKeys []*models.APIKey) *dto.ListAPIKeysResponse {
+	apiKeysResponse := &dto.ListAPIKeysResponse{
+		APIKeys: []*dto.APIKeyResponse{},
+	}
+	for _, apiKey := range apiKeys {
+		apiKeysResponse.APIKeys = append(apiKeysResponse.APIKeys, APIKey(apiKey))
+	}
+	return apiKeysResponse
+}
@@ -0,0 +1,44 @@
+package mappers
+
+import (
+	"encoding/json"
+
+	"future-fashion/dto"
+	"future-fashion/models"
+)
+
+func AuditLog(entry *models.AuditLog) *dto.AuditLogResponse {
+	return &dto.AuditLogResponse{
+		ID:            entry.ID,
+		ActorID:       entry.ActorID,
+		ActorUsername: entry.ActorUsername,
+		ActorRole:     entry.ActorRole,
+		ViaAPIKey:     entry.ViaAPIKey,
+		Action:        entry.Action,
+		TargetType:    entry.TargetType,
+		TargetID:      entry.TargetID,
+		Before:        rawJSON(entry.Before),
+		After:         rawJSON(entry.After),
+		Diff:          rawJSON(entry.Diff),
+		IP:            entry.IP,
+		CreatedAt:     entry.CreatedAt,
+	}
+}
+
+func AuditLogs(entries []*models.AuditLog) *dto.ListAuditLogsResponse {
+	auditLogsResponse := &dto.ListAuditLogsResponse{
+		AuditLogs: []*dto.AuditLogResponse{},
+	}
+	for _, entry := range entries {
+		auditLogsResponse.AuditLogs = append(auditLogsResponse.AuditLogs, AuditLog(entry))
+	}
+	return auditLogsResponse
+}
+
+// stored json is embedded as is, an empty column becomes null
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
@@ -0,0 +1,48 @@
+package mappers
+
+import (
+	"encoding/json"
+
+	"future-fashion/dto"
+	"future-fashion/models"
+)
+
+func Order(order *models.Order) (*dto.OrderResponse, error) {
+	snapshotsObj, err := unmarshalSnapshots(order.Snapshots)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.OrderResponse{
+		ID:        order.ID,
+		Total:     order.Total,
+		Status:    order.Status,
+		Snapshots: snapshotsObj,
+		UserID:    order.UserID,
+		CreatedAt: order.CreatedAt,
+		DeletedAt: deletedAt(order.DeletedAt),
+	}, nil
+}
+
+func Orders(orders []*models.Order) (*dto.ListOrdersResponse, error) {
+	orderResponse := &dto.ListOrdersResponse{
+		Orders: []*dto.OrderResponse{},
+	}
+	for _, order := range orders {
+		orderRes, err := Order(order)
+		if err != nil {
+			return nil, err
+		}
+		orderResponse.Orders = append(orderResponse.Orders, orderRes)
+	}
+	return orderResponse, nil
+}
+
+func unmarshalSnapshots(snapshots string) ([]*dto.CartModel, error) {
+	var cartModels []*dto.CartModel
+	err := json.Unmarshal([]byte(snapshots), &cartModels)
+	if err != nil {
+		return nil, err
+	}
+	return cartModels, nil
+}
@@ -0,0 +1,28 @@
+package mappers
+
+import (
+	"future-fashion/dto"
+	"future-fashion/models"
+)
+
+func Measurements(user *models.User) *dto.MeasurementsResponse {
+	return &dto.MeasurementsResponse{
+		Chest: user.Chest,
+		Waist: user.Waist,
+		Hip:   user.Hip,
+	}
+}
+
+func UserIdentities(identities []*models.UserIdentity) *dto.ListUserIdentitiesResponse {
+	identitiesResponse := &dto.ListUserIdentitiesResponse{
+		Identities: []*dto.UserIdentityResponse{},
+	}
+	for _, identity := range identities {
+		identitiesResponse.Identities = append(identitiesResponse.Identities, &dto.UserIdentityResponse{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+	return identitiesResponse
+}
@@ -0,0 +1,74 @@
+package mappers
+
+import (
+	"encoding/json"
+
+	"future-fashion/dto"
+	"future-fashion/models"
+)
+
+func Product(product *models.Product) (*dto.ProductResponse, error) {
+	var picturesList []string
+	err := json.Unmarshal([]byte(product.Pictures), &picturesList)
+	if err != nil {
+		return nil, err
+	}
+
+	xsModel, err := unmarshalSizing(product.XS)
+	if err != nil {
+		return nil, err
+	}
+	sModel, err := unmarshalSizing(product.S)
+	if err != nil {
+		return nil, err
+	}
+	mModel, err := unmarshalSizing(product.M)
+	if err != nil {
+		return nil, err
+	}
+	lModel, err := unmarshalSizing(product.L)
+	if err != nil {
+		return nil, err
+	}
+	xlModel, err := unmarshalSizing(product.XL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.ProductResponse{
+		ID:        product.ID,
+		Item:      product.Item,
+		Price:     product.Price,
+		Stock:     product.Stock,
+		Pictures:  picturesList,
+		XS:        xsModel,
+		S:         sModel,
+		M:         mModel,
+		L:         lModel,
+		XL:        xlModel,
+		DeletedAt: deletedAt(product.DeletedAt),
+	}, nil
+}
+
+func Products(products []*models.Product) (*dto.ListProductsResponse, error) {
+	productsResponse := &dto.ListProductsResponse{
+		Products: []*dto.ProductResponse{},
+	}
+	for _, product := range products {
+		productRes, err := Product(product)
+		if err != nil {
+			return nil, err
+		}
+		productsResponse.Products = append(productsResponse.Products, productRes)
+	}
+	return productsResponse, nil
+}
+
+func unmarshalSizing(sizing string) (*dto.Sizing, error) {
+	var sizingModel *dto.Sizing
+	err := json.Unmarshal([]byte(sizing), &sizingModel)
+	if err != nil {
+		return nil, err
+	}
+	return sizingModel, nil
+}
@@ -0,0 +1,26 @@
+package mappers
+
+import (
+	"future-fashion/dto"
+	"future-fashion/models"
+)
+
+func Role(role *models.Role) *dto.RoleResponse {
+	return &dto.RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description,
+		Builtin:     role.Builtin,
+		Permissions: role.PermissionNames(),
+	}
+}
+
+func Roles(roles []*models.Role) *dto.ListRolesResponse {
+	rolesResponse := &dto.ListRolesResponse{
+		Roles: []*dto.RoleResponse{},
+	}
+	for _, role := range roles {
+		rolesResponse.Roles = append(rolesResponse.Roles, Role(role))
+	}
+	return rolesResponse
+}
@@ -0,0 +1,67 @@
+// Package mappers converts models into response dtos. Handlers never serialize
+// models directly, so fields like password hashes cannot end up in a response.
+package mappers
+
+import (
+	"time"
+
+	"future-fashion/dto"
+	"future-fashion/models"
+
+	"gorm.io/gorm"
+)
+
+func User(user *models.User) *dto.UserResponse {
+	return &dto.UserResponse{
+		ID:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerified,
+		DOB:              user.DOB,
+		Role:             user.Role,
+		Chest:            user.Chest,
+		Waist:            user.Waist,
+		Hip:              user.Hip,
+		TwoFactorEnabled: user.TOTPEnabled,
+		CreatedAt:        user.CreatedAt,
+		DeletedAt:        deletedAt(user.DeletedAt),
+	}
+}
+
+func Users(users []*models.User) *dto.ListUsersResponse {
+	usersResponse := &dto.ListUsersResponse{
+		Users: []*dto.UserResponse{},
+	}
+	for _, user := range users {
+		usersResponse.Users = append(usersResponse.Users, User(user))
+	}
+	return usersResponse
+}
+
+func LockoutEvents(events []*models.LockoutEvent) *dto.ListLockoutEventsResponse {
+	eventsResponse := &dto.ListLockoutEventsResponse{
+		Events: []*dto.LockoutEventResponse{},
+	}
+	for _, event := range events {
+		eventsResponse.Events = append(eventsResponse.Events, &dto.LockoutEventResponse{
+			ID:          event.ID,
+			Kind:        event.Kind,
+			Identifier:  event.Identifier,
+			Event:       event.Event,
+			Failures:    event.Failures,
+			LockedUntil: event.LockedUntil,
+			IP:          event.IP,
+			Actor:       event.Actor,
+			CreatedAt:   event.CreatedAt,
+		})
+	}
+	return eventsResponse
+}
+
+// only records in the trash have a deletion time
+func deletedAt(d gorm.DeletedAt) *time.Time {
+	if !d.Valid {
+		return nil
+	}
+	return &d.Time
+}
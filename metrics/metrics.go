@@ -0,0 +1,159 @@
+// Package metrics holds the Prometheus collectors of the api: http traffic, the database
+// connection pool and business events. Every app gets its own registry so tests can run
+// several apps in one process, and a nil *Metrics records nothing so models built by the
+// cli and the fakes need none.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "future_fashion"
+
+// signup methods
+const (
+	SignupPassword = "password"
+	SignupOIDC     = "oidc"
+)
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	ordersCreated   prometheus.Counter
+	revenue         prometheus.Counter
+	outOfStock      prometheus.Counter
+	signups         *prometheus.CounterVec
+	failedLogins    prometheus.Counter
+	lockouts        *prometheus.CounterVec
+}
+
+// New registers every collector on a fresh registry, including the go runtime and process ones ...
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to answer HTTP requests by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		ordersCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "orders_created_total",
+			Help:      "Orders placed.",
+		}),
+		revenue: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "revenue_total",
+			Help:      "Sum of the totals of the orders placed.",
+		}),
+		outOfStock: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "out_of_stock_rejections_total",
+			Help:      "Checkouts rejected because a product did not have enough stock.",
+		}),
+		signups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signups_total",
+			Help:      "Customer accounts created by signup method.",
+		}, []string{"method"}),
+		failedLogins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_logins_total",
+			Help:      "Login attempts rejected for wrong credentials.",
+		}),
+		lockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_lockouts_total",
+			Help:      "Accounts and IPs locked after too many failed logins, by kind.",
+		}, []string{"kind"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.ordersCreated,
+		m.revenue,
+		m.outOfStock,
+		m.signups,
+		m.failedLogins,
+		m.lockouts,
+	)
+	return m
+}
+
+// RegisterDB exports the connection pool stats of db, name tells databases apart ...
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	return m.Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the registry in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest counts a finished request and records how long it took ...
+func (m *Metrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(route, method).Observe(elapsed.Seconds())
+}
+
+// OrderCreated counts an order and adds its total to the revenue
+func (m *Metrics) OrderCreated(total float32) {
+	if m == nil {
+		return
+	}
+	m.ordersCreated.Inc()
+	m.revenue.Add(float64(total))
+}
+
+// OutOfStock counts a checkout rejected for a product without enough stock
+func (m *Metrics) OutOfStock() {
+	if m == nil {
+		return
+	}
+	m.outOfStock.Inc()
+}
+
+// SignedUp counts a new customer account
+func (m *Metrics) SignedUp(method string) {
+	if m == nil {
+		return
+	}
+	m.signups.WithLabelValues(method).Inc()
+}
+
+// LoginFailed counts a login rejected for wrong credentials
+func (m *Metrics) LoginFailed() {
+	if m == nil {
+		return
+	}
+	m.failedLogins.Inc()
+}
+
+// LockedOut counts an account or IP that just got locked
+func (m *Metrics) LockedOut(kind string) {
+	if m == nil {
+		return
+	}
+	m.lockouts.WithLabelValues(kind).Inc()
+}
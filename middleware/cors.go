@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/cors"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvProduction  = "production"
+)
+
+// CORSConfig lists which websites may call the api from a browser ...
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	MaxAge         time.Duration
+}
+
+// CORSExposedHeaders are the response headers a browser client may read ...
+var CORSExposedHeaders = []string{"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Content-Disposition", RequestIDHeader}
+
+// CORS wraps the handler, requests from origins that are not listed get no CORS headers
+// and are blocked by the browser ...
+func CORS(config CORSConfig) func(http.Handler) http.Handler {
+	return cors.New(cors.Options{
+		AllowedOrigins: config.AllowedOrigins,
+		AllowedMethods: config.AllowedMethods,
+		AllowedHeaders: config.AllowedHeaders,
+		ExposedHeaders: config.ExposedHeaders,
+		MaxAge:         int(config.MaxAge.Seconds()),
+		//tokens are sent in headers, never in cookies
+		AllowCredentials: false,
+	}).Handler
+}
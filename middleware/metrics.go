@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"future-fashion/metrics"
+)
+
+// Metrics wraps the router from outside, so requests turned away by its middleware and
+// the 404s and 405s it answers itself are counted too, under the "unknown" route. Requests
+// are labelled with the route template and not the path, ids in query strings and paths
+// would make a series per record ...
+func Metrics(m *metrics.Metrics, router *mux.Router) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := matchedRoute(router, r)
+
+			recorder := newResponseRecorder(w)
+			start := time.Now()
+			next.ServeHTTP(recorder, r)
+			m.ObserveRequest(route, r.Method, recorder.status, time.Since(start))
+		})
+	}
+}
+
+// matchedRoute is the template of the route the router will pick, the route is not in
+// the request yet outside the router
+func matchedRoute(router *mux.Router, r *http.Request) string {
+	match := &mux.RouteMatch{}
+	if !router.Match(r, match) || match.Route == nil || match.MatchErr != nil {
+		return "unknown"
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return "unknown"
+	}
+	return template
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseTrustedProxies reads a list of proxy addresses, each an IP or a CIDR range
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			proxy = fmt.Sprintf("%v/%v", proxy, bits)
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// TrustedProxies replaces the remote address of requests that come through a trusted proxy with
+// the client address in X-Forwarded-For, so per-IP limits and logs see the client and not the load
+// balancer. The header is read from the right and the first address that is not a trusted proxy
+// is the client, anything left of it could have been sent by the client itself. Requests from
+// other peers keep their address, whatever headers they send. Goes outside every other middleware ...
+func TrustedProxies(proxies []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(proxies) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if client := forwardedClient(r, proxies); client != "" {
+				r.RemoteAddr = net.JoinHostPort(client, "0")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forwardedClient(r *http.Request, proxies []*net.IPNet) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !isTrustedProxy(peer, proxies) {
+		return ""
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	client := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			//a malformed hop was not written by a proxy we trust, stop at the last good one
+			break
+		}
+		client = hops[i]
+		if !isTrustedProxy(hops[i], proxies) {
+			break
+		}
+	}
+	return client
+}
+
+func isTrustedProxy(address string, proxies []*net.IPNet) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
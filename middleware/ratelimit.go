@@ -0,0 +1,184 @@
+// Package middleware holds the http middlewares wrapped around the router.
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"future-fashion/helpers"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// What a bucket is keyed by. user and api-key are read from the credentials without going to
+// the database, the handler verifies them. A JWT is checked against the token key, so made up
+// tokens fall back to the client IP. An API key can only be checked in the database, so it is
+// keyed by its hash and a client whose keys are refused is also limited by IP, see Middleware.
+// A user with several API keys gets a bucket per key.
+const (
+	KeyByIP     = "ip"
+	KeyByUser   = "user"
+	KeyByAPIKey = "api-key"
+)
+
+// the token key is read from the database at most this often
+const tokenKeyCacheTTL = time.Minute
+
+type RouteLimit struct {
+	Limit
+	KeyBy string
+}
+
+// RateLimitConfig has the limit for every route without its own entry in Routes.
+// Routes is keyed by the mux path template, e.g. /product/list-products.
+type RateLimitConfig struct {
+	Enabled bool
+	Default RouteLimit
+	Routes  map[string]RouteLimit
+}
+
+type RateLimiter struct {
+	Config   RateLimitConfig
+	Store    Store
+	TokenKey func() (string, error)
+	Logger   *zap.SugaredLogger
+
+	mu              sync.Mutex
+	tokenKey        string
+	tokenKeyFetched time.Time
+}
+
+// Middleware is meant for mux.Router.Use, it needs the matched route for per-route limits.
+// Requests with an API key whose key is refused by the handler are counted against the client
+// IP as well, once that runs out the IP is turned away before any key is looked up ...
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rl.Config.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		//routes without their own limit share one bucket per client
+		routeKey := "*"
+		limit := rl.Config.Default
+		if route := mux.CurrentRoute(r); route != nil {
+			template, err := route.GetPathTemplate()
+			if routeLimit, ok := rl.Config.Routes[template]; err == nil && ok {
+				routeKey = template
+				limit = routeLimit
+			}
+		}
+
+		if limit.Requests <= 0 || limit.Per <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		clientKey, unverified := rl.clientKey(r, limit.KeyBy)
+		refusedKey := routeKey + "|refused:" + helpers.ClientIP(r)
+		if unverified {
+			refused, err := rl.Store.Peek(refusedKey, limit.Limit, time.Now())
+			if err != nil {
+				rl.Logger.Errorw("rate limit store failed", "error", err)
+			} else if !refused.Allowed {
+				rl.reject(w, r, limit, refused)
+				return
+			}
+		}
+
+		result, err := rl.Store.Take(routeKey+"|"+clientKey, limit.Limit, time.Now())
+		if err != nil {
+			//a broken store must not take the api down with it
+			rl.Logger.Errorw("rate limit store failed", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !result.Allowed {
+			rl.reject(w, r, limit, result)
+			return
+		}
+		setRateLimitHeaders(w, limit, result)
+
+		if !unverified {
+			next.ServeHTTP(w, r)
+			return
+		}
+		recorder := newResponseRecorder(w)
+		next.ServeHTTP(recorder, r)
+		if recorder.status == http.StatusUnauthorized {
+			_, err := rl.Store.Take(refusedKey, limit.Limit, time.Now())
+			if err != nil {
+				rl.Logger.Errorw("rate limit store failed", "error", err)
+			}
+		}
+	})
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, limit RouteLimit, result Result) {
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%v;w=%v", limit.Requests, int(limit.Per.Seconds())))
+	w.Header().Set("RateLimit-Limit", fmt.Sprint(result.Limit))
+	w.Header().Set("RateLimit-Remaining", fmt.Sprint(result.Remaining))
+	w.Header().Set("RateLimit-Reset", fmt.Sprint(ceilSeconds(result.Reset)))
+}
+
+func (rl *RateLimiter) reject(w http.ResponseWriter, r *http.Request, limit RouteLimit, result Result) {
+	setRateLimitHeaders(w, limit, result)
+	w.Header().Set("Retry-After", fmt.Sprint(ceilSeconds(result.RetryAfter)))
+	helpers.ErrorResponse(
+		w,
+		r,
+		rl.Logger,
+		helpers.NewTooManyRequestsError("rate_limited", "NOTE: Too many requests, please try again later"),
+	)
+}
+
+// clientKey picks the bucket of the request, unverified is set when it is keyed by an API key
+// that only the handler can check
+func (rl *RateLimiter) clientKey(r *http.Request, keyBy string) (key string, unverified bool) {
+	if keyBy == KeyByAPIKey || keyBy == KeyByUser {
+		if apiKey := helpers.GetAPIKey(r); apiKey != "" {
+			return "key:" + helpers.HashToken(apiKey), true
+		}
+		if tokenKey := rl.cachedTokenKey(); tokenKey != "" {
+			//only the user id is needed, the handler checks the rest
+			claims := &helpers.Claims{}
+			requestToken, err := claims.GetToken(r)
+			if err == nil {
+				claims, err = claims.VerifyToken(requestToken, tokenKey)
+			}
+			if err == nil {
+				return fmt.Sprintf("user:%v", claims.Id), false
+			}
+		}
+	}
+	return "ip:" + helpers.ClientIP(r), false
+}
+
+func (rl *RateLimiter) cachedTokenKey() string {
+	if rl.TokenKey == nil {
+		return ""
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.tokenKey != "" && time.Since(rl.tokenKeyFetched) < tokenKeyCacheTTL {
+		return rl.tokenKey
+	}
+	tokenKey, err := rl.TokenKey()
+	if err != nil {
+		rl.Logger.Errorw("failed to read the token key", "error", err)
+		//keep using the last key rather than sending every user to the IP buckets
+		return rl.tokenKey
+	}
+	rl.tokenKey = tokenKey
+	rl.tokenKeyFetched = time.Now()
+	return tokenKey
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
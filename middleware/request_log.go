@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"go.uber.org/zap"
+
+	"future-fashion/helpers"
+)
+
+// RequestIDHeader carries the request id, a valid one sent by the caller or a load balancer
+// is kept so the logs of both sides can be joined
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestLogger goes outside every other middleware. It gives each request an id, puts the
+// request logger in its context and writes one access log line once the response is sent.
+// Probes are logged at debug, they would drown everything else ...
+func RequestLogger(logger *zap.SugaredLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				var err error
+				id, err = helpers.GenerateRandomToken(16)
+				if err != nil {
+					helpers.ErrorResponse(w, r, logger, helpers.NewInternalError(err))
+					return
+				}
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			ctx, _ := helpers.WithRequestLog(r.Context(), logger, id)
+			r = r.WithContext(ctx)
+			recorder := newResponseRecorder(w)
+			start := time.Now()
+			next.ServeHTTP(recorder, r)
+
+			//the route and the user are known by now
+			requestLogger := helpers.Logger(ctx, logger)
+			log := requestLogger.Infow
+			switch {
+			case recorder.status >= http.StatusInternalServerError:
+				log = requestLogger.Errorw
+			case r.URL.Path == "/healthz" || r.URL.Path == "/readyz":
+				log = requestLogger.Debugw
+			}
+			log("request",
+				"method", r.Method,
+				//the path only, query strings may carry tokens
+				"path", r.URL.Path,
+				"status", recorder.status,
+				"bytes", recorder.bytes,
+				"duration", time.Since(start),
+				"ip", helpers.ClientIP(r),
+				"user_agent", r.UserAgent(),
+			)
+		})
+	}
+}
+
+// LogRoute is meant for mux.Router.Use, it adds the matched route to the request logger
+func LogRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestLog := helpers.GetRequestLog(r.Context()); requestLog != nil {
+			if template, ok := routeTemplate(r); ok {
+				requestLog.Route = template
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Recover turns a panic in a handler into a 500 and logs it with the stack, instead of
+// net/http dropping the connection. Goes inside RequestLogger so the log has the request id ...
+func Recover(logger *zap.SugaredLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				//used on purpose to abort a response, net/http handles it
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				helpers.Logger(r.Context(), logger).Errorw("handler panicked",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", fmt.Sprint(v),
+					"stack", string(debug.Stack()),
+				)
+				helpers.ErrorResponse(w, r, nil, helpers.NewInternalError(fmt.Errorf("panic: %v", v)))
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
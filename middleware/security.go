@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SecurityHeadersConfig controls the headers set on every response ...
+type SecurityHeadersConfig struct {
+	//only turn on when the api is served over https
+	HSTS                  bool
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	//the api only serves json, so nothing may be loaded or framed by default
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+}
+
+func SecurityHeadersConfigForEnvironment(env string) SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		HSTS:                  env == EnvStaging || env == EnvProduction,
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+		ReferrerPolicy:        "no-referrer",
+	}
+}
+
+func SecurityHeaders(config SecurityHeadersConfig) func(http.Handler) http.Handler {
+	hsts := fmt.Sprintf("max-age=%v", int(config.HSTSMaxAge.Seconds()))
+	if config.HSTSIncludeSubdomains {
+		hsts += "; includeSubDomains"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("X-Content-Type-Options", "nosniff")
+			header.Set("X-Frame-Options", "DENY")
+			if config.ReferrerPolicy != "" {
+				header.Set("Referrer-Policy", config.ReferrerPolicy)
+			}
+			if config.ContentSecurityPolicy != "" {
+				header.Set("Content-Security-Policy", config.ContentSecurityPolicy)
+			}
+			if config.HSTS {
+				header.Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
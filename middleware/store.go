@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: Requests tokens are added every Per, up to Burst tokens ...
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	//bucket size, defaults to Requests
+	Burst int
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Result is the state of a bucket after a request took from it ...
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	//time until the bucket is full again
+	Reset time.Duration
+	//time until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. MemoryStore works for a single instance, run several instances
+// behind a shared Store (e.g. redis) so a client cannot spread requests across them.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+	//Peek reports whether Take would be allowed without taking from the bucket
+	Peek(key string, limit Limit, now time.Time) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore keeps buckets in process memory, idle buckets are dropped on Sweep ...
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (m *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	return m.take(key, limit, now, 1), nil
+}
+
+func (m *MemoryStore) Peek(key string, limit Limit, now time.Time) (Result, error) {
+	return m.take(key, limit, now, 0), nil
+}
+
+func (m *MemoryStore) take(key string, limit Limit, now time.Time, cost float64) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	capacity := limit.capacity()
+	rate := limit.rate()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		//a bucket that was only peeked at stays full, there is nothing to keep
+		if cost == 0 {
+			return Result{Allowed: true, Limit: int(capacity), Remaining: int(capacity)}
+		}
+		b = &bucket{tokens: capacity, updated: now}
+		m.buckets[key] = b
+	}
+
+	//refill for the time since the last request
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*rate)
+		b.updated = now
+	}
+
+	result := Result{
+		Limit: int(capacity),
+	}
+	if b.tokens >= 1 {
+		b.tokens -= cost
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = secondsToDuration((capacity - b.tokens) / rate)
+	return result
+}
+
+// Sweep drops buckets not used for idle, so memory does not grow with every client.
+// idle should be longer than any bucket takes to refill, a dropped bucket starts full.
+func (m *MemoryStore) Sweep(idle time.Duration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) >= idle {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// StartSweeping calls Sweep every interval until stop is called ...
+func (m *MemoryStore) StartSweeping(interval, idle time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				m.Sweep(idle, now)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
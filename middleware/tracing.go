@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanRoute is meant for mux.Router.Use, the request span is started before routing so it
+// is renamed here after the matched route ...
+func SpanRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if template, ok := routeTemplate(r); ok {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + template)
+			span.SetAttributes(semconv.HTTPRouteKey.String(template))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeTemplate is the path template of the route mux matched, like /order/create-order
+func routeTemplate(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return template, true
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"future-fashion/config"
+	"future-fashion/helpers"
+	"future-fashion/infra"
+	"future-fashion/migrations"
+)
+
+// runMigrate applies, rolls back or lists the schema migrations, args are
+// up|down [steps]|status followed by the usual config flags ...
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: future-fashion migrate " + migrations.CommandUsage + " [config flags]")
+	}
+
+	//the action and the optional steps of down come before the config flags
+	action := args[:1]
+	args = args[1:]
+	if action[0] == "down" && len(args) > 0 {
+		if _, err := strconv.Atoi(args[0]); err == nil {
+			action = append(action, args[0])
+			args = args[1:]
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+
+	logger, err := helpers.InitLogger(cfg.Logger.Level, cfg.Logger.Format)
+	if err != nil {
+		return err
+	}
+
+	db, err := infra.OpenDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	return migrations.New(db, logger).Command(action, os.Stdout)
+}
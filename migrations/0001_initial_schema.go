@@ -0,0 +1,243 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The schema as AutoMigrate created it before versioned migrations. The structs are
+// copies so that later changes to models do not change what this migration does.
+// On a database that AutoMigrate already set up, Up only adds what is missing.
+
+type initialUser struct {
+	gorm.Model
+	Username        string `gorm:"unique"`
+	Email           string `gorm:"size:191;index"`
+	EmailVerified   bool
+	EmailVerifiedAt *time.Time
+	Password        string
+	DOB             string
+	Role            string
+	Chest           float32
+	Waist           float32
+	Hip             float32
+	TOTPSecret      string
+	TOTPEnabled     bool
+	TOTPLastStep    int64
+	Orders          []initialOrder `gorm:"foreignKey:UserID"`
+}
+
+func (initialUser) TableName() string {
+	return "users"
+}
+
+type initialCredential struct {
+	gorm.Model
+	Credential string
+	Type       string `gorm:"unique"`
+}
+
+func (initialCredential) TableName() string {
+	return "credentials"
+}
+
+type initialProduct struct {
+	gorm.Model
+	Item     string
+	Price    float32
+	Stock    int
+	Pictures string
+	XS       string
+	S        string
+	M        string
+	L        string
+	XL       string
+}
+
+func (initialProduct) TableName() string {
+	return "products"
+}
+
+type initialOrder struct {
+	gorm.Model
+	Total     float32
+	Status    string
+	Snapshots string
+	UserID    uint
+}
+
+func (initialOrder) TableName() string {
+	return "orders"
+}
+
+type initialEmailVerification struct {
+	gorm.Model
+	UserID      uint   `gorm:"uniqueIndex"`
+	TokenHash   string `gorm:"size:64;index"`
+	ExpiresAt   time.Time
+	SentAt      time.Time
+	SendCount   int
+	WindowStart time.Time
+}
+
+func (initialEmailVerification) TableName() string {
+	return "email_verifications"
+}
+
+type initialLoginThrottle struct {
+	gorm.Model
+	Kind        string `gorm:"size:16;uniqueIndex:idx_login_throttle_key"`
+	Identifier  string `gorm:"size:191;uniqueIndex:idx_login_throttle_key"`
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+func (initialLoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
+type initialLockoutEvent struct {
+	gorm.Model
+	Kind        string
+	Identifier  string
+	Event       string
+	Failures    int
+	LockedUntil time.Time
+	IP          string
+	Actor       string
+}
+
+func (initialLockoutEvent) TableName() string {
+	return "lockout_events"
+}
+
+type initialRecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"size:64"`
+	UsedAt   *time.Time
+}
+
+func (initialRecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+type initialRole struct {
+	gorm.Model
+	Name        string `gorm:"size:64;unique"`
+	Description string
+	Builtin     bool
+	Permissions []*initialRolePermission `gorm:"foreignKey:RoleID"`
+}
+
+func (initialRole) TableName() string {
+	return "roles"
+}
+
+type initialRolePermission struct {
+	ID         uint   `gorm:"primarykey"`
+	RoleID     uint   `gorm:"uniqueIndex:idx_role_permission"`
+	Permission string `gorm:"size:64;uniqueIndex:idx_role_permission"`
+}
+
+func (initialRolePermission) TableName() string {
+	return "role_permissions"
+}
+
+type initialAPIKey struct {
+	gorm.Model
+	Name       string
+	Prefix     string `gorm:"size:32;unique"`
+	KeyHash    string `gorm:"size:64"`
+	UserID     uint   `gorm:"index"`
+	Scopes     string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (initialAPIKey) TableName() string {
+	return "api_keys"
+}
+
+type initialOIDCLoginState struct {
+	gorm.Model
+	State        string `gorm:"size:64;uniqueIndex"`
+	Provider     string `gorm:"size:64"`
+	Nonce        string `gorm:"size:64"`
+	CodeVerifier string `gorm:"size:128"`
+	ExpiresAt    time.Time
+}
+
+func (initialOIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+type initialUserIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	Provider string `gorm:"size:64;uniqueIndex:idx_user_identity"`
+	Subject  string `gorm:"size:191;uniqueIndex:idx_user_identity"`
+	Email    string `gorm:"size:191"`
+}
+
+func (initialUserIdentity) TableName() string {
+	return "user_identities"
+}
+
+type initialAuditLog struct {
+	ID            uint      `gorm:"primarykey"`
+	CreatedAt     time.Time `gorm:"index"`
+	ActorID       uint      `gorm:"index"`
+	ActorUsername string    `gorm:"size:191"`
+	ActorRole     string    `gorm:"size:64"`
+	ViaAPIKey     bool
+	Action        string `gorm:"size:64;index"`
+	TargetType    string `gorm:"size:32;index:idx_audit_target"`
+	TargetID      string `gorm:"size:191;index:idx_audit_target"`
+	Before        string `gorm:"type:text"`
+	After         string `gorm:"type:text"`
+	Diff          string `gorm:"type:text"`
+	IP            string `gorm:"size:64"`
+}
+
+func (initialAuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// in dependency order, Down drops them in reverse
+var initialTables = []interface{}{
+	&initialUser{},
+	&initialCredential{},
+	&initialProduct{},
+	&initialOrder{},
+	&initialEmailVerification{},
+	&initialLoginThrottle{},
+	&initialLockoutEvent{},
+	&initialRecoveryCode{},
+	&initialRole{},
+	&initialRolePermission{},
+	&initialAPIKey{},
+	&initialOIDCLoginState{},
+	&initialUserIdentity{},
+	&initialAuditLog{},
+}
+
+var initialSchema = &Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(initialTables...)
+	},
+	Down: func(tx *gorm.DB) error {
+		for i := len(initialTables) - 1; i >= 0; i-- {
+			err := tx.Migrator().DropTable(initialTables[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
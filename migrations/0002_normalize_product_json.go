@@ -0,0 +1,143 @@
+package migrations
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Products written before the api took structured sizing hold a mix of empty strings,
+// plain picture urls and sizing with quoted numbers or capitalised keys, which the
+// product mapper cannot read. This rewrites pictures to a json array and every size
+// to {"chest":..,"waist":..,"hip":..} or null. There is nothing to undo, the
+// normalized values are what the api writes anyway.
+
+type productJSONRow struct {
+	ID       uint
+	Pictures string
+	XS       string
+	S        string
+	M        string
+	L        string
+	XL       string
+}
+
+type normalizedSizing struct {
+	Chest float32 `json:"chest"`
+	Waist float32 `json:"waist"`
+	Hip   float32 `json:"hip"`
+}
+
+var normalizeProductJSON = &Migration{
+	Version: 2,
+	Name:    "normalize_product_json",
+	Up: func(tx *gorm.DB) error {
+		var rows []*productJSONRow
+		//soft deleted products are restored with the same data, so they are normalized too
+		err := tx.Table("products").Select("id, pictures, xs, s, m, l, xl").Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			updates := map[string]interface{}{}
+			if normalized := normalizePictures(row.Pictures); normalized != row.Pictures {
+				updates["pictures"] = normalized
+			}
+			for column, value := range map[string]string{"xs": row.XS, "s": row.S, "m": row.M, "l": row.L, "xl": row.XL} {
+				if normalized := normalizeSizing(value); normalized != value {
+					updates[column] = normalized
+				}
+			}
+			if len(updates) == 0 {
+				continue
+			}
+
+			err := tx.Table("products").Where("id = ?", row.ID).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		return nil
+	},
+}
+
+func normalizePictures(value string) string {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" || trimmed == "null" {
+		return "[]"
+	}
+
+	var pictures []string
+	err := json.Unmarshal([]byte(trimmed), &pictures)
+	if err != nil {
+		//a single url, or a comma separated list of them
+		pictures = []string{}
+		for _, picture := range strings.Split(trimmed, ",") {
+			if picture = strings.Trim(strings.TrimSpace(picture), `"`); picture != "" {
+				pictures = append(pictures, picture)
+			}
+		}
+	}
+	if pictures == nil {
+		pictures = []string{}
+	}
+
+	normalized, _ := json.Marshal(pictures)
+	return string(normalized)
+}
+
+func normalizeSizing(value string) string {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" || trimmed == "null" {
+		return "null"
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal([]byte(trimmed), &fields)
+	if err != nil {
+		return "null"
+	}
+
+	sizing := &normalizedSizing{}
+	for key, raw := range fields {
+		var target *float32
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "chest":
+			target = &sizing.Chest
+		case "waist":
+			target = &sizing.Waist
+		case "hip", "hips":
+			target = &sizing.Hip
+		default:
+			continue
+		}
+		*target = parseMeasurement(raw)
+	}
+
+	normalized, _ := json.Marshal(sizing)
+	return string(normalized)
+}
+
+// numbers may have been stored as numbers or as strings
+func parseMeasurement(raw json.RawMessage) float32 {
+	var number float32
+	if json.Unmarshal(raw, &number) == nil {
+		return number
+	}
+
+	var text string
+	if json.Unmarshal(raw, &text) != nil {
+		return 0
+	}
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(text), 32)
+	if err != nil {
+		return 0
+	}
+	return float32(parsed)
+}
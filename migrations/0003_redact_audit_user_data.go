@@ -0,0 +1,95 @@
+package migrations
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// Audit entries of users used to keep the whole user dto in before, after and diff, and the
+// username of customers acting on their own account. Erasing a user left that behind, so
+// this removes it the same way recordAudit now leaves it out. The values are gone, it
+// cannot be rolled back.
+
+type auditUserDataRow struct {
+	ID     uint
+	Before string
+	After  string
+	Diff   string
+}
+
+// a copy of the fields redacted by recordAudit, so later changes there do not change this migration
+var auditPersonalFields = []string{"username", "email", "dob", "chest", "waist", "hip"}
+
+var redactAuditUserData = &Migration{
+	Version: 3,
+	Name:    "redact_audit_user_data",
+	Up: func(tx *gorm.DB) error {
+		//a plain table update, the model refuses any change to the audit log
+		err := tx.Table("audit_logs").Where("actor_role = ?", "customer").Update("actor_username", "").Error
+		if err != nil {
+			return err
+		}
+
+		var rows []*auditUserDataRow
+		err = tx.Table("audit_logs").Select([]string{"id", "before", "after", "diff"}).Where("target_type = ?", "user").Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			updates := map[string]interface{}{}
+			for column, value := range map[string]string{"before": row.Before, "after": row.After, "diff": row.Diff} {
+				redacted, err := redactAuditState(value, column == "diff")
+				if err != nil {
+					return err
+				}
+				if redacted != value {
+					updates[column] = redacted
+				}
+			}
+			if len(updates) == 0 {
+				continue
+			}
+
+			err := tx.Table("audit_logs").Where("id = ?", row.ID).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func redactAuditState(value string, diff bool) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	fields := map[string]interface{}{}
+	err := json.Unmarshal([]byte(value), &fields)
+	if err != nil {
+		return "", err
+	}
+
+	changed := false
+	for _, field := range auditPersonalFields {
+		if _, ok := fields[field]; !ok {
+			continue
+		}
+		changed = true
+		if diff {
+			fields[field] = map[string]interface{}{"before": "[redacted]", "after": "[redacted]"}
+		} else {
+			delete(fields, field)
+		}
+	}
+	if !changed {
+		return value, nil
+	}
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Usernames and emails are stored lowercased from now on, so the unique index on username
+// holds regardless of case on postgres and sqlite too. Accounts whose username only differs
+// in case from an older one could not log in, the older one was always found first. They
+// keep their data under <username>-<id>, the oldest keeps the name. Trashed users are
+// included, the unique index covers them. There is nothing to undo.
+
+type userIdentifierRow struct {
+	ID       uint
+	Username string
+}
+
+var lowercaseUserIdentifiers = &Migration{
+	Version: 4,
+	Name:    "lowercase_user_identifiers",
+	Up: func(tx *gorm.DB) error {
+		var rows []*userIdentifierRow
+		err := tx.Table("users").Select("id, username").Order("id").Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		taken := map[string]bool{}
+		for _, row := range rows {
+			taken[row.Username] = true
+		}
+
+		//the duplicates go first, so lowercasing the others never hits the unique index
+		owners := map[string]uint{}
+		renames := map[uint]string{}
+		for _, row := range rows {
+			lower := strings.ToLower(row.Username)
+			if _, ok := owners[lower]; !ok {
+				owners[lower] = row.ID
+				continue
+			}
+			renamed := fmt.Sprintf("%v-%v", lower, row.ID)
+			for taken[renamed] {
+				renamed += "-"
+			}
+			taken[renamed] = true
+			renames[row.ID] = renamed
+		}
+		for _, row := range rows {
+			renamed, ok := renames[row.ID]
+			if !ok {
+				continue
+			}
+			err := tx.Table("users").Where("id = ?", row.ID).Update("username", renamed).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, row := range rows {
+			lower := strings.ToLower(row.Username)
+			if _, renamed := renames[row.ID]; renamed || lower == row.Username {
+				continue
+			}
+			err := tx.Table("users").Where("id = ?", row.ID).Update("username", lower).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec("UPDATE users SET email = LOWER(email) WHERE email <> LOWER(email)").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return nil
+	},
+}
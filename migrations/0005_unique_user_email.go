@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Email addresses were only checked by the handlers before the insert, so two signups at
+// once could register the same address. The index covers active users with an address:
+// erased users have none and a trashed user's address may be taken, Restore checks that.
+// MySQL has no partial indexes, an expression that is NULL for the others does the same.
+
+const userEmailIndex = "idx_users_email_active"
+
+var uniqueUserEmail = &Migration{
+	Version: 5,
+	Name:    "unique_user_email",
+	Up: func(tx *gorm.DB) error {
+		var duplicates []string
+		err := tx.Table("users").
+			Where("deleted_at IS NULL AND email <> ''").
+			Group("email").
+			Having("COUNT(*) > 1").
+			Pluck("email", &duplicates).Error
+		if err != nil {
+			return err
+		}
+		//which account keeps the address is for a person to decide
+		if len(duplicates) > 0 {
+			return fmt.Errorf("%v email addresses are used by more than one user, e.g. %q, change them before migrating", len(duplicates), duplicates[0])
+		}
+
+		if tx.Dialector.Name() == "mysql" {
+			return tx.Exec("CREATE UNIQUE INDEX " + userEmailIndex + " ON users ((CASE WHEN deleted_at IS NULL AND email <> '' THEN email END))").Error
+		}
+		return tx.Exec("CREATE UNIQUE INDEX " + userEmailIndex + " ON users (email) WHERE deleted_at IS NULL AND email <> ''").Error
+	},
+	Down: func(tx *gorm.DB) error {
+		statement := "DROP INDEX " + userEmailIndex
+		if tx.Dialector.Name() == "mysql" {
+			statement += " ON users"
+		}
+		return tx.Exec(statement).Error
+	},
+}
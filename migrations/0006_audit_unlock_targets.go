@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Account unlocks used to be logged with "account:<username>" as the target, which kept the
+// username after the user was erased. This points them at the user id instead, or at the
+// bare account kind when no user has that username. It cannot be rolled back.
+
+type auditUnlockRow struct {
+	ID       uint
+	TargetID string
+}
+
+var auditUnlockTargets = &Migration{
+	Version: 6,
+	Name:    "audit_unlock_targets",
+	Up: func(tx *gorm.DB) error {
+		var rows []*auditUnlockRow
+		err := tx.Table("audit_logs").Select("id, target_id").Where("target_type = ? AND target_id LIKE ?", "account", "account:%").Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			//usernames are lowercased since migration 4, trashed users still count
+			var ids []uint
+			err := tx.Table("users").Where("username = ?", strings.TrimPrefix(row.TargetID, "account:")).Limit(1).Pluck("id", &ids).Error
+			if err != nil {
+				return err
+			}
+
+			updates := map[string]interface{}{"target_id": "account"}
+			if len(ids) > 0 {
+				updates = map[string]interface{}{"target_type": "user", "target_id": strconv.FormatUint(uint64(ids[0]), 10)}
+			}
+			//a plain table update, the model refuses any change to the audit log
+			err = tx.Table("audit_logs").Where("id = ?", row.ID).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
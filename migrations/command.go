@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// CommandUsage describes the args of Command
+const CommandUsage = "up | down [steps] | status"
+
+// Command runs one migrate subcommand, e.g. up, down 2 or status, and writes what it did to out ...
+func (m *Migrator) Command(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate " + CommandUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		if len(args) > 1 {
+			return errors.New("usage: migrate " + CommandUsage)
+		}
+		applied, err := m.Up()
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "database is up to date")
+		}
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %v %v\n", migration.Version, migration.Name)
+		}
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			return errors.New("usage: migrate " + CommandUsage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return errors.New("steps must be a number of at least 1")
+			}
+			steps = n
+		}
+		rolledBack, err := m.Down(steps)
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			fmt.Fprintln(out, "no migrations to roll back")
+		}
+		for _, migration := range rolledBack {
+			fmt.Fprintf(out, "rolled back %v %v\n", migration.Version, migration.Name)
+		}
+		return nil
+
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "VERSION\tNAME\tSTATUS")
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			if status.Unknown {
+				state += " (not in this build)"
+			}
+			fmt.Fprintf(writer, "%v\t%v\t%v\n", status.Version, status.Name, state)
+		}
+		return writer.Flush()
+	}
+	return errors.New("usage: migrate " + CommandUsage)
+}
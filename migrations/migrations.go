@@ -0,0 +1,353 @@
+// Package migrations holds the versioned schema and data migrations. Applied versions are
+// recorded in the schema_migrations table and a row in schema_migrations_lock keeps two
+// processes from migrating the same database at once.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	ErrLocked       = errors.New("another process is migrating the database")
+	ErrIrreversible = errors.New("migration cannot be rolled back")
+)
+
+// Migration is one versioned change, Up and Down run inside a transaction where the
+// database supports transactional DDL ...
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	//nil when the migration cannot be rolled back
+	Down func(tx *gorm.DB) error
+}
+
+// All lists every migration, new ones are appended with the next version
+var All = []*Migration{
+	initialSchema,
+	normalizeProductJSON,
+	redactAuditUserData,
+	lowercaseUserIdentifiers,
+	uniqueUserEmail,
+	auditUnlockTargets,
+}
+
+type schemaMigration struct {
+	Version   uint   `gorm:"primarykey;autoIncrement:false"`
+	Name      string `gorm:"size:191"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type schemaMigrationLock struct {
+	ID       uint   `gorm:"primarykey;autoIncrement:false"`
+	Owner    string `gorm:"size:191"`
+	LockedAt time.Time
+}
+
+func (schemaMigrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// the only row of schema_migrations_lock
+const lockID = 1
+
+// MigrationStatus is one line of Status. Unknown is set for versions recorded in the
+// database that this build does not have, e.g. after deploying an older release.
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []*Migration
+	Logger     *zap.SugaredLogger
+	//how long to wait for another process to finish migrating
+	LockTimeout time.Duration
+	//a lock older than this is left over from a crashed process and is taken over
+	StaleLockAfter time.Duration
+}
+
+// New is the constructor of a migrator with every migration ...
+func New(db *gorm.DB, logger *zap.SugaredLogger) *Migrator {
+	return &Migrator{
+		DB:             db,
+		Migrations:     All,
+		Logger:         logger,
+		LockTimeout:    time.Minute,
+		StaleLockAfter: 15 * time.Minute,
+	}
+}
+
+// Up applies every pending migration in version order and returns the applied ones ...
+func (m *Migrator) Up() ([]*Migration, error) {
+	var applied []*Migration
+	err := m.withLock(func() error {
+		done, err := m.appliedVersions()
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.sorted() {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			m.Logger.Infow("applying migration", "version", migration.Version, "name", migration.Name)
+			err := m.DB.Transaction(func(tx *gorm.DB) error {
+				err := migration.Up(tx)
+				if err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %v %v: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first ...
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	var rolledBack []*Migration
+	err := m.withLock(func() error {
+		var records []*schemaMigration
+		err := m.DB.Order("version desc").Limit(steps).Find(&records).Error
+		if err != nil {
+			return err
+		}
+
+		byVersion := map[uint]*Migration{}
+		for _, migration := range m.Migrations {
+			byVersion[migration.Version] = migration
+		}
+
+		for _, record := range records {
+			migration, ok := byVersion[record.Version]
+			if !ok {
+				return fmt.Errorf("migration %v %v is not part of this build", record.Version, record.Name)
+			}
+			if migration.Down == nil {
+				return fmt.Errorf("migration %v %v: %w", migration.Version, migration.Name, ErrIrreversible)
+			}
+
+			m.Logger.Infow("rolling back migration", "version", migration.Version, "name", migration.Name)
+			err := m.DB.Transaction(func(tx *gorm.DB) error {
+				err := migration.Down(tx)
+				if err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %v %v: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = append(rolledBack, migration)
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Status lists every known migration and whether it is applied ...
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	err := m.createTables()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*schemaMigration
+	err = m.DB.Order("version").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	recorded := map[uint]*schemaMigration{}
+	for _, record := range records {
+		recorded[record.Version] = record
+	}
+
+	statuses := []*MigrationStatus{}
+	for _, migration := range m.sorted() {
+		status := &MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if record, ok := recorded[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &record.AppliedAt
+			delete(recorded, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range recorded {
+		statuses = append(statuses, &MigrationStatus{
+			Version:   record.Version,
+			Name:      record.Name,
+			Applied:   true,
+			AppliedAt: &record.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Pending returns the migrations that are not applied yet ...
+func (m *Migrator) Pending() ([]*Migration, error) {
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	applied := map[uint]bool{}
+	for _, status := range statuses {
+		applied[status.Version] = status.Applied
+	}
+
+	var pending []*Migration
+	for _, migration := range m.sorted() {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// UpToDate reports whether the latest migration of this build is applied. It only reads,
+// so it is cheap enough for every readiness probe, and gives up when ctx is done ...
+func (m *Migrator) UpToDate(ctx context.Context) (bool, error) {
+	db := m.DB.WithContext(ctx)
+	//nothing was ever migrated, the table is left for Up to create
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return false, nil
+	}
+
+	var latest sql.NullInt64
+	err := db.Model(&schemaMigration{}).Select("MAX(version)").Scan(&latest).Error
+	if err != nil {
+		return false, err
+	}
+
+	var wanted uint
+	for _, migration := range m.Migrations {
+		if migration.Version > wanted {
+			wanted = migration.Version
+		}
+	}
+	return uint(latest.Int64) >= wanted, nil
+}
+
+func (m *Migrator) sorted() []*Migration {
+	migrations := append([]*Migration{}, m.Migrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+func (m *Migrator) appliedVersions() (map[uint]struct{}, error) {
+	var versions []uint
+	err := m.DB.Model(&schemaMigration{}).Pluck("version", &versions).Error
+	if err != nil {
+		return nil, err
+	}
+	applied := map[uint]struct{}{}
+	for _, version := range versions {
+		applied[version] = struct{}{}
+	}
+	return applied, nil
+}
+
+func (m *Migrator) createTables() error {
+	for _, table := range []interface{}{&schemaMigration{}, &schemaMigrationLock{}} {
+		if m.DB.Migrator().HasTable(table) {
+			continue
+		}
+		err := m.DB.Migrator().CreateTable(table)
+		//another process may have created it in the meantime
+		if err != nil && !m.DB.Migrator().HasTable(table) {
+			return err
+		}
+	}
+	return nil
+}
+
+// withLock runs fn while holding the migration lock. The lock is a row with a fixed
+// primary key, so only one insert can succeed on every database we support.
+func (m *Migrator) withLock(fn func() error) error {
+	err := m.createTables()
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%v:%v", hostname, os.Getpid())
+	//a failed insert is expected while someone else holds the lock, keep it out of the sql log
+	quiet := m.DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		err = quiet.Create(&schemaMigrationLock{ID: lockID, Owner: owner, LockedAt: time.Now()}).Error
+		if err == nil {
+			break
+		}
+
+		held := &schemaMigrationLock{}
+		lookupErr := quiet.First(held, lockID).Error
+		if errors.Is(lookupErr, gorm.ErrRecordNotFound) {
+			//the insert failed for another reason than the lock being held
+			return err
+		}
+		if lookupErr != nil {
+			return lookupErr
+		}
+
+		if time.Since(held.LockedAt) > m.StaleLockAfter {
+			m.Logger.Warnw("taking over stale migration lock", "owner", held.Owner, "locked_at", held.LockedAt)
+			err = m.DB.Where("id = ? AND owner = ?", lockID, held.Owner).Delete(&schemaMigrationLock{}).Error
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w (held by %v since %v)", ErrLocked, held.Owner, held.LockedAt.Format(time.RFC3339))
+		}
+		m.Logger.Infow("waiting for migration lock", "owner", held.Owner)
+		time.Sleep(time.Second)
+	}
+
+	defer func() {
+		err := m.DB.Where("id = ? AND owner = ?", lockID, owner).Delete(&schemaMigrationLock{}).Error
+		if err != nil {
+			m.Logger.Errorw("failed to release migration lock", "error", err)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"future-fashion/helpers"
+)
+
+type APIKeyOperation interface {
+	GetByID(id uint) (*APIKey, error)
+	GetAll(userID uint) ([]*APIKey, error)
+	Insert(*APIKey) (*APIKey, error)
+	Revoke(id uint) (*APIKey, error)
+	VerifyAPIKey(key string) (*helpers.Claims, error)
+	RefreshClaims(claims *helpers.Claims) (*helpers.Claims, error)
+	WithContext(ctx context.Context) APIKeyOperation
+}
+
+// type assertion
+var _ APIKeyOperation = (*APIKeyOperationsImpl)(nil)
+var _ helpers.CallerVerifier = (*APIKeyOperationsImpl)(nil)
+
+// APIKey is a long lived credential of a user. The key itself is only shown once,
+// the public prefix identifies it and only the hash of the full key is stored.
+type APIKey struct {
+	gorm.Model
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" gorm:"size:32;unique"`
+	KeyHash    string     `json:"-" gorm:"size:64"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Scopes     string     `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type APIKeyOperationsImpl struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (a *APIKeyOperationsImpl) WithContext(ctx context.Context) APIKeyOperation {
+	clone := *a
+	clone.DB = a.DB.WithContext(ctx)
+	return &clone
+}
+
+// last used is written at most once per interval to avoid a write on every request
+const apiKeyTouchInterval = time.Minute
+
+var errInvalidAPIKey = helpers.NewUnauthorizedError("invalid_api_key", "invalid api key")
+
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, " ")
+}
+
+// GenerateAPIKey returns a new plain key and the model holding its prefix and hash ...
+func GenerateAPIKey() (string, *APIKey, error) {
+	id, err := helpers.GenerateRandomToken(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := helpers.GenerateRandomToken(24)
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefix := helpers.APIKeyPrefix + id
+	key := prefix + "_" + secret
+	return key, &APIKey{
+		Prefix:  prefix,
+		KeyHash: helpers.HashToken(key),
+	}, nil
+}
+
+func (a *APIKeyOperationsImpl) GetByID(id uint) (*APIKey, error) {
+	apiKey := &APIKey{}
+	err := a.DB.First(apiKey, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+// GetAll returns the keys of a user, or of every user when userID is 0 ...
+func (a *APIKeyOperationsImpl) GetAll(userID uint) ([]*APIKey, error) {
+	var apiKeys []*APIKey
+	query := a.DB
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	err := query.Find(&apiKeys).Error
+	if err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func (a *APIKeyOperationsImpl) Insert(apiKey *APIKey) (*APIKey, error) {
+	err := a.DB.Create(apiKey).Error
+	if err != nil {
+		return nil, err
+	}
+	return apiKey, nil
+}
+
+func (a *APIKeyOperationsImpl) Revoke(id uint) (*APIKey, error) {
+	foundKey, err := a.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if foundKey.RevokedAt == nil {
+		now := time.Now()
+		foundKey.RevokedAt = &now
+		err = a.DB.Save(foundKey).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return foundKey, nil
+}
+
+// VerifyAPIKey checks the key and returns the claims of its owner limited to the key scopes ...
+func (a *APIKeyOperationsImpl) VerifyAPIKey(key string) (*helpers.Claims, error) {
+	//ffk_<id>_<secret>
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0]+"_" != helpers.APIKeyPrefix {
+		return nil, errInvalidAPIKey
+	}
+
+	apiKey := &APIKey{}
+	err := a.DB.Where("prefix = ?", parts[0]+"_"+parts[1]).First(apiKey).Error
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(helpers.HashToken(key))) != 1 {
+		return nil, errInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil {
+		return nil, helpers.NewUnauthorizedError("api_key_revoked", "api key is revoked")
+	}
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return nil, helpers.NewUnauthorizedError("api_key_expired", "api key is expired")
+	}
+
+	claims, err := a.ownerClaims(apiKey.UserID)
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		err = a.DB.Model(apiKey).Update("last_used_at", now).Error
+		if err != nil {
+			a.Logger.Errorw("failed to update api key last used", "api_key_id", apiKey.ID, "error", err)
+		}
+	}
+
+	claims.APIKeyScopes = apiKey.ScopeList()
+	return claims, nil
+}
+
+// RefreshClaims replaces the role and permissions of a verified JWT with the current ones of
+// its user, so a demoted user loses access on the next request and not at token expiry ...
+func (a *APIKeyOperationsImpl) RefreshClaims(claims *helpers.Claims) (*helpers.Claims, error) {
+	current, err := a.ownerClaims(claims.Id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, helpers.NewUnauthorizedError("invalid_token", "user of the token no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed := *claims
+	refreshed.Username = current.Username
+	refreshed.Role = current.Role
+	refreshed.Permissions = current.Permissions
+	return &refreshed, nil
+}
+
+// ownerClaims loads the user with the permissions of their role, an unknown role has none
+func (a *APIKeyOperationsImpl) ownerClaims(userID uint) (*helpers.Claims, error) {
+	user := &User{}
+	err := a.DB.First(user, userID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	role := &Role{}
+	permissions := []string{}
+	err = a.DB.Preload("Permissions").Where("name = ?", user.Role).First(role).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		permissions = role.PermissionNames()
+	}
+	return helpers.NewClaim(user.ID, user.Username, user.Role, permissions), nil
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Audited actions, named <target>.<verb> ...
+const (
+	AuditActionCustomerCreate        = "customer.create"
+	AuditActionCustomerUpdate        = "customer.update"
+	AuditActionCustomerPasswordReset = "customer.password-reset"
+	AuditActionCustomerDelete        = "customer.delete"
+	AuditActionCustomerRestore       = "customer.restore"
+	AuditActionAccountUnlock         = "account.unlock"
+	AuditActionRoleCreate            = "role.create"
+	AuditActionRoleUpdate            = "role.update"
+	AuditActionRoleDelete            = "role.delete"
+	AuditActionRoleAssign            = "role.assign"
+	AuditActionAPIKeyCreate          = "api-key.create"
+	AuditActionAPIKeyRevoke          = "api-key.revoke"
+	AuditActionTwoFactorEnable       = "two-factor.enable"
+	AuditActionTwoFactorDisable      = "two-factor.disable"
+	AuditActionRecoveryCodesRenew    = "two-factor.recovery-codes"
+	AuditActionProductCreate         = "product.create"
+	AuditActionProductUpdate         = "product.update"
+	AuditActionProductDelete         = "product.delete"
+	AuditActionProductRestore        = "product.restore"
+	AuditActionOrderUpdateStatus     = "order.update-status"
+	AuditActionOrderDelete           = "order.delete"
+	AuditActionOrderRestore          = "order.restore"
+	AuditActionStaffCreate           = "staff.create"
+	AuditActionUserPasswordReset     = "user.password-reset"
+	AuditActionCredentialSet         = "credential.set"
+)
+
+const (
+	AuditTargetUser    = "user"
+	AuditTargetAccount = "account"
+	AuditTargetRole    = "role"
+	AuditTargetAPIKey  = "api-key"
+	AuditTargetProduct = "product"
+	AuditTargetOrder   = "order"
+	//credentials are identified by their type, never by their value
+	AuditTargetCredential = "credential"
+)
+
+var ErrAuditLogImmutable = errors.New("audit log entries cannot be changed or deleted")
+
+type AuditLogOperation interface {
+	Insert(*AuditLog) (*AuditLog, error)
+	Find(*AuditLogFilter) ([]*AuditLog, error)
+	WithContext(ctx context.Context) AuditLogOperation
+}
+
+// type assertion
+var _ AuditLogOperation = (*AuditLogOperationsImpl)(nil)
+
+// AuditLog records who changed what, entries are only ever inserted ...
+type AuditLog struct {
+	ID            uint      `json:"id" gorm:"primarykey"`
+	CreatedAt     time.Time `json:"created_at" gorm:"index"`
+	ActorID       uint      `json:"actor_id" gorm:"index"`
+	ActorUsername string    `json:"actor_username" gorm:"size:191"`
+	ActorRole     string    `json:"actor_role" gorm:"size:64"`
+	ViaAPIKey     bool      `json:"via_api_key"`
+	Action        string    `json:"action" gorm:"size:64;index"`
+	TargetType    string    `json:"target_type" gorm:"size:32;index:idx_audit_target"`
+	TargetID      string    `json:"target_id" gorm:"size:191;index:idx_audit_target"`
+	//json of the mapped response dtos, empty when there is no before or after state
+	Before string `json:"before" gorm:"type:text"`
+	After  string `json:"after" gorm:"type:text"`
+	Diff   string `json:"diff" gorm:"type:text"`
+	IP     string `json:"ip" gorm:"size:64"`
+}
+
+// AuditLogFilter narrows Find, zero values are ignored ...
+type AuditLogFilter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	Limit      int
+	Offset     int
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+type AuditLogOperationsImpl struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (a *AuditLogOperationsImpl) WithContext(ctx context.Context) AuditLogOperation {
+	clone := *a
+	clone.DB = a.DB.WithContext(ctx)
+	return &clone
+}
+
+func (a *AuditLogOperationsImpl) Insert(entry *AuditLog) (*AuditLog, error) {
+	err := a.DB.Create(entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (a *AuditLogOperationsImpl) Find(filter *AuditLogFilter) ([]*AuditLog, error) {
+	query := a.DB.Model(&AuditLog{})
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	var entries []*AuditLog
+	err := query.Order("id desc").Limit(limit).Offset(filter.Offset).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
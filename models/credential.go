@@ -1,11 +1,28 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Credential types, one row each
+const (
+	CredentialTypeTokenKey = "jwt-token-key"
+)
 
 type CredentialOperations interface {
 	GetTokenKey() (string, error)
+	GetByType(credentialType string) (*Credential, error)
 	Insert(*Credential) error
+	Set(credentialType, value string) (*Credential, error)
+	WithContext(ctx context.Context) CredentialOperations
 }
+
+// type assertion
+var _ CredentialOperations = (*CredentialOperationsImpl)(nil)
+
 type Credential struct {
 	gorm.Model
 	Credential string `json:"credential"`
@@ -16,11 +33,59 @@ type CredentialOperationsImpl struct {
 	DB *gorm.DB
 }
 
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (c *CredentialOperationsImpl) WithContext(ctx context.Context) CredentialOperations {
+	clone := *c
+	clone.DB = c.DB.WithContext(ctx)
+	return &clone
+}
+
 func (c *CredentialOperationsImpl) GetTokenKey() (string, error) {
-	credential := &Credential{}
-	err := c.DB.Where("type = ?", "jwt-token-key").First(credential).Error
+	credential, err := c.GetByType(CredentialTypeTokenKey)
 	if err != nil {
 		return "", err
 	}
 	return credential.Credential, nil
 }
+
+func (c *CredentialOperationsImpl) GetByType(credentialType string) (*Credential, error) {
+	credential := &Credential{}
+	err := c.DB.Where("type = ?", credentialType).First(credential).Error
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (c *CredentialOperationsImpl) Insert(credential *Credential) error {
+	return c.DB.Create(credential).Error
+}
+
+// Set stores the value of a credential type, creating the row when there is none ...
+func (c *CredentialOperationsImpl) Set(credentialType, value string) (*Credential, error) {
+	credential := &Credential{}
+	//type is unique across deleted rows too, so a deleted row is brought back instead
+	err := c.DB.Unscoped().Where("type = ?", credentialType).First(credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		credential = &Credential{
+			Type:       credentialType,
+			Credential: value,
+		}
+		err = c.Insert(credential)
+		if err != nil {
+			return nil, err
+		}
+		return credential, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	credential.Credential = value
+	credential.DeletedAt = gorm.DeletedAt{}
+	err = c.DB.Unscoped().Save(credential).Error
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type EmailVerificationOperation interface {
+	GetByUserID(userID uint) (*EmailVerification, error)
+	GetByTokenHash(tokenHash string) (*EmailVerification, error)
+	Save(*EmailVerification) (*EmailVerification, error)
+	Delete(id uint) error
+	WithContext(ctx context.Context) EmailVerificationOperation
+}
+
+// type assertion
+var _ EmailVerificationOperation = (*EmailVerificationOperationsImpl)(nil)
+
+// EmailVerification holds the pending verification token of a user, one row per user ...
+type EmailVerification struct {
+	gorm.Model
+	UserID      uint      `json:"user_id" gorm:"uniqueIndex"`
+	TokenHash   string    `json:"-" gorm:"size:64;index"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	SentAt      time.Time `json:"sent_at"`
+	SendCount   int       `json:"send_count"`
+	WindowStart time.Time `json:"window_start"`
+}
+
+type EmailVerificationOperationsImpl struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (e *EmailVerificationOperationsImpl) WithContext(ctx context.Context) EmailVerificationOperation {
+	clone := *e
+	clone.DB = e.DB.WithContext(ctx)
+	return &clone
+}
+
+func (e *EmailVerificationOperationsImpl) GetByUserID(userID uint) (*EmailVerification, error) {
+	verification := &EmailVerification{}
+	err := e.DB.Where("user_id = ?", userID).First(verification).Error
+	if err != nil {
+		return nil, err
+	}
+	return verification, nil
+}
+
+func (e *EmailVerificationOperationsImpl) GetByTokenHash(tokenHash string) (*EmailVerification, error) {
+	verification := &EmailVerification{}
+	err := e.DB.Where("token_hash = ?", tokenHash).First(verification).Error
+	if err != nil {
+		return nil, err
+	}
+	return verification, nil
+}
+
+func (e *EmailVerificationOperationsImpl) Save(verification *EmailVerification) (*EmailVerification, error) {
+	err := e.DB.Save(verification).Error
+	if err != nil {
+		return nil, err
+	}
+	return verification, nil
+}
+
+func (e *EmailVerificationOperationsImpl) Delete(id uint) error {
+	//permanently deleted, a used token must never be restored
+	return e.DB.Unscoped().Delete(&EmailVerification{}, id).Error
+}
@@ -0,0 +1,164 @@
+package fakes
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.APIKeyOperation = (*APIKeyModel)(nil)
+var _ helpers.CallerVerifier = (*APIKeyModel)(nil)
+
+// APIKeyModel looks up the owner of a key in Users and their permissions in Roles,
+// both must be set to verify keys.
+type APIKeyModel struct {
+	Users *UserModel
+	Roles *RoleModel
+
+	mu     sync.Mutex
+	keys   map[uint]*models.APIKey
+	nextID uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (a *APIKeyModel) WithContext(ctx context.Context) models.APIKeyOperation {
+	return a
+}
+
+var errInvalidAPIKey = helpers.NewUnauthorizedError("invalid_api_key", "invalid api key")
+
+func (a *APIKeyModel) GetByID(id uint) (*models.APIKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	apiKey, ok := a.keys[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *apiKey
+	return &copied, nil
+}
+
+func (a *APIKeyModel) GetAll(userID uint) ([]*models.APIKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	apiKeys := []*models.APIKey{}
+	for _, apiKey := range a.keys {
+		if userID == 0 || apiKey.UserID == userID {
+			copied := *apiKey
+			apiKeys = append(apiKeys, &copied)
+		}
+	}
+	sort.Slice(apiKeys, func(i, j int) bool {
+		return apiKeys[i].ID < apiKeys[j].ID
+	})
+	return apiKeys, nil
+}
+
+func (a *APIKeyModel) Insert(apiKey *models.APIKey) (*models.APIKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.keys == nil {
+		a.keys = map[uint]*models.APIKey{}
+	}
+	for _, stored := range a.keys {
+		if stored.Prefix == apiKey.Prefix {
+			return nil, ErrDuplicate
+		}
+	}
+
+	a.nextID++
+	apiKey.Model = newModel(a.nextID)
+	copied := *apiKey
+	a.keys[apiKey.ID] = &copied
+	return apiKey, nil
+}
+
+func (a *APIKeyModel) Revoke(id uint) (*models.APIKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	apiKey, ok := a.keys[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if apiKey.RevokedAt == nil {
+		now := time.Now()
+		apiKey.RevokedAt = &now
+	}
+	copied := *apiKey
+	return &copied, nil
+}
+
+func (a *APIKeyModel) find(prefix string) (*models.APIKey, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, apiKey := range a.keys {
+		if apiKey.Prefix == prefix {
+			return apiKey, true
+		}
+	}
+	return nil, false
+}
+
+func (a *APIKeyModel) VerifyAPIKey(key string) (*helpers.Claims, error) {
+	//ffk_<id>_<secret>
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0]+"_" != helpers.APIKeyPrefix {
+		return nil, errInvalidAPIKey
+	}
+
+	apiKey, ok := a.find(parts[0] + "_" + parts[1])
+	if !ok || apiKey.KeyHash != helpers.HashToken(key) {
+		return nil, errInvalidAPIKey
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil {
+		return nil, helpers.NewUnauthorizedError("api_key_revoked", "api key is revoked")
+	}
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return nil, helpers.NewUnauthorizedError("api_key_expired", "api key is expired")
+	}
+
+	user, err := a.Users.GetByID(apiKey.UserID)
+	if err != nil {
+		return nil, errInvalidAPIKey
+	}
+	permissions, err := a.Roles.GetPermissions(user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	apiKey.LastUsedAt = &now
+	a.mu.Unlock()
+
+	claims := helpers.NewClaim(user.ID, user.Username, user.Role, permissions)
+	claims.APIKeyScopes = apiKey.ScopeList()
+	return claims, nil
+}
+
+func (a *APIKeyModel) RefreshClaims(claims *helpers.Claims) (*helpers.Claims, error) {
+	user, err := a.Users.GetByID(claims.Id)
+	if err != nil {
+		return nil, helpers.NewUnauthorizedError("invalid_token", "user of the token no longer exists")
+	}
+	permissions, err := a.Roles.GetPermissions(user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed := *claims
+	refreshed.Username = user.Username
+	refreshed.Role = user.Role
+	refreshed.Permissions = permissions
+	return &refreshed, nil
+}
@@ -0,0 +1,77 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.AuditLogOperation = (*AuditLogModel)(nil)
+
+type AuditLogModel struct {
+	mu      sync.Mutex
+	entries []*models.AuditLog
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (a *AuditLogModel) WithContext(ctx context.Context) models.AuditLogOperation {
+	return a
+}
+
+func (a *AuditLogModel) Insert(entry *models.AuditLog) (*models.AuditLog, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.ID = uint(len(a.entries) + 1)
+	entry.CreatedAt = time.Now()
+	copied := *entry
+	a.entries = append(a.entries, &copied)
+	return entry, nil
+}
+
+func (a *AuditLogModel) matches(entry *models.AuditLog, filter *models.AuditLogFilter) bool {
+	switch {
+	case filter.ActorID != 0 && entry.ActorID != filter.ActorID:
+		return false
+	case filter.Action != "" && entry.Action != filter.Action:
+		return false
+	case filter.TargetType != "" && entry.TargetType != filter.TargetType:
+		return false
+	case filter.TargetID != "" && entry.TargetID != filter.TargetID:
+		return false
+	case !filter.Since.IsZero() && entry.CreatedAt.Before(filter.Since):
+		return false
+	case !filter.Until.IsZero() && !entry.CreatedAt.Before(filter.Until):
+		return false
+	}
+	return true
+}
+
+// Find returns the newest entries first, limited like the database implementation
+func (a *AuditLogModel) Find(filter *models.AuditLogFilter) ([]*models.AuditLog, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	entries := []*models.AuditLog{}
+	skipped := 0
+	for i := len(a.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		entry := a.entries[i]
+		if !a.matches(entry, filter) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+		copied := *entry
+		entries = append(entries, &copied)
+	}
+	return entries, nil
+}
@@ -0,0 +1,82 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.CredentialOperations = (*CredentialModel)(nil)
+
+type CredentialModel struct {
+	mu          sync.Mutex
+	credentials map[string]*models.Credential
+	nextID      uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (c *CredentialModel) WithContext(ctx context.Context) models.CredentialOperations {
+	return c
+}
+
+func (c *CredentialModel) GetTokenKey() (string, error) {
+	credential, err := c.GetByType(models.CredentialTypeTokenKey)
+	if err != nil {
+		return "", err
+	}
+	return credential.Credential, nil
+}
+
+func (c *CredentialModel) GetByType(credentialType string) (*models.Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	credential, ok := c.credentials[credentialType]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *credential
+	return &copied, nil
+}
+
+func (c *CredentialModel) Insert(credential *models.Credential) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.credentials == nil {
+		c.credentials = map[string]*models.Credential{}
+	}
+	if _, ok := c.credentials[credential.Type]; ok {
+		return ErrDuplicate
+	}
+
+	c.nextID++
+	credential.Model = newModel(c.nextID)
+	copied := *credential
+	c.credentials[credential.Type] = &copied
+	return nil
+}
+
+func (c *CredentialModel) Set(credentialType, value string) (*models.Credential, error) {
+	c.mu.Lock()
+	credential, ok := c.credentials[credentialType]
+	if ok {
+		credential.Credential = value
+		copied := *credential
+		c.mu.Unlock()
+		return &copied, nil
+	}
+	c.mu.Unlock()
+
+	credential = &models.Credential{
+		Type:       credentialType,
+		Credential: value,
+	}
+	err := c.Insert(credential)
+	if err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
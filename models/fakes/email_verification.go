@@ -0,0 +1,81 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.EmailVerificationOperation = (*EmailVerificationModel)(nil)
+
+type EmailVerificationModel struct {
+	mu            sync.Mutex
+	verifications map[uint]*models.EmailVerification
+	nextID        uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (e *EmailVerificationModel) WithContext(ctx context.Context) models.EmailVerificationOperation {
+	return e
+}
+
+func (e *EmailVerificationModel) find(match func(verification *models.EmailVerification) bool) (*models.EmailVerification, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, verification := range e.verifications {
+		if match(verification) {
+			copied := *verification
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (e *EmailVerificationModel) GetByUserID(userID uint) (*models.EmailVerification, error) {
+	return e.find(func(verification *models.EmailVerification) bool {
+		return verification.UserID == userID
+	})
+}
+
+func (e *EmailVerificationModel) GetByTokenHash(tokenHash string) (*models.EmailVerification, error) {
+	return e.find(func(verification *models.EmailVerification) bool {
+		return verification.TokenHash == tokenHash
+	})
+}
+
+// Save inserts a verification without id and replaces the stored one otherwise ...
+func (e *EmailVerificationModel) Save(verification *models.EmailVerification) (*models.EmailVerification, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.verifications == nil {
+		e.verifications = map[uint]*models.EmailVerification{}
+	}
+
+	if verification.ID == 0 {
+		//one verification per user
+		for _, stored := range e.verifications {
+			if stored.UserID == verification.UserID {
+				return nil, ErrDuplicate
+			}
+		}
+		e.nextID++
+		verification.Model = newModel(e.nextID)
+	}
+	verification.UpdatedAt = time.Now()
+
+	copied := *verification
+	e.verifications[verification.ID] = &copied
+	return verification, nil
+}
+
+func (e *EmailVerificationModel) Delete(id uint) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.verifications, id)
+	return nil
+}
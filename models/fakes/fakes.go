@@ -0,0 +1,32 @@
+// Package fakes has in-memory implementations of the models interfaces, so the handlers
+// can be exercised without a database. They keep what the handlers rely on, like
+// gorm.ErrRecordNotFound for missing rows, soft deletes and unique names, but not every
+// database constraint. Every fake is ready to use as its zero value.
+package fakes
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDuplicate stands in for a unique index violation
+var ErrDuplicate = errors.New("duplicate key")
+
+func newModel(id uint) gorm.Model {
+	now := time.Now()
+	return gorm.Model{
+		ID:        id,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func softDelete(model *gorm.Model) {
+	model.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+func trashedBefore(model gorm.Model, before time.Time) bool {
+	return model.DeletedAt.Valid && model.DeletedAt.Time.Before(before)
+}
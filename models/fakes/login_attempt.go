@@ -0,0 +1,146 @@
+package fakes
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.LoginAttemptOperation = (*LoginAttemptModel)(nil)
+
+// LoginAttemptModel applies the same throttle policies as the database implementation,
+// the defaults are used when a policy is not set.
+type LoginAttemptModel struct {
+	AccountPolicy models.LoginThrottlePolicy
+	IPPolicy      models.LoginThrottlePolicy
+
+	mu        sync.Mutex
+	throttles map[string]*models.LoginThrottle
+	events    []*models.LockoutEvent
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (l *LoginAttemptModel) WithContext(ctx context.Context) models.LoginAttemptOperation {
+	return l
+}
+
+func throttleKey(kind, key string) string {
+	return kind + "\x00" + key
+}
+
+func (l *LoginAttemptModel) policy(kind string) models.LoginThrottlePolicy {
+	if kind == models.ThrottleKindIP {
+		if l.IPPolicy.MaxFailures == 0 {
+			return models.DefaultIPThrottlePolicy
+		}
+		return l.IPPolicy
+	}
+	if l.AccountPolicy.MaxFailures == 0 {
+		return models.DefaultAccountThrottlePolicy
+	}
+	return l.AccountPolicy
+}
+
+func (l *LoginAttemptModel) get(kind, key string) *models.LoginThrottle {
+	if l.throttles == nil {
+		l.throttles = map[string]*models.LoginThrottle{}
+	}
+	throttle, ok := l.throttles[throttleKey(kind, key)]
+	if !ok {
+		throttle = &models.LoginThrottle{Kind: kind, Identifier: key}
+	}
+	return throttle
+}
+
+func (l *LoginAttemptModel) addEvent(event *models.LockoutEvent) {
+	event.Model = newModel(uint(len(l.events) + 1))
+	l.events = append(l.events, event)
+}
+
+func (l *LoginAttemptModel) GetLockedUntil(kind, key string) (time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	throttle := l.get(kind, key)
+	if time.Now().Before(throttle.LockedUntil) {
+		return throttle.LockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (l *LoginAttemptModel) RecordFailure(kind, key, ip string) (*models.LoginThrottle, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	throttle := l.get(kind, key)
+
+	policy := l.policy(kind)
+	now := time.Now()
+	if now.Sub(throttle.LastFailure) > policy.Window {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailure = now
+
+	delay, lockedOut := policy.LockFor(throttle.Failures)
+	if delay > 0 {
+		throttle.LockedUntil = now.Add(delay)
+	}
+	l.throttles[throttleKey(kind, key)] = throttle
+
+	if lockedOut {
+		l.addEvent(&models.LockoutEvent{
+			Kind:        kind,
+			Identifier:  key,
+			Event:       models.LockoutEventLocked,
+			Failures:    throttle.Failures,
+			LockedUntil: throttle.LockedUntil,
+			IP:          ip,
+		})
+	}
+	copied := *throttle
+	return &copied, nil
+}
+
+func (l *LoginAttemptModel) Reset(kind, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.throttles, throttleKey(kind, key))
+	return nil
+}
+
+func (l *LoginAttemptModel) Unlock(kind, key, actor string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	throttle := l.get(kind, key)
+	delete(l.throttles, throttleKey(kind, key))
+
+	l.addEvent(&models.LockoutEvent{
+		Kind:       kind,
+		Identifier: key,
+		Event:      models.LockoutEventUnlocked,
+		Failures:   throttle.Failures,
+		Actor:      actor,
+	})
+	return nil
+}
+
+func (l *LoginAttemptModel) GetLockoutEvents(limit int) ([]*models.LockoutEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	events := []*models.LockoutEvent{}
+	for _, event := range l.events {
+		copied := *event
+		events = append(events, &copied)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID > events[j].ID
+	})
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,94 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.OIDCOperation = (*OIDCModel)(nil)
+
+type OIDCModel struct {
+	mu         sync.Mutex
+	states     map[string]*models.OIDCLoginState
+	identities []*models.UserIdentity
+	nextID     uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (o *OIDCModel) WithContext(ctx context.Context) models.OIDCOperation {
+	return o
+}
+
+func (o *OIDCModel) SaveState(loginState *models.OIDCLoginState) (*models.OIDCLoginState, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.states == nil {
+		o.states = map[string]*models.OIDCLoginState{}
+	}
+	if _, ok := o.states[loginState.State]; ok {
+		return nil, ErrDuplicate
+	}
+
+	o.nextID++
+	loginState.Model = newModel(o.nextID)
+	copied := *loginState
+	o.states[loginState.State] = &copied
+	return loginState, nil
+}
+
+// ConsumeState returns the state once, a second callback with it finds nothing
+func (o *OIDCModel) ConsumeState(state string) (*models.OIDCLoginState, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	loginState, ok := o.states[state]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	delete(o.states, state)
+	return loginState, nil
+}
+
+func (o *OIDCModel) GetIdentity(provider, subject string) (*models.UserIdentity, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, identity := range o.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (o *OIDCModel) GetIdentitiesByUserID(userID uint) ([]*models.UserIdentity, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	identities := []*models.UserIdentity{}
+	for _, identity := range o.identities {
+		if identity.UserID == userID {
+			copied := *identity
+			identities = append(identities, &copied)
+		}
+	}
+	return identities, nil
+}
+
+func (o *OIDCModel) LinkIdentity(identity *models.UserIdentity) (*models.UserIdentity, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, linked := range o.identities {
+		if linked.Provider == identity.Provider && linked.Subject == identity.Subject {
+			return nil, ErrDuplicate
+		}
+	}
+
+	identity.Model = newModel(uint(len(o.identities) + 1))
+	copied := *identity
+	o.identities = append(o.identities, &copied)
+	return identity, nil
+}
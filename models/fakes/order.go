@@ -0,0 +1,178 @@
+package fakes
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.OrderCRUDOperation = (*OrderModel)(nil)
+
+type OrderModel struct {
+	mu     sync.Mutex
+	orders map[uint]*models.Order
+	nextID uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (o *OrderModel) WithContext(ctx context.Context) models.OrderCRUDOperation {
+	return o
+}
+
+func (o *OrderModel) init() {
+	if o.orders == nil {
+		o.orders = map[uint]*models.Order{}
+	}
+}
+
+func copyOrder(order *models.Order) *models.Order {
+	copied := *order
+	return &copied
+}
+
+func (o *OrderModel) get(id uint) (*models.Order, error) {
+	o.init()
+	order, ok := o.orders[id]
+	if !ok || order.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return order, nil
+}
+
+func (o *OrderModel) sorted(trashed bool, keep func(order *models.Order) bool) []*models.Order {
+	orders := []*models.Order{}
+	for _, order := range o.orders {
+		if order.DeletedAt.Valid == trashed && keep(order) {
+			orders = append(orders, copyOrder(order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].ID < orders[j].ID
+	})
+	return orders
+}
+
+func allOrders(*models.Order) bool {
+	return true
+}
+
+func (o *OrderModel) GetByID(id uint) (*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	order, err := o.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return copyOrder(order), nil
+}
+
+func (o *OrderModel) GetByUserID(userID uint) ([]*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.init()
+	return o.sorted(false, func(order *models.Order) bool {
+		return order.UserID == userID
+	}), nil
+}
+
+func (o *OrderModel) GetAll() ([]*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.init()
+	return o.sorted(false, allOrders), nil
+}
+
+func (o *OrderModel) Insert(order *models.Order) (*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.init()
+
+	o.nextID++
+	order.Model = newModel(o.nextID)
+	o.orders[order.ID] = copyOrder(order)
+	return order, nil
+}
+
+func (o *OrderModel) Delete(id uint) (*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	order, err := o.get(id)
+	if err != nil {
+		return nil, err
+	}
+	found := copyOrder(order)
+	softDelete(&order.Model)
+	return found, nil
+}
+
+func (o *OrderModel) GetTrashed() ([]*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.init()
+	orders := o.sorted(true, allOrders)
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].DeletedAt.Time.After(orders[j].DeletedAt.Time)
+	})
+	return orders, nil
+}
+
+func (o *OrderModel) Restore(id uint) (*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.init()
+	order, ok := o.orders[id]
+	if !ok || !order.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	order.DeletedAt = gorm.DeletedAt{}
+	return copyOrder(order), nil
+}
+
+func (o *OrderModel) Purge(before time.Time) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.init()
+
+	var purged int64
+	for id, order := range o.orders {
+		if trashedBefore(order.Model, before) {
+			delete(o.orders, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// Update only changes the status, like the database implementation
+func (o *OrderModel) Update(orderReq *models.Order) (*models.Order, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	order, err := o.get(orderReq.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if orderReq.Status != "" {
+		order.Status = orderReq.Status
+	}
+	order.UpdatedAt = time.Now()
+	return copyOrder(order), nil
+}
+
+// hasOrders includes trashed orders, they still reference the user
+func (o *OrderModel) hasOrders(userID uint) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, order := range o.orders {
+		if order.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.ProductCRUDOperation = (*ProductModel)(nil)
+
+type ProductModel struct {
+	mu       sync.Mutex
+	products map[uint]*models.Product
+	nextID   uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (p *ProductModel) WithContext(ctx context.Context) models.ProductCRUDOperation {
+	return p
+}
+
+func (p *ProductModel) init() {
+	if p.products == nil {
+		p.products = map[uint]*models.Product{}
+	}
+}
+
+func copyProduct(product *models.Product) *models.Product {
+	copied := *product
+	return &copied
+}
+
+func (p *ProductModel) get(id uint) (*models.Product, error) {
+	p.init()
+	product, ok := p.products[id]
+	if !ok || product.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return product, nil
+}
+
+func (p *ProductModel) sorted(trashed bool) []*models.Product {
+	products := []*models.Product{}
+	for _, product := range p.products {
+		if product.DeletedAt.Valid == trashed {
+			products = append(products, copyProduct(product))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].ID < products[j].ID
+	})
+	return products
+}
+
+func (p *ProductModel) GetByID(id uint) (*models.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	product, err := p.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return copyProduct(product), nil
+}
+
+func (p *ProductModel) GetAll() ([]*models.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	return p.sorted(false), nil
+}
+
+func (p *ProductModel) Insert(product *models.Product) (*models.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+
+	p.nextID++
+	product.Model = newModel(p.nextID)
+	p.products[product.ID] = copyProduct(product)
+	return product, nil
+}
+
+func (p *ProductModel) Delete(id uint) (*models.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	product, err := p.get(id)
+	if err != nil {
+		return nil, err
+	}
+	found := copyProduct(product)
+	softDelete(&product.Model)
+	return found, nil
+}
+
+func (p *ProductModel) GetTrashed() ([]*models.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	products := p.sorted(true)
+	sort.SliceStable(products, func(i, j int) bool {
+		return products[i].DeletedAt.Time.After(products[j].DeletedAt.Time)
+	})
+	return products, nil
+}
+
+func (p *ProductModel) Restore(id uint) (*models.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	product, ok := p.products[id]
+	if !ok || !product.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	product.DeletedAt = gorm.DeletedAt{}
+	return copyProduct(product), nil
+}
+
+func (p *ProductModel) Purge(before time.Time) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+
+	var purged int64
+	for id, product := range p.products {
+		if trashedBefore(product.Model, before) {
+			delete(p.products, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (p *ProductModel) Update(productReq *models.Product) (*models.Product, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	product, err := p.get(productReq.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if productReq.Item != "" {
+		product.Item = productReq.Item
+	}
+	if productReq.Price != 0 {
+		product.Price = productReq.Price
+	}
+	if productReq.Stock != 0 {
+		product.Stock = productReq.Stock
+	}
+	for _, field := range []struct {
+		req    string
+		stored *string
+	}{
+		{productReq.Pictures, &product.Pictures},
+		{productReq.XS, &product.XS},
+		{productReq.S, &product.S},
+		{productReq.M, &product.M},
+		{productReq.L, &product.L},
+		{productReq.XL, &product.XL},
+	} {
+		if field.req != "" {
+			*field.stored = field.req
+		}
+	}
+	product.UpdatedAt = time.Now()
+	return copyProduct(product), nil
+}
+
+func (p *ProductModel) TakeStock(quantities map[uint]int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, quantity := range quantities {
+		product, err := p.get(id)
+		if err != nil {
+			return err
+		}
+		if product.Stock < quantity {
+			return helpers.NewConflictError("out_of_stock", fmt.Sprintf("%v is out of stock", product.Item))
+		}
+	}
+	for id, quantity := range quantities {
+		p.products[id].Stock -= quantity
+	}
+	return nil
+}
+
+func (p *ProductModel) ReturnStock(quantities map[uint]int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	for id, quantity := range quantities {
+		if product, ok := p.products[id]; ok {
+			product.Stock += quantity
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.RoleOperation = (*RoleModel)(nil)
+
+// RoleModel starts empty, SeedDefaultRoles adds the built-in roles. Users is
+// checked before a role is deleted and may be nil.
+type RoleModel struct {
+	Users *UserModel
+
+	mu     sync.Mutex
+	roles  map[uint]*models.Role
+	nextID uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (ro *RoleModel) WithContext(ctx context.Context) models.RoleOperation {
+	return ro
+}
+
+func copyRole(role *models.Role) *models.Role {
+	copied := *role
+	copied.Permissions = []*models.RolePermission{}
+	for _, p := range role.Permissions {
+		permission := *p
+		copied.Permissions = append(copied.Permissions, &permission)
+	}
+	return &copied
+}
+
+func (ro *RoleModel) insert(role *models.Role) error {
+	if ro.roles == nil {
+		ro.roles = map[uint]*models.Role{}
+	}
+	for _, stored := range ro.roles {
+		if stored.Name == role.Name {
+			return ErrDuplicate
+		}
+	}
+
+	ro.nextID++
+	role.Model = newModel(ro.nextID)
+	for i, p := range role.Permissions {
+		p.ID = uint(i + 1)
+		p.RoleID = role.ID
+	}
+	ro.roles[role.ID] = copyRole(role)
+	return nil
+}
+
+// SeedDefaultRoles creates the built-in roles that do not exist yet ...
+func (ro *RoleModel) SeedDefaultRoles() {
+	names := []string{}
+	for name := range models.DefaultRolePermissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, err := ro.GetByName(name)
+		if err == nil {
+			continue
+		}
+		ro.mu.Lock()
+		_ = ro.insert(&models.Role{
+			Name:        name,
+			Builtin:     true,
+			Permissions: models.NewRolePermissions(models.DefaultRolePermissions[name]),
+		})
+		ro.mu.Unlock()
+	}
+}
+
+func (ro *RoleModel) GetByID(id uint) (*models.Role, error) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	role, ok := ro.roles[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return copyRole(role), nil
+}
+
+func (ro *RoleModel) GetByName(name string) (*models.Role, error) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	for _, role := range ro.roles {
+		if role.Name == name {
+			return copyRole(role), nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (ro *RoleModel) GetAll() ([]*models.Role, error) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	roles := []*models.Role{}
+	for _, role := range ro.roles {
+		roles = append(roles, copyRole(role))
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].ID < roles[j].ID
+	})
+	return roles, nil
+}
+
+func (ro *RoleModel) GetPermissions(name string) ([]string, error) {
+	role, err := ro.GetByName(name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role.PermissionNames(), nil
+}
+
+func (ro *RoleModel) Insert(role *models.Role) (*models.Role, error) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	err := ro.insert(role)
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (ro *RoleModel) Update(roleReq *models.Role) (*models.Role, error) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	role, ok := ro.roles[roleReq.ID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if role.Builtin {
+		return nil, helpers.NewForbiddenError("builtin_role", "built-in roles cannot be edited")
+	}
+
+	if roleReq.Description != "" {
+		role.Description = roleReq.Description
+	}
+	if roleReq.Permissions != nil {
+		role.Permissions = []*models.RolePermission{}
+		for i, p := range roleReq.Permissions {
+			role.Permissions = append(role.Permissions, &models.RolePermission{
+				ID:         uint(i + 1),
+				RoleID:     role.ID,
+				Permission: p.Permission,
+			})
+		}
+	}
+	role.UpdatedAt = time.Now()
+	return copyRole(role), nil
+}
+
+func (ro *RoleModel) Delete(id uint) (*models.Role, error) {
+	role, err := ro.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if role.Builtin {
+		return nil, helpers.NewForbiddenError("builtin_role", "built-in roles cannot be deleted")
+	}
+	if ro.Users != nil && ro.Users.countRole(role.Name) > 0 {
+		return nil, helpers.NewConflictError("role_in_use", "role is still assigned to users")
+	}
+
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	delete(ro.roles, id)
+	return role, nil
+}
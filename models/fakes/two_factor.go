@@ -0,0 +1,95 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.TwoFactorOperation = (*TwoFactorModel)(nil)
+
+// TwoFactorModel writes the totp columns of the users in Users, which must be set.
+type TwoFactorModel struct {
+	Users *UserModel
+
+	mu    sync.Mutex
+	codes []*models.RecoveryCode
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (t *TwoFactorModel) WithContext(ctx context.Context) models.TwoFactorOperation {
+	return t
+}
+
+func (t *TwoFactorModel) SetPendingSecret(userID uint, secret string) error {
+	t.Users.update(userID, func(user *models.User) {
+		user.TOTPSecret = secret
+		user.TOTPEnabled = false
+		user.TOTPLastStep = 0
+	})
+	return nil
+}
+
+func (t *TwoFactorModel) Enable(userID uint, step int64) error {
+	t.Users.update(userID, func(user *models.User) {
+		user.TOTPEnabled = true
+		user.TOTPLastStep = step
+	})
+	return nil
+}
+
+func (t *TwoFactorModel) Disable(userID uint) error {
+	t.Users.update(userID, func(user *models.User) {
+		user.TOTPSecret = ""
+		user.TOTPEnabled = false
+		user.TOTPLastStep = 0
+	})
+	return t.ReplaceRecoveryCodes(userID, nil)
+}
+
+func (t *TwoFactorModel) UseStep(userID uint, step int64) (bool, error) {
+	used := false
+	t.Users.update(userID, func(user *models.User) {
+		if user.TOTPLastStep < step {
+			user.TOTPLastStep = step
+			used = true
+		}
+	})
+	return used, nil
+}
+
+func (t *TwoFactorModel) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	codes := []*models.RecoveryCode{}
+	for _, code := range t.codes {
+		if code.UserID != userID {
+			codes = append(codes, code)
+		}
+	}
+	for _, codeHash := range codeHashes {
+		codes = append(codes, &models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: codeHash,
+		})
+	}
+	t.codes = codes
+	return nil
+}
+
+func (t *TwoFactorModel) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, code := range t.codes {
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,322 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"future-fashion/dto"
+	"future-fashion/helpers"
+	"future-fashion/models"
+)
+
+// type assertion
+var _ models.UserCRUDOperation = (*UserModel)(nil)
+
+// UserModel keeps users in memory. Erase only anonymizes the user, the rows of the
+// other fakes are left alone.
+type UserModel struct {
+	//users that still have orders are kept by Purge, like on the database
+	Orders *OrderModel
+
+	mu     sync.Mutex
+	users  map[uint]*models.User
+	nextID uint
+}
+
+// WithContext returns the fake itself, it keeps no per-request state
+func (u *UserModel) WithContext(ctx context.Context) models.UserCRUDOperation {
+	return u
+}
+
+func (u *UserModel) init() {
+	if u.users == nil {
+		u.users = map[uint]*models.User{}
+	}
+}
+
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	copied.Orders = nil
+	return &copied
+}
+
+// get returns the stored user, callers hold the lock
+func (u *UserModel) get(id uint) (*models.User, error) {
+	u.init()
+	user, ok := u.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (u *UserModel) sorted(trashed bool) []*models.User {
+	users := []*models.User{}
+	for _, user := range u.users {
+		if user.DeletedAt.Valid == trashed {
+			users = append(users, copyUser(user))
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].ID < users[j].ID
+	})
+	return users
+}
+
+func (u *UserModel) GetByID(id uint) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, err := u.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return copyUser(user), nil
+}
+
+func (u *UserModel) GetByUsername(username string) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, user := range u.sorted(false) {
+		if strings.EqualFold(user.Username, username) {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (u *UserModel) GetByEmail(email string) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, user := range u.sorted(false) {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (u *UserModel) GetAll() ([]*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+	return u.sorted(false), nil
+}
+
+func (u *UserModel) Insert(userReq *dto.UserRequest) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+
+	//username is unique across the trash too
+	for _, user := range u.users {
+		if strings.EqualFold(user.Username, userReq.Username) {
+			return nil, ErrDuplicate
+		}
+	}
+
+	u.nextID++
+	user := &models.User{
+		Model:    newModel(u.nextID),
+		Username: models.NormalizeIdentifier(userReq.Username),
+		Email:    models.NormalizeIdentifier(userReq.Email),
+		Password: userReq.Password,
+		DOB:      userReq.DOB,
+		Role:     userReq.Role,
+	}
+	u.users[user.ID] = user
+	return copyUser(user), nil
+}
+
+// Put stores the user as given, e.g. to set up a test, and assigns an id when it has none ...
+func (u *UserModel) Put(user *models.User) *models.User {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+
+	stored := copyUser(user)
+	if stored.ID == 0 {
+		u.nextID++
+		stored.ID = u.nextID
+	}
+	if stored.ID > u.nextID {
+		u.nextID = stored.ID
+	}
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = time.Now()
+		stored.UpdatedAt = stored.CreatedAt
+	}
+	u.users[stored.ID] = stored
+	return copyUser(stored)
+}
+
+func (u *UserModel) Delete(id uint) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, err := u.get(id)
+	if err != nil {
+		return nil, err
+	}
+	found := copyUser(user)
+	softDelete(&user.Model)
+	return found, nil
+}
+
+func (u *UserModel) GetTrashed() ([]*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+	users := u.sorted(true)
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].DeletedAt.Time.After(users[j].DeletedAt.Time)
+	})
+	return users, nil
+}
+
+func (u *UserModel) Restore(id uint) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+	user, ok := u.users[id]
+	if !ok || !user.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	for _, other := range u.users {
+		if other.ID == id || other.DeletedAt.Valid {
+			continue
+		}
+		if user.Email != "" && other.Email == user.Email {
+			return nil, helpers.NewConflictError("email_taken", "email address is registered to another account")
+		}
+		if other.Username == user.Username {
+			return nil, helpers.NewConflictError("username_taken", "username is used by another account")
+		}
+	}
+	user.DeletedAt = gorm.DeletedAt{}
+	return copyUser(user), nil
+}
+
+func (u *UserModel) Purge(before time.Time) (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+
+	var purged int64
+	for id, user := range u.users {
+		if !trashedBefore(user.Model, before) {
+			continue
+		}
+		if u.Orders != nil && u.Orders.hasOrders(id) {
+			continue
+		}
+		delete(u.users, id)
+		purged++
+	}
+	return purged, nil
+}
+
+func (u *UserModel) Erase(id uint) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, err := u.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	*user = models.User{
+		Model:    user.Model,
+		Username: fmt.Sprintf("erased-%v", id),
+		Role:     user.Role,
+	}
+	softDelete(&user.Model)
+	return copyUser(user), nil
+}
+
+func (u *UserModel) Update(userReq *models.User) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, err := u.get(userReq.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if userReq.Username != "" {
+		user.Username = models.NormalizeIdentifier(userReq.Username)
+	}
+	if email := models.NormalizeIdentifier(userReq.Email); email != "" && user.Email != email {
+		user.Email = email
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+	}
+	if userReq.Password != "" {
+		user.Password = userReq.Password
+	}
+	if userReq.DOB != "" {
+		user.DOB = userReq.DOB
+	}
+	if userReq.Chest != 0 {
+		user.Chest = userReq.Chest
+	}
+	if userReq.Waist != 0 {
+		user.Waist = userReq.Waist
+	}
+	if userReq.Hip != 0 {
+		user.Hip = userReq.Hip
+	}
+	user.UpdatedAt = time.Now()
+	return copyUser(user), nil
+}
+
+func (u *UserModel) MarkEmailVerified(id uint) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, err := u.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	return copyUser(user), nil
+}
+
+func (u *UserModel) UpdateRole(id uint, role string) (*models.User, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	user, err := u.get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = role
+	return copyUser(user), nil
+}
+
+// update changes a stored user in place, for the fakes that write user columns
+func (u *UserModel) update(id uint, change func(user *models.User)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.init()
+	if user, ok := u.users[id]; ok {
+		change(user)
+	}
+}
+
+// countRole counts the users with the role, trashed ones included like on the database
+func (u *UserModel) countRole(role string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	count := 0
+	for _, user := range u.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count
+}
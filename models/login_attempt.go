@@ -0,0 +1,262 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"future-fashion/metrics"
+)
+
+const (
+	ThrottleKindAccount = "account"
+	ThrottleKindIP      = "ip"
+
+	LockoutEventLocked   = "locked"
+	LockoutEventUnlocked = "unlocked"
+)
+
+type LoginAttemptOperation interface {
+	GetLockedUntil(kind, key string) (time.Time, error)
+	RecordFailure(kind, key, ip string) (*LoginThrottle, error)
+	Reset(kind, key string) error
+	Unlock(kind, key, actor string) error
+	GetLockoutEvents(limit int) ([]*LockoutEvent, error)
+	WithContext(ctx context.Context) LoginAttemptOperation
+}
+
+// type assertion
+var _ LoginAttemptOperation = (*LoginAttemptOperationsImpl)(nil)
+
+// LoginThrottle counts consecutive failed logins for one account or one client IP ...
+type LoginThrottle struct {
+	gorm.Model
+	Kind        string    `json:"kind" gorm:"size:16;uniqueIndex:idx_login_throttle_key"`
+	Identifier  string    `json:"identifier" gorm:"size:191;uniqueIndex:idx_login_throttle_key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LockoutEvent is an append-only record of every lockout and manual unlock ...
+type LockoutEvent struct {
+	gorm.Model
+	Kind        string    `json:"kind"`
+	Identifier  string    `json:"identifier"`
+	Event       string    `json:"event"`
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+	IP          string    `json:"ip"`
+	Actor       string    `json:"actor"`
+}
+
+// LoginThrottlePolicy decides how long a key is blocked after each failure.
+// The first FreeAttempts failures are not delayed, every further failure doubles
+// the delay starting at BaseDelay up to MaxDelay, and reaching MaxFailures locks
+// the key for LockoutDuration. Failures older than Window are forgotten.
+type LoginThrottlePolicy struct {
+	FreeAttempts    int
+	MaxFailures     int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+var DefaultAccountThrottlePolicy = LoginThrottlePolicy{
+	FreeAttempts:    3,
+	MaxFailures:     10,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutDuration: 30 * time.Minute,
+	Window:          time.Hour,
+}
+
+// an IP may be shared by many customers behind a NAT, so it gets a looser policy
+var DefaultIPThrottlePolicy = LoginThrottlePolicy{
+	FreeAttempts:    10,
+	MaxFailures:     50,
+	BaseDelay:       time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutDuration: 30 * time.Minute,
+	Window:          time.Hour,
+}
+
+type LoginAttemptOperationsImpl struct {
+	DB            *gorm.DB
+	Logger        *zap.SugaredLogger
+	AccountPolicy LoginThrottlePolicy
+	IPPolicy      LoginThrottlePolicy
+	Metrics       *metrics.Metrics
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (l *LoginAttemptOperationsImpl) WithContext(ctx context.Context) LoginAttemptOperation {
+	clone := *l
+	clone.DB = l.DB.WithContext(ctx)
+	return &clone
+}
+
+// LockFor returns how long a key is blocked after its nth failure and whether that is a lockout ...
+func (p LoginThrottlePolicy) LockFor(failures int) (time.Duration, bool) {
+	if failures >= p.MaxFailures {
+		return p.LockoutDuration, true
+	}
+	if failures < p.FreeAttempts {
+		return 0, false
+	}
+	delay := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(failures-p.FreeAttempts)))
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	return delay, false
+}
+
+func (l *LoginAttemptOperationsImpl) policy(kind string) LoginThrottlePolicy {
+	if kind == ThrottleKindIP {
+		if l.IPPolicy.MaxFailures == 0 {
+			return DefaultIPThrottlePolicy
+		}
+		return l.IPPolicy
+	}
+	if l.AccountPolicy.MaxFailures == 0 {
+		return DefaultAccountThrottlePolicy
+	}
+	return l.AccountPolicy
+}
+
+func (l *LoginAttemptOperationsImpl) get(kind, key string) (*LoginThrottle, error) {
+	throttle := &LoginThrottle{}
+	err := l.DB.Where("kind = ? AND identifier = ?", kind, key).First(throttle).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &LoginThrottle{Kind: kind, Identifier: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+// GetLockedUntil returns the time until which the key is blocked, zero if it is not ...
+func (l *LoginAttemptOperationsImpl) GetLockedUntil(kind, key string) (time.Time, error) {
+	throttle, err := l.get(kind, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if time.Now().Before(throttle.LockedUntil) {
+		return throttle.LockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+// RecordFailure counts a failed login of the key. The count is incremented in the database,
+// so concurrent guesses cannot overwrite each other's failures ...
+func (l *LoginAttemptOperationsImpl) RecordFailure(kind, key, ip string) (*LoginThrottle, error) {
+	policy := l.policy(kind)
+	now := time.Now()
+
+	//the first failure of a key creates its row, a concurrent first failure finds it there
+	err := l.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&LoginThrottle{Kind: kind, Identifier: key}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	//failures is listed before last_failure, mysql evaluates the assignments in order
+	err = l.DB.Model(&LoginThrottle{}).
+		Where("kind = ? AND identifier = ?", kind, key).
+		Updates(map[string]interface{}{
+			"failures":     gorm.Expr("CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END", now.Add(-policy.Window)),
+			"last_failure": now,
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	throttle, err := l.get(kind, key)
+	if err != nil {
+		return nil, err
+	}
+
+	delay, lockedOut := policy.LockFor(throttle.Failures)
+	if delay > 0 {
+		lockedUntil := now.Add(delay)
+		//never shortens a lock set by a concurrent failure with a higher count
+		err = l.DB.Model(&LoginThrottle{}).
+			Where("kind = ? AND identifier = ? AND locked_until < ?", kind, key, lockedUntil).
+			Update("locked_until", lockedUntil).Error
+		if err != nil {
+			return nil, err
+		}
+		if throttle.LockedUntil.Before(lockedUntil) {
+			throttle.LockedUntil = lockedUntil
+		}
+	}
+
+	//every failed login records one account failure and one ip failure, count it once
+	if kind == ThrottleKindAccount {
+		l.Metrics.LoginFailed()
+	}
+
+	if lockedOut {
+		l.Metrics.LockedOut(kind)
+		event := &LockoutEvent{
+			Kind:        kind,
+			Identifier:  key,
+			Event:       LockoutEventLocked,
+			Failures:    throttle.Failures,
+			LockedUntil: throttle.LockedUntil,
+			IP:          ip,
+		}
+		err = l.DB.Create(event).Error
+		if err != nil {
+			return nil, err
+		}
+		l.Logger.Warnw("login lockout", "kind", kind, "key", key, "ip", ip, "failures", throttle.Failures, "locked_until", throttle.LockedUntil)
+	}
+	return throttle, nil
+}
+
+// Reset clears the failures of a key after a successful login ...
+func (l *LoginAttemptOperationsImpl) Reset(kind, key string) error {
+	return l.DB.Where("kind = ? AND identifier = ?", kind, key).Unscoped().Delete(&LoginThrottle{}).Error
+}
+
+func (l *LoginAttemptOperationsImpl) Unlock(kind, key, actor string) error {
+	throttle, err := l.get(kind, key)
+	if err != nil {
+		return err
+	}
+
+	err = l.Reset(kind, key)
+	if err != nil {
+		return err
+	}
+
+	event := &LockoutEvent{
+		Kind:       kind,
+		Identifier: key,
+		Event:      LockoutEventUnlocked,
+		Failures:   throttle.Failures,
+		Actor:      actor,
+	}
+	err = l.DB.Create(event).Error
+	if err != nil {
+		return err
+	}
+	l.Logger.Infow("login unlock", "kind", kind, "key", key, "actor", actor)
+	return nil
+}
+
+func (l *LoginAttemptOperationsImpl) GetLockoutEvents(limit int) ([]*LockoutEvent, error) {
+	var events []*LockoutEvent
+	err := l.DB.Order("id desc").Limit(limit).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
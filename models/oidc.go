@@ -0,0 +1,108 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type OIDCOperation interface {
+	SaveState(*OIDCLoginState) (*OIDCLoginState, error)
+	ConsumeState(state string) (*OIDCLoginState, error)
+	GetIdentity(provider, subject string) (*UserIdentity, error)
+	GetIdentitiesByUserID(userID uint) ([]*UserIdentity, error)
+	LinkIdentity(*UserIdentity) (*UserIdentity, error)
+	WithContext(ctx context.Context) OIDCOperation
+}
+
+// type assertion
+var _ OIDCOperation = (*OIDCOperationsImpl)(nil)
+
+// OIDCLoginState is a login started with an identity provider, consumed by the callback ...
+type OIDCLoginState struct {
+	gorm.Model
+	State        string    `json:"-" gorm:"size:64;uniqueIndex"`
+	Provider     string    `json:"provider" gorm:"size:64"`
+	Nonce        string    `json:"-" gorm:"size:64"`
+	CodeVerifier string    `json:"-" gorm:"size:128"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// UserIdentity links an account at an identity provider to one of our users ...
+type UserIdentity struct {
+	gorm.Model
+	UserID   uint   `json:"user_id" gorm:"index"`
+	Provider string `json:"provider" gorm:"size:64;uniqueIndex:idx_user_identity"`
+	Subject  string `json:"subject" gorm:"size:191;uniqueIndex:idx_user_identity"`
+	Email    string `json:"email" gorm:"size:191"`
+}
+
+type OIDCOperationsImpl struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (o *OIDCOperationsImpl) WithContext(ctx context.Context) OIDCOperation {
+	clone := *o
+	clone.DB = o.DB.WithContext(ctx)
+	return &clone
+}
+
+func (o *OIDCOperationsImpl) SaveState(loginState *OIDCLoginState) (*OIDCLoginState, error) {
+	err := o.DB.Create(loginState).Error
+	if err != nil {
+		return nil, err
+	}
+	return loginState, nil
+}
+
+func (o *OIDCOperationsImpl) ConsumeState(state string) (*OIDCLoginState, error) {
+	loginState := &OIDCLoginState{}
+	err := o.DB.Where("state = ?", state).First(loginState).Error
+	if err != nil {
+		return nil, err
+	}
+
+	//a state can only be used once, the row count guards against two concurrent callbacks
+	res := o.DB.Unscoped().Delete(&OIDCLoginState{}, loginState.ID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return loginState, nil
+}
+
+func (o *OIDCOperationsImpl) GetIdentity(provider, subject string) (*UserIdentity, error) {
+	identity := &UserIdentity{}
+	err := o.DB.Where("provider = ? AND subject = ?", provider, subject).First(identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (o *OIDCOperationsImpl) GetIdentitiesByUserID(userID uint) ([]*UserIdentity, error) {
+	var identities []*UserIdentity
+	err := o.DB.Where("user_id = ?", userID).Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (o *OIDCOperationsImpl) LinkIdentity(identity *UserIdentity) (*UserIdentity, error) {
+	err := o.DB.Create(identity).Error
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
@@ -1,19 +1,36 @@
 package models
 
 import (
+	"context"
+	"time"
+
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+
+	"future-fashion/metrics"
+)
+
+const (
+	OrderStatusConfirmed = "Order is comfirmed"
+	OrderStatusCancelled = "Cancelled"
 )
 
 type OrderCRUDOperation interface {
 	GetByID(id uint) (*Order, error)
 	GetByUserID(user_id uint) ([]*Order, error)
 	GetAll() ([]*Order, error)
-	Insert(*Order) (*Product, error)
-	Delete(id uint) (*Product, error)
+	Insert(*Order) (*Order, error)
+	Delete(id uint) (*Order, error)
+	GetTrashed() ([]*Order, error)
+	Restore(id uint) (*Order, error)
+	Purge(before time.Time) (int64, error)
 	Update(orderReq *Order) (*Order, error)
+	WithContext(ctx context.Context) OrderCRUDOperation
 }
 
+// type assertion
+var _ OrderCRUDOperation = (*OrderCRUDOperationsImpl)(nil)
+
 type Order struct {
 	gorm.Model
 	Total     float32 `json:"total"`
@@ -23,8 +40,16 @@ type Order struct {
 }
 
 type OrderCRUDOperationsImpl struct {
-	DB     *gorm.DB
-	Logger *zap.SugaredLogger
+	DB      *gorm.DB
+	Logger  *zap.SugaredLogger
+	Metrics *metrics.Metrics
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (o *OrderCRUDOperationsImpl) WithContext(ctx context.Context) OrderCRUDOperation {
+	clone := *o
+	clone.DB = o.DB.WithContext(ctx)
+	return &clone
 }
 
 func (o *OrderCRUDOperationsImpl) GetByID(id uint) (*Order, error) {
@@ -59,6 +84,7 @@ func (o *OrderCRUDOperationsImpl) Insert(order *Order) (*Order, error) {
 	if err != nil {
 		return nil, err
 	}
+	o.Metrics.OrderCreated(order.Total)
 	return order, nil
 }
 
@@ -67,15 +93,41 @@ func (o *OrderCRUDOperationsImpl) Delete(id uint) (*Order, error) {
 	if err != nil {
 		return nil, err
 	}
-	//delete only if the user exists
-	//permanently deleted with Unscoped().Delete()
-	err = o.DB.Unscoped().Delete(foundOrder, id).Error
+	//delete only if the order exists
+	//soft deleted, it stays in the trash until restored or purged
+	err = o.DB.Delete(foundOrder, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return foundOrder, nil
 }
 
+func (o *OrderCRUDOperationsImpl) GetTrashed() ([]*Order, error) {
+	var orders []*Order
+	err := o.DB.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (o *OrderCRUDOperationsImpl) Restore(id uint) (*Order, error) {
+	res := o.DB.Unscoped().Model(&Order{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return o.GetByID(id)
+}
+
+// Purge permanently deletes orders that have been in the trash since before the cutoff ...
+func (o *OrderCRUDOperationsImpl) Purge(before time.Time) (int64, error) {
+	res := o.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&Order{})
+	return res.RowsAffected, res.Error
+}
+
 func (o *OrderCRUDOperationsImpl) Update(orderReq *Order) (*Order, error) {
 	foundOrder, err := o.GetByID(orderReq.ID)
 	if err != nil {
@@ -1,8 +1,16 @@
 package models
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+
+	"future-fashion/helpers"
+	"future-fashion/metrics"
 )
 
 type ProductCRUDOperation interface {
@@ -10,9 +18,18 @@ type ProductCRUDOperation interface {
 	GetAll() ([]*Product, error)
 	Insert(*Product) (*Product, error)
 	Delete(id uint) (*Product, error)
+	GetTrashed() ([]*Product, error)
+	Restore(id uint) (*Product, error)
+	Purge(before time.Time) (int64, error)
 	Update(productReq *Product) (*Product, error)
+	TakeStock(quantities map[uint]int) error
+	ReturnStock(quantities map[uint]int) error
+	WithContext(ctx context.Context) ProductCRUDOperation
 }
 
+// type assertion
+var _ ProductCRUDOperation = (*ProductCRUDOperationsImpl)(nil)
+
 type Product struct {
 	gorm.Model
 	Item     string  `json:"item"`
@@ -27,8 +44,16 @@ type Product struct {
 }
 
 type ProductCRUDOperationsImpl struct {
-	DB     *gorm.DB
-	Logger *zap.SugaredLogger
+	DB      *gorm.DB
+	Logger  *zap.SugaredLogger
+	Metrics *metrics.Metrics
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (p *ProductCRUDOperationsImpl) WithContext(ctx context.Context) ProductCRUDOperation {
+	clone := *p
+	clone.DB = p.DB.WithContext(ctx)
+	return &clone
 }
 
 func (p *ProductCRUDOperationsImpl) GetByID(id uint) (*Product, error) {
@@ -62,15 +87,41 @@ func (p *ProductCRUDOperationsImpl) Delete(id uint) (*Product, error) {
 	if err != nil {
 		return nil, err
 	}
-	//delete only if the user exists
-	//permanently deleted with Unscoped().Delete()
-	err = p.DB.Unscoped().Delete(foundProduct, id).Error
+	//delete only if the product exists
+	//soft deleted, it stays in the trash until restored or purged
+	err = p.DB.Delete(foundProduct, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return foundProduct, nil
 }
 
+func (p *ProductCRUDOperationsImpl) GetTrashed() ([]*Product, error) {
+	var products []*Product
+	err := p.DB.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (p *ProductCRUDOperationsImpl) Restore(id uint) (*Product, error) {
+	res := p.DB.Unscoped().Model(&Product{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return p.GetByID(id)
+}
+
+// Purge permanently deletes products that have been in the trash since before the cutoff ...
+func (p *ProductCRUDOperationsImpl) Purge(before time.Time) (int64, error) {
+	res := p.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&Product{})
+	return res.RowsAffected, res.Error
+}
+
 func (p *ProductCRUDOperationsImpl) Update(productReq *Product) (*Product, error) {
 	foundProduct, err := p.GetByID(productReq.ID)
 	if err != nil {
@@ -111,3 +162,54 @@ func (p *ProductCRUDOperationsImpl) Update(productReq *Product) (*Product, error
 	}
 	return foundProduct, nil
 }
+
+// TakeStock lowers the stock of every product by its quantity, all or nothing. A product
+// that does not have enough left rejects the whole checkout ...
+func (p *ProductCRUDOperationsImpl) TakeStock(quantities map[uint]int) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range sortedProductIDs(quantities) {
+			//checked and lowered in one statement, so two checkouts cannot both take the last one
+			res := tx.Model(&Product{}).Where("id = ? AND stock >= ?", id, quantities[id]).Update("stock", gorm.Expr("stock - ?", quantities[id]))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				continue
+			}
+
+			foundProduct := &Product{}
+			err := tx.First(foundProduct, id).Error
+			if err != nil {
+				return err
+			}
+			p.Metrics.OutOfStock()
+			return helpers.NewConflictError("out_of_stock", fmt.Sprintf("%v is out of stock", foundProduct.Item))
+		}
+		return nil
+	})
+}
+
+// ReturnStock gives back what TakeStock took, when the order could not be placed after all
+func (p *ProductCRUDOperationsImpl) ReturnStock(quantities map[uint]int) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range sortedProductIDs(quantities) {
+			err := tx.Unscoped().Model(&Product{}).Where("id = ?", id).Update("stock", gorm.Expr("stock + ?", quantities[id])).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sortedProductIDs keeps the same order every time, so concurrent checkouts lock the rows without deadlocking
+func sortedProductIDs(quantities map[uint]int) []uint {
+	ids := make([]uint, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"future-fashion/helpers"
+)
+
+type RoleOperation interface {
+	GetByID(id uint) (*Role, error)
+	GetByName(name string) (*Role, error)
+	GetAll() ([]*Role, error)
+	GetPermissions(name string) ([]string, error)
+	Insert(*Role) (*Role, error)
+	Update(*Role) (*Role, error)
+	Delete(id uint) (*Role, error)
+	WithContext(ctx context.Context) RoleOperation
+}
+
+// type assertion
+var _ RoleOperation = (*RoleOperationsImpl)(nil)
+
+type Role struct {
+	gorm.Model
+	Name        string            `json:"name" gorm:"size:64;unique"`
+	Description string            `json:"description"`
+	Builtin     bool              `json:"builtin"`
+	Permissions []*RolePermission `json:"permissions"`
+}
+
+type RolePermission struct {
+	ID         uint   `gorm:"primarykey"`
+	RoleID     uint   `json:"role_id" gorm:"uniqueIndex:idx_role_permission"`
+	Permission string `json:"permission" gorm:"size:64;uniqueIndex:idx_role_permission"`
+}
+
+// DefaultRolePermissions are the roles seeded on start, existing roles are left untouched ...
+var DefaultRolePermissions = map[string][]string{
+	helpers.RoleSuperAdmin: {helpers.PermissionAll},
+	helpers.RoleAdmin: {
+		helpers.PermissionCustomersRead,
+		helpers.PermissionCustomersWrite,
+		helpers.PermissionCustomersDelete,
+		helpers.PermissionProductsWrite,
+		helpers.PermissionOrdersRead,
+		helpers.PermissionOrdersUpdateStatus,
+		helpers.PermissionOrdersCancel,
+		helpers.PermissionOrdersDelete,
+		helpers.PermissionAccountsUnlock,
+		helpers.PermissionAuditRead,
+	},
+	helpers.RoleWarehouse: {
+		helpers.PermissionOrdersRead,
+		helpers.PermissionOrdersUpdateStatus,
+	},
+	helpers.RoleCatalogManager: {
+		helpers.PermissionProductsWrite,
+	},
+	helpers.RoleSupport: {
+		helpers.PermissionCustomersRead,
+		helpers.PermissionOrdersRead,
+		helpers.PermissionOrdersCancel,
+	},
+	helpers.RoleCustomer: {},
+}
+
+type RoleOperationsImpl struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (ro *RoleOperationsImpl) WithContext(ctx context.Context) RoleOperation {
+	clone := *ro
+	clone.DB = ro.DB.WithContext(ctx)
+	return &clone
+}
+
+func (role *Role) PermissionNames() []string {
+	permissions := []string{}
+	for _, p := range role.Permissions {
+		permissions = append(permissions, p.Permission)
+	}
+	return permissions
+}
+
+func NewRolePermissions(permissions []string) []*RolePermission {
+	rolePermissions := []*RolePermission{}
+	for _, p := range permissions {
+		rolePermissions = append(rolePermissions, &RolePermission{
+			Permission: p,
+		})
+	}
+	return rolePermissions
+}
+
+// SeedDefaultRoles creates the built-in roles that do not exist yet ...
+func SeedDefaultRoles(db *gorm.DB) error {
+	for name, permissions := range DefaultRolePermissions {
+		var count int64
+		err := db.Model(&Role{}).Where("name = ?", name).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		err = db.Create(&Role{
+			Name:        name,
+			Builtin:     true,
+			Permissions: NewRolePermissions(permissions),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ro *RoleOperationsImpl) GetByID(id uint) (*Role, error) {
+	role := &Role{}
+	err := ro.DB.Preload("Permissions").First(role, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (ro *RoleOperationsImpl) GetByName(name string) (*Role, error) {
+	role := &Role{}
+	err := ro.DB.Preload("Permissions").Where("name = ?", name).First(role).Error
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (ro *RoleOperationsImpl) GetAll() ([]*Role, error) {
+	var roles []*Role
+	err := ro.DB.Preload("Permissions").Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetPermissions returns the permissions of a role, an unknown role has none ...
+func (ro *RoleOperationsImpl) GetPermissions(name string) ([]string, error) {
+	role, err := ro.GetByName(name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role.PermissionNames(), nil
+}
+
+func (ro *RoleOperationsImpl) Insert(role *Role) (*Role, error) {
+	err := ro.DB.Create(role).Error
+	if err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Update changes the description and replaces the permission set of a custom role. Built-in
+// roles are left alone, every signup gets customer and super-admin must keep roles:manage ...
+func (ro *RoleOperationsImpl) Update(roleReq *Role) (*Role, error) {
+	foundRole, err := ro.GetByID(roleReq.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if foundRole.Builtin {
+		return nil, errBuiltinRoleEdit
+	}
+
+	err = ro.DB.Transaction(func(tx *gorm.DB) error {
+		if roleReq.Description != "" {
+			foundRole.Description = roleReq.Description
+			err := tx.Save(foundRole).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if roleReq.Permissions != nil {
+			err := tx.Where("role_id = ?", foundRole.ID).Delete(&RolePermission{}).Error
+			if err != nil {
+				return err
+			}
+			for _, p := range roleReq.Permissions {
+				p.ID = 0
+				p.RoleID = foundRole.ID
+			}
+			if len(roleReq.Permissions) > 0 {
+				err = tx.Create(roleReq.Permissions).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ro.GetByID(foundRole.ID)
+}
+
+var errBuiltinRoleEdit = helpers.NewForbiddenError("builtin_role", "built-in roles cannot be edited")
+
+// Delete removes a custom role that no user is assigned to ...
+func (ro *RoleOperationsImpl) Delete(id uint) (*Role, error) {
+	foundRole, err := ro.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if foundRole.Builtin {
+		return nil, helpers.NewForbiddenError("builtin_role", "built-in roles cannot be deleted")
+	}
+
+	var count int64
+	err = ro.DB.Model(&User{}).Where("role = ?", foundRole.Name).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, helpers.NewConflictError("role_in_use", "role is still assigned to users")
+	}
+
+	err = ro.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("role_id = ?", foundRole.ID).Delete(&RolePermission{}).Error
+		if err != nil {
+			return err
+		}
+		//permanently deleted so the name can be reused
+		return tx.Unscoped().Delete(foundRole).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return foundRole, nil
+}
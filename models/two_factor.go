@@ -0,0 +1,109 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type TwoFactorOperation interface {
+	SetPendingSecret(userID uint, secret string) error
+	Enable(userID uint, step int64) error
+	Disable(userID uint) error
+	UseStep(userID uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) (bool, error)
+	WithContext(ctx context.Context) TwoFactorOperation
+}
+
+// type assertion
+var _ TwoFactorOperation = (*TwoFactorOperationsImpl)(nil)
+
+// RecoveryCode is a single use code that replaces a TOTP code when the device is lost ...
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `json:"user_id" gorm:"index"`
+	CodeHash string     `json:"-" gorm:"size:64"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+type TwoFactorOperationsImpl struct {
+	DB     *gorm.DB
+	Logger *zap.SugaredLogger
+}
+
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (t *TwoFactorOperationsImpl) WithContext(ctx context.Context) TwoFactorOperation {
+	clone := *t
+	clone.DB = t.DB.WithContext(ctx)
+	return &clone
+}
+
+// SetPendingSecret stores a new secret that only becomes active once confirmed ...
+func (t *TwoFactorOperationsImpl) SetPendingSecret(userID uint, secret string) error {
+	return t.DB.Model(&User{}).Where("id = ?", userID).
+		Select("TOTPSecret", "TOTPEnabled", "TOTPLastStep").
+		Updates(&User{TOTPSecret: secret}).Error
+}
+
+func (t *TwoFactorOperationsImpl) Enable(userID uint, step int64) error {
+	return t.DB.Model(&User{}).Where("id = ?", userID).
+		Select("TOTPEnabled", "TOTPLastStep").
+		Updates(&User{TOTPEnabled: true, TOTPLastStep: step}).Error
+}
+
+func (t *TwoFactorOperationsImpl) Disable(userID uint) error {
+	return t.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).
+			Select("TOTPSecret", "TOTPEnabled", "TOTPLastStep").
+			Updates(&User{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Unscoped().Delete(&RecoveryCode{}).Error
+	})
+}
+
+// UseStep records the TOTP step as used, it reports false if the step or a later one was used already ...
+func (t *TwoFactorOperationsImpl) UseStep(userID uint, step int64) (bool, error) {
+	//the check and the write are one statement, so concurrent logins cannot both use the step
+	res := t.DB.Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes drops every previous code of the user and stores the new ones ...
+func (t *TwoFactorOperationsImpl) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return t.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", userID).Unscoped().Delete(&RecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+
+		codes := []*RecoveryCode{}
+		for _, codeHash := range codeHashes {
+			codes = append(codes, &RecoveryCode{
+				UserID:   userID,
+				CodeHash: codeHash,
+			})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode marks a matching unused code as used, it reports false if none matched ...
+func (t *TwoFactorOperationsImpl) UseRecoveryCode(userID uint, codeHash string) (bool, error) {
+	res := t.DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
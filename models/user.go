@@ -1,7 +1,13 @@
 package models
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"future-fashion/dto"
+	"future-fashion/helpers"
 
 	"gorm.io/gorm"
 
@@ -11,27 +17,51 @@ import (
 type UserCRUDOperation interface {
 	GetByID(uint) (*User, error)
 	GetByUsername(string) (*User, error)
+	GetByEmail(string) (*User, error)
 	GetAll() ([]*User, error)
-	Insert(*User) (*User, error)
+	Insert(*dto.UserRequest) (*User, error)
 	Delete(uint) (*User, error)
-	Update(uint, string, string, string, float32, float32, float32) (*User, error)
+	GetTrashed() ([]*User, error)
+	Restore(uint) (*User, error)
+	Purge(time.Time) (int64, error)
+	Erase(uint) (*User, error)
+	Update(*User) (*User, error)
+	MarkEmailVerified(uint) (*User, error)
+	UpdateRole(uint, string) (*User, error)
+	WithContext(ctx context.Context) UserCRUDOperation
 }
 
+// type assertion
+var _ UserCRUDOperation = (*UserCRUDOperationsImpl)(nil)
+
 type UserCRUDOperationsImpl struct {
 	DB     *gorm.DB
 	Logger *zap.SugaredLogger
 }
 
+// WithContext returns a copy that runs its queries with ctx, so they are traced and cancelled with the request
+func (u *UserCRUDOperationsImpl) WithContext(ctx context.Context) UserCRUDOperation {
+	clone := *u
+	clone.DB = u.DB.WithContext(ctx)
+	return &clone
+}
+
 type User struct {
 	gorm.Model
-	Username string  `json:"username" gorm:"unique"`
-	Password string  `json:"password"`
-	DOB      string  `json:"dob"`
-	Role     string  `json:"role"`
-	Chest    float32 `json:"chest"`
-	Waist    float32 `json:"waist"`
-	Hip      float32 `json:"hip"`
-	Orders   []Order
+	Username        string     `json:"username" gorm:"unique"`
+	Email           string     `json:"email" gorm:"size:191;index"`
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Password        string     `json:"-"`
+	DOB             string     `json:"dob"`
+	Role            string     `json:"role"`
+	Chest           float32    `json:"chest"`
+	Waist           float32    `json:"waist"`
+	Hip             float32    `json:"hip"`
+	TOTPSecret      string     `json:"-"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+	TOTPLastStep    int64      `json:"-"`
+	Orders          []Order
 }
 
 func (u *UserCRUDOperationsImpl) GetByID(id uint) (*User, error) {
@@ -43,9 +73,24 @@ func (u *UserCRUDOperationsImpl) GetByID(id uint) (*User, error) {
 	return user, nil
 }
 
+// NormalizeIdentifier lowercases a username or email. Both are stored lowercased, so they are
+// unique and matched regardless of case on every database and lookups can use the indexes.
+func NormalizeIdentifier(value string) string {
+	return strings.ToLower(value)
+}
+
 func (u *UserCRUDOperationsImpl) GetByUsername(username string) (*User, error) {
 	user := &User{}
-	err := u.DB.Where("username = ?", username).First(user).Error
+	err := u.DB.Where("username = ?", NormalizeIdentifier(username)).First(user).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (u *UserCRUDOperationsImpl) GetByEmail(email string) (*User, error) {
+	user := &User{}
+	err := u.DB.Where("email = ?", NormalizeIdentifier(email)).First(user).Error
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +108,8 @@ func (u *UserCRUDOperationsImpl) GetAll() ([]*User, error) {
 
 func (u *UserCRUDOperationsImpl) Insert(userReq *dto.UserRequest) (*User, error) {
 	user := &User{
-		Username: userReq.Username,
+		Username: NormalizeIdentifier(userReq.Username),
+		Email:    NormalizeIdentifier(userReq.Email),
 		Password: userReq.Password,
 		DOB:      userReq.DOB,
 		Role:     userReq.Role,
@@ -82,21 +128,169 @@ func (u *UserCRUDOperationsImpl) Delete(id uint) (*User, error) {
 		return nil, err
 	}
 	//delete only if the user exists
-	//permanently deleted with Unscoped().Delete()
-	err = u.DB.Unscoped().Delete(foundUser, id).Error
+	//soft deleted, it stays in the trash until restored or purged
+	err = u.DB.Delete(foundUser, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return foundUser, nil
+}
+
+func (u *UserCRUDOperationsImpl) GetTrashed() ([]*User, error) {
+	var users []*User
+	err := u.DB.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Restore takes a user out of the trash, unless another account took its email address
+// or username in the meantime ...
+func (u *UserCRUDOperationsImpl) Restore(id uint) (*User, error) {
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		trashedUser := &User{}
+		err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(trashedUser).Error
+		if err != nil {
+			return err
+		}
+
+		taken, err := identifierTaken(tx, id, "email", trashedUser.Email)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return helpers.NewConflictError("email_taken", "email address is registered to another account")
+		}
+		taken, err = identifierTaken(tx, id, "username", trashedUser.Username)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return helpers.NewConflictError("username_taken", "username is used by another account")
+		}
+
+		return tx.Unscoped().Model(&User{}).Where("id = ?", id).Update("deleted_at", nil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return u.GetByID(id)
+}
+
+// identifierTaken reports whether an active user other than id has the value in the column
+func identifierTaken(tx *gorm.DB, id uint, column string, value string) (bool, error) {
+	//erased accounts have no email address left to collide
+	if value == "" {
+		return false, nil
+	}
+	var count int64
+	err := tx.Model(&User{}).Where("id <> ?", id).Where(column+" = ?", value).Count(&count).Error
+	return count > 0, err
+}
+
+// Purge permanently deletes users that have been in the trash since before the cutoff,
+// together with their logins and keys. Users that still have orders are kept, orders are
+// financial records and purged on their own.
+func (u *UserCRUDOperationsImpl) Purge(before time.Time) (int64, error) {
+	var purged int64
+	err := u.DB.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Unscoped().Model(&User{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Where("NOT EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.id)").
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		for _, dependent := range []interface{}{&EmailVerification{}, &RecoveryCode{}, &APIKey{}, &UserIdentity{}} {
+			err = tx.Unscoped().Where("user_id IN ?", ids).Delete(dependent).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		res := tx.Unscoped().Where("id IN ?", ids).Delete(&User{})
+		purged = res.RowsAffected
+		return res.Error
+	})
+	return purged, err
+}
+
+// Erase anonymizes the user for a right-to-erasure request and moves it to the trash.
+// Orders are kept for accounting, they only reference the user id, which no longer leads
+// to any personal data. Audit logs are kept as security records, they reference the user by id
+// only, personal fields are redacted when an entry is recorded.
+func (u *UserCRUDOperationsImpl) Erase(id uint) (*User, error) {
+	foundUser, err := u.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.DB.Transaction(func(tx *gorm.DB) error {
+		for _, dependent := range []interface{}{&EmailVerification{}, &RecoveryCode{}, &APIKey{}, &UserIdentity{}} {
+			err := tx.Unscoped().Where("user_id = ?", id).Delete(dependent).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		//login throttling and lockout history are keyed by the lowercased username
+		loginKey := strings.ToLower(strings.TrimSpace(foundUser.Username))
+		err := tx.Unscoped().Where("kind = ? AND identifier = ?", ThrottleKindAccount, loginKey).Delete(&LoginThrottle{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&LockoutEvent{}).
+			Where("kind = ? AND identifier = ?", ThrottleKindAccount, loginKey).
+			Updates(map[string]interface{}{"identifier": fmt.Sprintf("erased-%v", id), "ip": ""}).Error
+		if err != nil {
+			return err
+		}
+
+		foundUser.Username = fmt.Sprintf("erased-%v", id)
+		foundUser.Email = ""
+		foundUser.EmailVerified = false
+		foundUser.EmailVerifiedAt = nil
+		foundUser.Password = ""
+		foundUser.DOB = ""
+		foundUser.Chest = 0
+		foundUser.Waist = 0
+		foundUser.Hip = 0
+		foundUser.TOTPSecret = ""
+		foundUser.TOTPEnabled = false
+		foundUser.TOTPLastStep = 0
+		err = tx.Save(foundUser).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(foundUser).Error
+	})
 	if err != nil {
 		return nil, err
 	}
 	return foundUser, nil
 }
 
+// Update copies the editable profile fields onto the stored user.
+// Role, ID, timestamps and verification state are never taken from userReq.
 func (u *UserCRUDOperationsImpl) Update(userReq *User) (*User, error) {
 	foundUser, err := u.GetByID(userReq.ID)
 	if err != nil {
 		return nil, err
 	}
-	if userReq.Username != "" && foundUser.Username != userReq.Username {
-		foundUser.Username = userReq.Username
+	username := NormalizeIdentifier(userReq.Username)
+	if username != "" && foundUser.Username != username {
+		foundUser.Username = username
+	}
+	//a changed email address has to be verified again
+	email := NormalizeIdentifier(userReq.Email)
+	if email != "" && foundUser.Email != email {
+		foundUser.Email = email
+		foundUser.EmailVerified = false
+		foundUser.EmailVerifiedAt = nil
 	}
 	if userReq.Password != "" && foundUser.Password != userReq.Password {
 		foundUser.Password = userReq.Password
@@ -121,3 +315,34 @@ func (u *UserCRUDOperationsImpl) Update(userReq *User) (*User, error) {
 	}
 	return foundUser, nil
 }
+
+func (u *UserCRUDOperationsImpl) MarkEmailVerified(id uint) (*User, error) {
+	foundUser, err := u.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	foundUser.EmailVerified = true
+	foundUser.EmailVerifiedAt = &now
+
+	err = u.DB.Save(foundUser).Error
+	if err != nil {
+		return nil, err
+	}
+	return foundUser, nil
+}
+
+func (u *UserCRUDOperationsImpl) UpdateRole(id uint, role string) (*User, error) {
+	foundUser, err := u.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	foundUser.Role = role
+	err = u.DB.Save(foundUser).Error
+	if err != nil {
+		return nil, err
+	}
+	return foundUser, nil
+}
@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const instrumentationName = "future-fashion/tracing"
+
+// spanKey keeps the span of the running statement between the callbacks
+const spanKey = "tracing:span"
+
+// GormPlugin starts a child span for every query run with a context that carries a span,
+// see the WithContext methods of the models. Queries of background jobs stay untraced.
+// Statements are recorded with their placeholders, never with the values ...
+type GormPlugin struct {
+	TracerProvider trace.TracerProvider
+	//mysql, postgres or sqlite
+	DBSystem string
+}
+
+// type assertion
+var _ gorm.Plugin = (*GormPlugin)(nil)
+
+func (p *GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	tracer := p.TracerProvider.Tracer(instrumentationName)
+	callbacks := db.Callback()
+
+	hooks := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"INSERT", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"SELECT", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"UPDATE", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"DELETE", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"SELECT", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"RAW", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+	for _, hook := range hooks {
+		err := hook.before("tracing:before", p.startSpan(tracer, hook.operation))
+		if err != nil {
+			return err
+		}
+		err = hook.after("tracing:after", p.endSpan)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *GormPlugin) startSpan(tracer trace.Tracer, operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			return
+		}
+
+		name := operation
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+		_, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				semconv.DBSystemKey.String(p.DBSystem),
+				semconv.DBOperationKey.String(operation),
+			),
+		)
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func (p *GormPlugin) endSpan(db *gorm.DB) {
+	value, _ := db.InstanceGet(spanKey)
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	db.InstanceSet(spanKey, nil)
+
+	span.SetAttributes(
+		semconv.DBStatementKey.String(db.Statement.SQL.String()),
+		semconv.DBSQLTableKey.String(db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+	span.End()
+}
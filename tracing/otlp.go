@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewOTLPExporter posts spans to the OTLP/HTTP receiver at endpoint, the full url of its
+// traces path, e.g. http://localhost:4318/v1/traces ...
+func NewOTLPExporter(endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	//the exporter takes the host and path apart, plain http has to be asked for
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("tracing endpoint: %v", err)
+	}
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpointURL.Host),
+		otlptracehttp.WithURLPath(endpointURL.Path),
+		otlptracehttp.WithHeaders(headers),
+		otlptracehttp.WithTimeout(10 * time.Second),
+	}
+	if endpointURL.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), options...)
+}
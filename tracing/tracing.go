@@ -0,0 +1,69 @@
+// Package tracing sets up OpenTelemetry: the tracer provider with its exporter, the
+// propagation of incoming trace context and a gorm plugin that traces every query.
+// Spans are exported as OTLP over HTTP with protobuf bodies, or written to stdout in the
+// protobuf json mapping, which is not OTLP/JSON: trace and span ids are base64, not hex.
+package tracing
+
+import (
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+)
+
+// Exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+type Config struct {
+	Exporter    string
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	Environment string
+	SampleRatio float64
+}
+
+// NewTracerProvider returns nil when tracing is off. Spans are exported in batches, call
+// Shutdown on the provider to flush the last ones ...
+func NewTracerProvider(cfg Config) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return nil, nil
+	case ExporterStdout:
+		exporter, err = NewStdoutExporter(os.Stdout)
+	case ExporterOTLP:
+		exporter, err = NewOTLPExporter(cfg.Endpoint, cfg.Headers)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(cfg.ServiceName),
+		semconv.DeploymentEnvironmentKey.String(cfg.Environment),
+	)
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		//follow the caller when the request carries a trace, so a trace is never cut in half
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	), nil
+}
+
+// Propagator reads and writes the W3C traceparent and baggage headers
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}